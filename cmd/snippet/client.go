@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"snippetbox-n/internal/models"
+	"sort"
+	"strings"
+	"time"
+)
+
+// client talks to a snippetbox server's /api/v1
+type client struct {
+	server string
+	token  string
+	http   *http.Client
+}
+
+// apiError is the server's JSON error body
+type apiError struct {
+	Status      int               `json:"-"`
+	Message     string            `json:"error"`
+	FieldErrors map[string]string `json:"field_errors"`
+}
+
+func (e *apiError) Error() string {
+	if len(e.FieldErrors) == 0 {
+		return fmt.Sprintf("%s (%d)", e.Message, e.Status)
+	}
+
+	keys := make([]string, 0, len(e.FieldErrors))
+	for key := range e.FieldErrors {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	fields := make([]string, len(keys))
+	for i, key := range keys {
+		fields[i] = fmt.Sprintf("%s: %s", key, e.FieldErrors[key])
+	}
+	return fmt.Sprintf("%s (%d): %s", e.Message, e.Status, strings.Join(fields, "; "))
+}
+
+type snippetInput struct {
+	Title    string `json:"title"`
+	Content  string `json:"content"`
+	Language string `json:"language"`
+	Expires  int    `json:"expires"`
+}
+
+func newClient(cfg config) *client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if cfg.Insecure {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+
+	return &client{
+		server: cfg.Server,
+		token:  cfg.Token,
+		http:   &http.Client{Timeout: 30 * time.Second, Transport: transport},
+	}
+}
+
+func (c *client) create(input snippetInput) (models.Snippet, error) {
+	var out struct {
+		Snippet models.Snippet `json:"snippet"`
+	}
+	err := c.do(http.MethodPost, "/api/v1/snippets", input, &out)
+	return out.Snippet, err
+}
+
+func (c *client) get(id int) (models.Snippet, error) {
+	var out struct {
+		Snippet models.Snippet `json:"snippet"`
+	}
+	err := c.do(http.MethodGet, fmt.Sprintf("/api/v1/snippets/%d", id), nil, &out)
+	return out.Snippet, err
+}
+
+// list returns the token owner's snippets, filtered by search when it isn't
+// empty
+func (c *client) list(search string, limit int) ([]models.Snippet, error) {
+	query := url.Values{}
+	query.Set("mine", "true")
+	query.Set("limit", fmt.Sprint(limit))
+	if search != "" {
+		query.Set("q", search)
+	}
+
+	var out struct {
+		Snippets []models.Snippet `json:"snippets"`
+	}
+	err := c.do(http.MethodGet, "/api/v1/snippets?"+query.Encode(), nil, &out)
+	return out.Snippets, err
+}
+
+func (c *client) delete(id int) error {
+	return c.do(http.MethodDelete, fmt.Sprintf("/api/v1/snippets/%d", id), nil, nil)
+}
+
+func (c *client) do(method, path string, in, out any) error {
+	var body io.Reader
+	if in != nil {
+		js, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(js)
+	}
+
+	req, err := http.NewRequest(method, c.server+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	req.Header.Set("Accept", "application/json")
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	rs, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer rs.Body.Close()
+
+	if rs.StatusCode >= 400 {
+		apiErr := &apiError{Status: rs.StatusCode}
+		if err := json.NewDecoder(rs.Body).Decode(apiErr); err != nil || apiErr.Message == "" {
+			apiErr.Message = http.StatusText(rs.StatusCode)
+		}
+		return apiErr
+	}
+
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(rs.Body).Decode(out)
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"snippetbox-n/internal/assert"
+	"strings"
+	"testing"
+)
+
+// recordedRequest is what the fake server saw of a client request
+type recordedRequest struct {
+	method      string
+	path        string
+	query       string
+	auth        string
+	contentType string
+	body        string
+}
+
+// newFakeServer answers every request with status and body, recording the
+// request it was sent
+func newFakeServer(t *testing.T, status int, body string) (*client, *recordedRequest) {
+	seen := &recordedRequest{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		*seen = recordedRequest{
+			method:      r.Method,
+			path:        r.URL.Path,
+			query:       r.URL.RawQuery,
+			auth:        r.Header.Get("Authorization"),
+			contentType: r.Header.Get("Content-Type"),
+			body:        string(b),
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		io.WriteString(w, body)
+	}))
+	t.Cleanup(ts.Close)
+
+	return newClient(config{Server: ts.URL, Token: "sb_test"}), seen
+}
+
+func TestClientRequests(t *testing.T) {
+	tests := []struct {
+		name        string
+		command     string
+		args        []string
+		stdin       string
+		response    string
+		wantMethod  string
+		wantPath    string
+		wantQuery   string
+		wantBody    string
+		wantOut     string
+		wantOutHost bool
+	}{
+		{
+			name:        "Create",
+			command:     "create",
+			args:        []string{"-title", "Haiku", "-lang", "go", "-expires", "1"},
+			stdin:       "An old silent pond",
+			response:    `{"snippet":{"id":7}}`,
+			wantMethod:  http.MethodPost,
+			wantPath:    "/api/v1/snippets",
+			wantBody:    `{"title":"Haiku","content":"An old silent pond","language":"go","expires":1}`,
+			wantOut:     "/snippet/view/7\n",
+			wantOutHost: true,
+		},
+		{
+			name:       "Get",
+			command:    "get",
+			args:       []string{"7"},
+			response:   `{"snippet":{"id":7,"content":"An old silent pond"}}`,
+			wantMethod: http.MethodGet,
+			wantPath:   "/api/v1/snippets/7",
+			wantOut:    "An old silent pond",
+		},
+		{
+			name:       "Search",
+			command:    "search",
+			args:       []string{"-limit", "5", "pond"},
+			response:   `{"snippets":[{"id":7,"title":"Haiku","language":"go","expires":"2026-01-02T00:00:00Z"}]}`,
+			wantMethod: http.MethodGet,
+			wantPath:   "/api/v1/snippets",
+			wantQuery:  "limit=5&mine=true&q=pond",
+			wantOut:    "ID  EXPIRES     LANGUAGE  TITLE\n7   2026-01-02  go        Haiku\n",
+		},
+		{
+			name:       "Delete",
+			command:    "delete",
+			args:       []string{"7"},
+			wantMethod: http.MethodDelete,
+			wantPath:   "/api/v1/snippets/7",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, seen := newFakeServer(t, http.StatusOK, tt.response)
+
+			var out bytes.Buffer
+			err := run(c, tt.command, tt.args, strings.NewReader(tt.stdin), &out)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			assert.Equal(t, seen.method, tt.wantMethod)
+			assert.Equal(t, seen.path, tt.wantPath)
+			assert.Equal(t, seen.query, tt.wantQuery)
+			assert.Equal(t, seen.auth, "Bearer sb_test")
+			assert.Equal(t, seen.body, tt.wantBody)
+			if tt.wantBody != "" {
+				assert.Equal(t, seen.contentType, "application/json")
+			}
+
+			wantOut := tt.wantOut
+			if tt.wantOutHost {
+				wantOut = c.server + wantOut
+			}
+			assert.Equal(t, out.String(), wantOut)
+		})
+	}
+}
+
+func TestClientErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		response string
+		want     string
+	}{
+		{
+			name:     "Message",
+			status:   http.StatusUnauthorized,
+			response: `{"error":"invalid or expired API token"}`,
+			want:     "invalid or expired API token (401)",
+		},
+		{
+			name:     "Field errors",
+			status:   http.StatusUnprocessableEntity,
+			response: `{"error":"validation failed","field_errors":{"title":"This field cannot be blank","expires":"This field must equal 1, 7 or 365"}}`,
+			want:     "validation failed (422): expires: This field must equal 1, 7 or 365; title: This field cannot be blank",
+		},
+		{
+			name:     "Not JSON",
+			status:   http.StatusBadGateway,
+			response: "<html>bad gateway</html>",
+			want:     "Bad Gateway (502)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := newFakeServer(t, tt.status, tt.response)
+
+			_, err := c.get(7)
+
+			var apiErr *apiError
+			assert.Equal(t, errors.As(err, &apiErr), true)
+			assert.Equal(t, apiErr.Status, tt.status)
+			assert.Equal(t, err.Error(), tt.want)
+		})
+	}
+}
+
+func TestDeleteReportsFailingID(t *testing.T) {
+	c, _ := newFakeServer(t, http.StatusNotFound, `{"error":"the requested resource could not be found"}`)
+
+	err := run(c, "delete", []string{"9"}, nil, io.Discard)
+
+	assert.Equal(t, err.Error(), "9: the requested resource could not be found (404)")
+}
+
+func TestRunUsage(t *testing.T) {
+	c, _ := newFakeServer(t, http.StatusOK, `{}`)
+
+	tests := []struct {
+		name    string
+		command string
+		args    []string
+	}{
+		{"Unknown command", "frobnicate", nil},
+		{"Get without id", "get", nil},
+		{"Get bad id", "get", []string{"seven"}},
+		{"Search without text", "search", nil},
+		{"Delete without id", "delete", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := run(c, tt.command, tt.args, nil, io.Discard)
+			assert.Equal(t, errors.Is(err, errUsage), true)
+		})
+	}
+}
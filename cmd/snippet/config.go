@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// config is read from a file of "key = value" lines, blank lines and lines
+// starting with # are ignored:
+//
+//	server = https://snippets.example.com
+//	token = sb_...
+//	insecure = false
+type config struct {
+	Server   string
+	Token    string
+	Insecure bool //skip TLS verification, for development servers with self-signed certificates
+}
+
+// defaultConfigPath is $SNIPPET_CONFIG, falling back to snippet/config in the
+// user's config directory
+func defaultConfigPath() string {
+	if path := os.Getenv("SNIPPET_CONFIG"); path != "" {
+		return path
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "snippet", "config")
+}
+
+func loadConfig(path string) (config, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return config{}, err
+	}
+	defer f.Close()
+
+	cfg, err := parseConfig(f)
+	if err != nil {
+		return config{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+func parseConfig(r io.Reader) (config, error) {
+	var cfg config
+
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		key, value, found := strings.Cut(line, "=")
+		if !found {
+			return config{}, fmt.Errorf("line %d: expected key = value", n)
+		}
+		key = strings.TrimSpace(key)
+		value = strings.TrimSpace(value)
+
+		switch key {
+		case "server":
+			cfg.Server = strings.TrimRight(value, "/")
+		case "token":
+			cfg.Token = value
+		case "insecure":
+			insecure, err := strconv.ParseBool(value)
+			if err != nil {
+				return config{}, fmt.Errorf("line %d: insecure must be true or false", n)
+			}
+			cfg.Insecure = insecure
+		default:
+			return config{}, fmt.Errorf("line %d: unknown key %q", n, key)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return config{}, err
+	}
+
+	if cfg.Server == "" {
+		return config{}, fmt.Errorf("no server configured")
+	}
+	if cfg.Token == "" {
+		return config{}, fmt.Errorf("no token configured")
+	}
+	return cfg, nil
+}
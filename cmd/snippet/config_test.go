@@ -0,0 +1,49 @@
+package main
+
+import (
+	"snippetbox-n/internal/assert"
+	"strings"
+	"testing"
+)
+
+func TestParseConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    config
+		wantErr string
+	}{
+		{
+			name:  "Valid",
+			input: "# my server\nserver = https://localhost:4000/\n\ntoken=sb_abc\ninsecure = true\n",
+			want:  config{Server: "https://localhost:4000", Token: "sb_abc", Insecure: true},
+		},
+		{
+			name:    "Missing token",
+			input:   "server = https://localhost:4000",
+			wantErr: "no token configured",
+		},
+		{
+			name:    "Unknown key",
+			input:   "server = https://localhost:4000\ncolour = blue",
+			wantErr: `line 2: unknown key "colour"`,
+		},
+		{
+			name:    "Not key value",
+			input:   "https://localhost:4000",
+			wantErr: "line 1: expected key = value",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := parseConfig(strings.NewReader(tt.input))
+			gotErr := ""
+			if err != nil {
+				gotErr = err.Error()
+			}
+			assert.Equal(t, gotErr, tt.wantErr)
+			assert.Equal(t, cfg, tt.want)
+		})
+	}
+}
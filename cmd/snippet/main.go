@@ -0,0 +1,189 @@
+// Command snippet is a command line client for a snippetbox server's API.
+//
+//	snippet create [-title t] [-lang l] [-expires days] [file ...]
+//	snippet get id
+//	snippet list [-limit n]
+//	snippet search [-limit n] text
+//	snippet delete id ...
+//
+// create reads stdin when no files are given. The server and API token come
+// from a config file, see config.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"text/tabwriter"
+)
+
+const usage = `usage: snippet [-config file] command [arguments]
+
+commands:
+  create [-title t] [-lang l] [-expires 1|7|365] [file ...]
+  get id
+  list [-limit n]
+  search [-limit n] text
+  delete id ...
+`
+
+var errUsage = errors.New("bad usage")
+
+func main() {
+	errLog := log.New(os.Stderr, "snippet: ", 0)
+
+	configPath := flag.String("config", defaultConfigPath(), "Path to the config file holding the server and token")
+	flag.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		errLog.Fatal(err)
+	}
+
+	err = run(newClient(cfg), flag.Arg(0), flag.Args()[1:], os.Stdin, os.Stdout)
+	if err != nil {
+		if errors.Is(err, errUsage) {
+			flag.Usage()
+			os.Exit(2)
+		}
+		errLog.Fatal(err)
+	}
+}
+
+func run(c *client, command string, args []string, stdin io.Reader, stdout io.Writer) error {
+	switch command {
+	case "create":
+		return createCmd(c, args, stdin, stdout)
+	case "get":
+		return getCmd(c, args, stdout)
+	case "list":
+		return listCmd(c, args, stdout, false)
+	case "search":
+		return listCmd(c, args, stdout, true)
+	case "delete":
+		return deleteCmd(c, args)
+	default:
+		return errUsage
+	}
+}
+
+func createCmd(c *client, args []string, stdin io.Reader, stdout io.Writer) error {
+	fs := flag.NewFlagSet("create", flag.ContinueOnError)
+	title := fs.String("title", "", "Title for the snippet, defaults to the file name")
+	lang := fs.String("lang", "", "Language of the snippet, e.g. go")
+	expires := fs.Int("expires", 7, "Days until the snippet expires: 1, 7 or 365")
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+
+	if fs.NArg() == 0 {
+		content, err := io.ReadAll(stdin)
+		if err != nil {
+			return err
+		}
+		if *title == "" {
+			*title = "stdin"
+		}
+		return createOne(c, stdout, snippetInput{*title, string(content), *lang, *expires})
+	}
+
+	for _, path := range fs.Args() {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		name := *title
+		if name == "" {
+			name = filepath.Base(path)
+		}
+		err = createOne(c, stdout, snippetInput{name, string(content), *lang, *expires})
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+func createOne(c *client, stdout io.Writer, input snippetInput) error {
+	snippet, err := c.create(input)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "%s/snippet/view/%d\n", c.server, snippet.ID)
+	return nil
+}
+
+func getCmd(c *client, args []string, stdout io.Writer) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	id, err := strconv.Atoi(args[0])
+	if err != nil {
+		return errUsage
+	}
+
+	snippet, err := c.get(id)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(stdout, snippet.Content)
+	return err
+}
+
+func listCmd(c *client, args []string, stdout io.Writer, search bool) error {
+	fs := flag.NewFlagSet("list", flag.ContinueOnError)
+	limit := fs.Int("limit", 20, "Maximum number of snippets to show")
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+
+	text := ""
+	if search {
+		if fs.NArg() != 1 {
+			return errUsage
+		}
+		text = fs.Arg(0)
+	} else if fs.NArg() != 0 {
+		return errUsage
+	}
+
+	snippets, err := c.list(text, *limit)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tEXPIRES\tLANGUAGE\tTITLE")
+	for _, s := range snippets {
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n", s.ID, s.Expires.Format("2006-01-02"), s.Language, s.Title)
+	}
+	return tw.Flush()
+}
+
+func deleteCmd(c *client, args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+
+	for _, arg := range args {
+		id, err := strconv.Atoi(arg)
+		if err != nil {
+			return errUsage
+		}
+		if err = c.delete(id); err != nil {
+			return fmt.Errorf("%d: %w", id, err)
+		}
+	}
+	return nil
+}
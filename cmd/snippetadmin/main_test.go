@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"snippetbox-n/internal/assert"
+	"snippetbox-n/internal/models"
+	"snippetbox-n/internal/password"
+	"snippetbox-n/internal/testdb"
+	"strconv"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func newTestAdmin(t *testing.T) (*admin, *bytes.Buffer) {
+	db := testdb.New(t)
+
+	hasher, err := password.New("bcrypt", bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	return &admin{
+		users:     &models.UserModel{DB: db, Hasher: hasher},
+		twoFactor: &models.TwoFactorModel{DB: db},
+		snippets:  &models.SnippetModel{DB: db},
+		stats:     &models.StatsModel{DB: db},
+		audit:     &models.AuditModel{DB: db},
+		out:       &out,
+	}, &out
+}
+
+func TestCreateUser(t *testing.T) {
+	a, out := newTestAdmin(t)
+
+	err := a.run("createuser", []string{"-name", "Alice", "-email", "alice@example.com", "-password", "violet tractor ember moss"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, out.String(), "created user alice@example.com\n")
+
+	user, err := a.users.GetByEmail("alice@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, user.EmailVerified, true)
+
+	_, err = a.users.Authenticate("alice@example.com", "violet tractor ember moss")
+	assert.Equal(t, err, nil)
+
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr error
+		want    string
+	}{
+		{"Short", []string{"-name", "Bob", "-email", "bob@example.com", "-password", "x"}, nil, "password must be at least 8 characters long"},
+		{"Common", []string{"-name", "Bob", "-email", "bob@example.com", "-password", "letmein123"}, password.ErrCommon, ""},
+		{"Weak", []string{"-name", "Bob", "-email", "bob@example.com", "-password", "bob12345"}, password.ErrTooEasy, ""},
+		{"Too long", []string{"-name", "Bob", "-email", "bob@example.com", "-password", strings.Repeat("violet tractor ", 5)}, password.ErrTooLong, ""},
+		{"No email", []string{"-name", "Bob", "-password", "violet tractor ember moss"}, nil, "email must be a valid email address"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := a.run("createuser", tt.args)
+			if tt.wantErr != nil {
+				assert.Equal(t, errors.Is(err, tt.wantErr), true)
+			} else {
+				assert.Equal(t, err.Error(), tt.want)
+			}
+		})
+	}
+}
+
+func TestCreateUserGeneratedPassword(t *testing.T) {
+	a, out := newTestAdmin(t)
+
+	err := a.run("createuser", []string{"-name", "Alice", "-email", "alice@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, generated, found := strings.Cut(out.String(), "password: ")
+	assert.Equal(t, found, true)
+
+	_, err = a.users.Authenticate("alice@example.com", strings.TrimSpace(generated))
+	assert.Equal(t, err, nil)
+}
+
+func TestResetPassword(t *testing.T) {
+	a, out := newTestAdmin(t)
+
+	_, err := a.users.Insert("Alice", "alice@example.com", "violet tractor ember moss")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = a.run("resetpassword", []string{"-email", "alice@example.com", "-password", "alice1234"})
+	assert.Equal(t, errors.Is(err, password.ErrTooEasy), true)
+
+	err = a.run("resetpassword", []string{"-email", "nobody@example.com", "-password", "amber kettle drift lane"})
+	assert.Equal(t, err.Error(), "no user with email nobody@example.com")
+
+	err = a.run("resetpassword", []string{"-email", "alice@example.com", "-password", "amber kettle drift lane"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, out.String(), "reset password for alice@example.com\n")
+
+	_, err = a.users.Authenticate("alice@example.com", "amber kettle drift lane")
+	assert.Equal(t, err, nil)
+
+	// only the reset that went ahead is audited
+	entries, err := a.audit.Recent(10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, len(entries), 1)
+	assert.Equal(t, entries[0].Action, models.AuditPasswordReset)
+	assert.Equal(t, entries[0].ActorID, 0)
+}
+
+func TestAccountCommands(t *testing.T) {
+	a, out := newTestAdmin(t)
+
+	id, err := a.users.Insert("Alice", "alice@example.com", "violet tractor ember moss")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	steps := []struct {
+		command string
+		args    []string
+		want    string
+		check   func(models.User) bool
+	}{
+		{"disable", []string{"-email", "alice@example.com"}, "disabled alice@example.com\n", func(u models.User) bool { return u.Disabled }},
+		{"enable", []string{"-email", "alice@example.com"}, "enabled alice@example.com\n", func(u models.User) bool { return !u.Disabled }},
+		{"setrole", []string{"-email", "alice@example.com", "-role", "moderator"}, "alice@example.com is now moderator\n", func(u models.User) bool { return u.Role == models.RoleModerator }},
+		{"reset2fa", []string{"-email", "alice@example.com"}, "turned off two-factor login for alice@example.com\n", func(u models.User) bool { return !u.TwoFactor }},
+	}
+
+	for _, step := range steps {
+		out.Reset()
+		err := a.run(step.command, step.args)
+		if err != nil {
+			t.Fatalf("%s: %v", step.command, err)
+		}
+		assert.Equal(t, out.String(), step.want)
+
+		user, err := a.users.Get(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, step.check(user), true)
+	}
+
+	err = a.run("setrole", []string{"-email", "alice@example.com", "-role", "owner"})
+	assert.Equal(t, err != nil, true)
+
+	entries, err := a.audit.Recent(10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, len(entries), len(steps))
+}
+
+func TestDeleteSnippetAndPurge(t *testing.T) {
+	a, out := newTestAdmin(t)
+
+	id, err := a.snippets.Insert(0, "Haiku", "An old silent pond", "", 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = a.run("deletesnippet", []string{"999"})
+	assert.Equal(t, err.Error(), "no snippet with id 999")
+
+	err = a.run("deletesnippet", []string{strconv.Itoa(id)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, out.String(), "deleted snippet "+strconv.Itoa(id)+"\n")
+
+	_, err = a.snippets.Get(id)
+	assert.Equal(t, errors.Is(err, models.ErrNoRecord), true)
+
+	out.Reset()
+	err = a.run("purge", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, out.String(), "purged 0 expired snippets\n")
+}
+
+func TestRunUsage(t *testing.T) {
+	// usage is checked before anything touches the database
+	a := &admin{out: io.Discard}
+
+	tests := []struct {
+		name    string
+		command string
+		args    []string
+	}{
+		{"Unknown command", "frobnicate", nil},
+		{"Reset without email", "resetpassword", nil},
+		{"Disable with extra argument", "disable", []string{"-email", "alice@example.com", "extra"}},
+		{"Delete bad id", "deletesnippet", []string{"seven"}},
+		{"Purge with argument", "purge", []string{"now"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := a.run(tt.command, tt.args)
+			assert.Equal(t, errors.Is(err, errUsage), true)
+		})
+	}
+}
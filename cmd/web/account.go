@@ -0,0 +1,252 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"snippetbox-n/internal/mailer"
+	"snippetbox-n/internal/models"
+	"snippetbox-n/internal/validator"
+)
+
+type AccountNameForm struct {
+	Name                string `form:"name"`
+	validator.Validator `form:"-"`
+}
+
+type AccountEmailForm struct {
+	Email               string `form:"email"`
+	CurrentPassword     string `form:"current_password"`
+	validator.Validator `form:"-"`
+}
+
+type AccountPasswordForm struct {
+	CurrentPassword     string `form:"current_password"`
+	NewPassword         string `form:"new_password"`
+	Confirm             string `form:"confirm"`
+	validator.Validator `form:"-"`
+}
+
+// AccountForms holds every form on the account page, only the one that was
+// submitted carries values or errors back
+type AccountForms struct {
+	Name     AccountNameForm
+	Email    AccountEmailForm
+	Password AccountPasswordForm
+	//PasswordFeedback suggests how to make a turned down new password
+	//stronger
+	PasswordFeedback []string
+}
+
+func (app *Application) account(w http.ResponseWriter, r *http.Request) {
+	app.renderAccount(w, r, http.StatusOK, AccountForms{})
+}
+
+func (app *Application) accountNamePost(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	var form AccountNameForm
+	err = app.formDecoder.Decode(&form, r.PostForm)
+	if err != nil {
+		app.clientError(w, http.StatusUnprocessableEntity)
+		return
+	}
+
+	form.CheckField(validator.NotBlank(form.Name), "name", "This field cannot be blank")
+	form.CheckField(validator.MaxChars(form.Name, 255), "name", "This field cannot be more than 255 characters long")
+
+	if !form.Valid() {
+		app.renderAccount(w, r, http.StatusUnprocessableEntity, AccountForms{Name: form})
+		return
+	}
+
+	err = app.userModel.SetName(app.authenticatedUserID(r), form.Name)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.accountChanged(w, r, "Your name has been changed")
+}
+
+func (app *Application) accountEmailPost(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	var form AccountEmailForm
+	err = app.formDecoder.Decode(&form, r.PostForm)
+	if err != nil {
+		app.clientError(w, http.StatusUnprocessableEntity)
+		return
+	}
+
+	form.CheckField(validator.NotBlank(form.Email), "email", "This field cannot be blank")
+	form.CheckField(validator.Matches(form.Email, validator.EmailRegex), "email", "This field must be a valid email address")
+	form.CheckField(validator.NotBlank(form.CurrentPassword), "current_password", "This field cannot be blank")
+
+	if !form.Valid() {
+		app.renderAccount(w, r, http.StatusUnprocessableEntity, AccountForms{Email: form})
+		return
+	}
+
+	id := app.authenticatedUserID(r)
+	old, err := app.userModel.Get(id)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	_, err = app.checkPassword(r, old.Email, form.CurrentPassword)
+	if err != nil {
+		msg, status, ok := passwordRefused(err, "Your current password is incorrect")
+		if !ok {
+			app.serverError(w, err)
+			return
+		}
+		form.AddFieldError("current_password", msg)
+		app.renderAccount(w, r, status, AccountForms{Email: form})
+		return
+	}
+
+	// logs out every other session, accountChanged keeps this one going
+	err = app.userModel.SetEmail(id, form.Email)
+	if err != nil {
+		if errors.Is(err, models.ErrDuplicateEmail) {
+			form.AddFieldError("email", "Email address is already in use")
+			app.renderAccount(w, r, http.StatusUnprocessableEntity, AccountForms{Email: form})
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	err = app.sessionModel.DeleteOthers(id, app.sessionManager.GetInt(r.Context(), "sid"))
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	user, err := app.userModel.Get(id)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	app.sendVerification(user)
+
+	// if someone else made the change, the old address is how the owner finds out
+	app.sendMail(mailer.Message{
+		To:      old.Email,
+		Subject: "Your Snippetbox email address was changed",
+		Body: fmt.Sprintf("Hi %s,\n\nThe email address of your Snippetbox account was changed to %s.\n\n"+
+			"If you didn't do this, reset your password right away and get in touch with us.\n",
+			old.Name, user.Email),
+	})
+
+	app.accountChanged(w, r, "Your email address has been changed, follow the link we've sent to it to verify it")
+}
+
+func (app *Application) accountPasswordPost(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	var form AccountPasswordForm
+	err = app.formDecoder.Decode(&form, r.PostForm)
+	if err != nil {
+		app.clientError(w, http.StatusUnprocessableEntity)
+		return
+	}
+
+	form.CheckField(validator.NotBlank(form.CurrentPassword), "current_password", "This field cannot be blank")
+	form.CheckField(validator.NotBlank(form.NewPassword), "new_password", "This field cannot be blank")
+	form.CheckField(validator.MinChars(form.NewPassword, 8), "new_password", "This field must be at least 8 characters long")
+	form.CheckField(form.Confirm == form.NewPassword, "confirm", "The passwords don't match")
+
+	id := app.authenticatedUserID(r)
+	user, err := app.userModel.Get(id)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	if user.Directory {
+		app.clientError(w, http.StatusForbidden)
+		return
+	}
+	strength := app.checkNewPassword(&form.Validator, "new_password", form.NewPassword, user.Name, user.Email)
+
+	if !form.Valid() {
+		app.renderAccount(w, r, http.StatusUnprocessableEntity, AccountForms{Password: form, PasswordFeedback: strength.Feedback})
+		return
+	}
+
+	_, err = app.checkPassword(r, user.Email, form.CurrentPassword)
+	if err != nil {
+		msg, status, ok := passwordRefused(err, "Your current password is incorrect")
+		if !ok {
+			app.serverError(w, err)
+			return
+		}
+		form.AddFieldError("current_password", msg)
+		app.renderAccount(w, r, status, AccountForms{Password: form})
+		return
+	}
+
+	// logs out every other session, logIn below keeps this one going
+	err = app.userModel.SetPassword(id, form.NewPassword)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	err = app.sessionModel.DeleteOthers(id, app.sessionManager.GetInt(r.Context(), "sid"))
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.accountChanged(w, r, "Your password has been changed")
+}
+
+// accountChanged finishes a successful change, the session token is rotated
+// so the one used before the change can't be replayed
+func (app *Application) accountChanged(w http.ResponseWriter, r *http.Request, flash string) {
+	err := app.logIn(r, app.authenticatedUserID(r), app.sessionManager.GetBool(r.Context(), "rememberMe"))
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", flash)
+	http.Redirect(w, r, "/account", http.StatusSeeOther)
+}
+
+func (app *Application) renderAccount(w http.ResponseWriter, r *http.Request, status int, forms AccountForms) {
+	user, err := app.userModel.Get(app.authenticatedUserID(r))
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	// forms that weren't submitted, or went through, show the current values
+	if forms.Name.Valid() {
+		forms.Name.Name = user.Name
+	}
+	if forms.Email.Valid() {
+		forms.Email.Email = user.Email
+	}
+
+	data := app.newTemplateData(r)
+	data.User = user
+	data.Form = forms
+	data.PasswordFeedback = forms.PasswordFeedback
+	app.render(w, status, "account.tmpl.html", &data)
+}
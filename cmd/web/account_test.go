@@ -0,0 +1,97 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"snippetbox-n/internal/assert"
+	"strings"
+	"testing"
+)
+
+func TestAccountEmailPost(t *testing.T) {
+	app, mail := newTestApplicationDB(t)
+	id := insertUser(t, app, "Alice", "alice@example.com", "pa$$word1234")
+
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+	ts.login(t, "alice@example.com", "pa$$word1234")
+
+	// another session, which the change should log out
+	other := newTestServer(t, app.routes())
+	defer other.Close()
+	other.login(t, "alice@example.com", "pa$$word1234")
+
+	tests := []struct {
+		name     string
+		password string
+		wantErr  string
+	}{
+		{"No password", "", "This field cannot be blank"},
+		{"Wrong password", "wrong password", "Your current password is incorrect"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, body := ts.postForm(t, "/account/email", url.Values{
+				"email":            {"alice@example.net"},
+				"current_password": {tt.password},
+			})
+			assert.Equal(t, code, http.StatusUnprocessableEntity)
+			assert.Equal(t, strings.Contains(body, tt.wantErr), true)
+
+			user, err := app.userModel.Get(id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, user.Email, "alice@example.com")
+		})
+	}
+
+	code, _, _ := ts.postForm(t, "/account/email", url.Values{
+		"email":            {"alice@example.net"},
+		"current_password": {"pa$$word1234"},
+	})
+	assert.Equal(t, code, http.StatusSeeOther)
+
+	user, err := app.userModel.Get(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, user.Email, "alice@example.net")
+
+	// a link to verify the new address and a notice to the old one
+	sent := mail.messages(t, 2)
+	assert.Equal(t, len(sent), 2)
+	recipients := map[string]string{}
+	for _, msg := range sent {
+		recipients[msg.To] = msg.Subject
+	}
+	assert.Equal(t, recipients["alice@example.net"], "Confirm your Snippetbox email address")
+	assert.Equal(t, recipients["alice@example.com"], "Your Snippetbox email address was changed")
+
+	code, _, _ = ts.get(t, "/account")
+	assert.Equal(t, code, http.StatusOK)
+
+	code, header, _ := other.get(t, "/account")
+	assert.Equal(t, code, http.StatusSeeOther)
+	assert.Equal(t, header.Get("Location"), "/user/login")
+}
+
+func TestAccountPasswordFeedback(t *testing.T) {
+	app, _ := newTestApplicationDB(t)
+	insertUser(t, app, "Alice", "alice@example.com", "pa$$word1234")
+
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+	ts.login(t, "alice@example.com", "pa$$word1234")
+
+	code, _, body := ts.postForm(t, "/account/password", url.Values{
+		"current_password": {"pa$$word1234"},
+		"new_password":     {"alice1234"},
+		"confirm":          {"alice1234"},
+	})
+	assert.Equal(t, code, http.StatusUnprocessableEntity)
+	assert.Equal(t, strings.Contains(body, "This password is too easy to guess"), true)
+	assert.Equal(t, strings.Contains(body, "<ul class='password-feedback'>"), true)
+	assert.Equal(t, strings.Contains(body, "Avoid using your name or email address"), true)
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"snippetbox-n/internal/models"
+	"strconv"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+const (
+	adminRecentUsers = 20
+	auditPageSize    = 50
+	// maxAuditPage keeps the page's offset well inside an int, any higher
+	// page is not found
+	maxAuditPage = 1_000_000
+)
+
+func (app *Application) adminDashboard(w http.ResponseWriter, r *http.Request) {
+	stats, err := app.statsModel.Get()
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	// only the newest users are listed, any other is looked up by email
+	// address or ID
+	lookup := strings.TrimSpace(r.URL.Query().Get("user"))
+	var users []models.User
+	if lookup != "" {
+		users, err = app.adminFindUser(lookup)
+	} else {
+		users, err = app.userModel.Recent(adminRecentUsers)
+	}
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	snippets, err := app.snippetModel.LatestTen()
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Stats = stats
+	data.Users = users
+	data.UserLookup = lookup
+	data.SnippetSlice = snippets
+	app.render(w, http.StatusOK, "admin.tmpl.html", &data)
+}
+
+// adminFindUser returns the user with lookup as their ID or email address, or
+// none
+func (app *Application) adminFindUser(lookup string) ([]models.User, error) {
+	var user models.User
+	id, err := strconv.Atoi(lookup)
+	if err == nil {
+		user, err = app.userModel.Get(id)
+	} else {
+		user, err = app.userModel.GetByEmail(lookup)
+	}
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			return []models.User{}, nil
+		}
+		return nil, err
+	}
+	return []models.User{user}, nil
+}
+
+func (app *Application) adminUserDisablePost(w http.ResponseWriter, r *http.Request) {
+	app.adminSetDisabled(w, r, true)
+}
+
+func (app *Application) adminUserEnablePost(w http.ResponseWriter, r *http.Request) {
+	app.adminSetDisabled(w, r, false)
+}
+
+// adminSetDisabled disables or enables the user named in the URL. Disabling
+// logs them out everywhere.
+func (app *Application) adminSetDisabled(w http.ResponseWriter, r *http.Request, disabled bool) {
+	params := httprouter.ParamsFromContext(r.Context())
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil || id < 1 {
+		app.notFound(w)
+		return
+	}
+
+	// an admin locking themselves out needs someone else to let them back in
+	if id == app.authenticatedUserID(r) {
+		app.sessionManager.Put(r.Context(), "flash", "You can't disable your own account")
+		http.Redirect(w, r, "/admin", http.StatusSeeOther)
+		return
+	}
+
+	user, err := app.userModel.Get(id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	action, flash := models.AuditUserEnabled, "enabled"
+	if disabled {
+		action, flash = models.AuditUserDisabled, "disabled"
+	}
+	err = app.audit(r, action, fmt.Sprintf("user %d (%s)", user.ID, user.Email))
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	err = app.userModel.SetDisabled(id, disabled)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	if disabled {
+		err = app.sessionModel.DeleteOthers(id, 0)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", fmt.Sprintf("%s has been %s", user.Email, flash))
+	http.Redirect(w, r, "/admin", http.StatusSeeOther)
+}
+
+func (app *Application) adminSnippetDeletePost(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil || id < 1 {
+		app.notFound(w)
+		return
+	}
+
+	snippet, err := app.snippetModel.Get(id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	err = app.audit(r, models.AuditSnippetDeleted, fmt.Sprintf("snippet %d (%q)", snippet.ID, snippet.Title))
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	err = app.snippetModel.Delete(id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Snippet deleted")
+	http.Redirect(w, r, "/admin", http.StatusSeeOther)
+}
+
+func (app *Application) adminAudit(w http.ResponseWriter, r *http.Request) {
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	if page > maxAuditPage {
+		app.notFound(w)
+		return
+	}
+
+	// one more than a page, to know whether there's another
+	entries, err := app.auditModel.Recent(auditPageSize+1, (page-1)*auditPageSize)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.PrevPage = page - 1
+	if len(entries) > auditPageSize {
+		entries = entries[:auditPageSize]
+		data.NextPage = page + 1
+	}
+	data.AuditEntries = entries
+	app.render(w, http.StatusOK, "admin_audit.tmpl.html", &data)
+}
+
+// audit records an action the logged in user is about to take
+func (app *Application) audit(r *http.Request, action, subject string) error {
+	return app.auditModel.Record(app.authenticatedUserID(r), clientIP(r), action, subject)
+}
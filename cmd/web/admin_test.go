@@ -0,0 +1,182 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"snippetbox-n/internal/assert"
+	"snippetbox-n/internal/models"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestAdminNeedsLogin(t *testing.T) {
+	app := newTestApplication(t)
+
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	for _, path := range []string{"/admin", "/admin/audit"} {
+		t.Run(path, func(t *testing.T) {
+			code, header, _ := ts.get(t, path)
+			assert.Equal(t, code, http.StatusSeeOther)
+			assert.Equal(t, header.Get("Location"), "/user/login")
+		})
+	}
+}
+
+func TestAdminNotAdmin(t *testing.T) {
+	app, _ := newTestApplicationDB(t)
+	id := insertUser(t, app, "Mod", "mod@example.com", "pa$$word1234")
+	if err := app.userModel.SetRole(id, models.RoleModerator); err != nil {
+		t.Fatal(err)
+	}
+	other := insertUser(t, app, "Alice", "alice@example.com", "pa$$word1234")
+
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+	ts.login(t, "mod@example.com", "pa$$word1234")
+
+	for _, path := range []string{"/admin", "/admin/audit"} {
+		code, _, _ := ts.get(t, path)
+		assert.Equal(t, code, http.StatusForbidden)
+	}
+	code, _, _ := ts.postForm(t, fmt.Sprintf("/admin/users/disable/%d", other), nil)
+	assert.Equal(t, code, http.StatusForbidden)
+
+	user, err := app.userModel.Get(other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, user.Disabled, false)
+}
+
+func TestAdminActionsAudited(t *testing.T) {
+	app, _ := newTestApplicationDB(t)
+	adminID := insertUser(t, app, "Admin", "admin@example.com", "pa$$word1234")
+	if err := app.userModel.SetRole(adminID, models.RoleAdmin); err != nil {
+		t.Fatal(err)
+	}
+	userID := insertUser(t, app, "Alice", "alice@example.com", "pa$$word1234")
+	snippetID, err := app.snippetModel.Insert(userID, "Spam", "spam", "", 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+	ts.login(t, "admin@example.com", "pa$$word1234")
+
+	tests := []struct {
+		path        string
+		wantAction  string
+		wantSubject string
+	}{
+		{fmt.Sprintf("/admin/users/disable/%d", userID), models.AuditUserDisabled, fmt.Sprintf("user %d (alice@example.com)", userID)},
+		{fmt.Sprintf("/admin/users/enable/%d", userID), models.AuditUserEnabled, fmt.Sprintf("user %d (alice@example.com)", userID)},
+		{fmt.Sprintf("/admin/snippets/delete/%d", snippetID), models.AuditSnippetDeleted, fmt.Sprintf("snippet %d (\"Spam\")", snippetID)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.wantAction, func(t *testing.T) {
+			code, header, _ := ts.postForm(t, tt.path, nil)
+			assert.Equal(t, code, http.StatusSeeOther)
+			assert.Equal(t, header.Get("Location"), "/admin")
+
+			entries, err := app.auditModel.Recent(1, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, len(entries), 1)
+			assert.Equal(t, entries[0].ActorID, adminID)
+			assert.Equal(t, entries[0].Action, tt.wantAction)
+			assert.Equal(t, entries[0].Subject, tt.wantSubject)
+		})
+	}
+
+	_, err = app.snippetModel.Get(snippetID)
+	assert.Equal(t, err, models.ErrNoRecord)
+
+	entries, err := app.auditModel.Recent(10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, len(entries), len(tests))
+}
+
+func TestAdminUserLookup(t *testing.T) {
+	app, _ := newTestApplicationDB(t)
+	adminID := insertUser(t, app, "Admin", "admin@example.com", "pa$$word1234")
+	if err := app.userModel.SetRole(adminID, models.RoleAdmin); err != nil {
+		t.Fatal(err)
+	}
+	aliceID := insertUser(t, app, "Alice", "alice@example.com", "pa$$word1234")
+	// enough newer signups to push Alice off the dashboard
+	for i := range adminRecentUsers {
+		insertUser(t, app, "User", fmt.Sprintf("user%d@example.com", i), "pa$$word1234")
+	}
+
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+	ts.login(t, "admin@example.com", "pa$$word1234")
+
+	_, _, body := ts.get(t, "/admin")
+	assert.Equal(t, strings.Contains(body, "alice@example.com"), false)
+
+	tests := []struct {
+		name   string
+		lookup string
+		want   string
+	}{
+		{"Email", "alice@example.com", "alice@example.com"},
+		{"ID", strconv.Itoa(aliceID), "alice@example.com"},
+		{"Unknown email", "nobody@example.com", "No user has that email address or ID"},
+		{"Unknown ID", "999999", "No user has that email address or ID"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, body := ts.get(t, "/admin?user="+url.QueryEscape(tt.lookup))
+			assert.Equal(t, code, http.StatusOK)
+			assert.Equal(t, strings.Contains(body, tt.want), true)
+			assert.Equal(t, strings.Contains(body, "user0@example.com"), false)
+		})
+	}
+
+	// the looked up user can be acted on
+	code, _, body := ts.get(t, "/admin?user=alice@example.com")
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, strings.Contains(body, fmt.Sprintf("/admin/users/disable/%d", aliceID)), true)
+}
+
+func TestAdminAuditPage(t *testing.T) {
+	app, _ := newTestApplicationDB(t)
+	adminID := insertUser(t, app, "Admin", "admin@example.com", "pa$$word1234")
+	if err := app.userModel.SetRole(adminID, models.RoleAdmin); err != nil {
+		t.Fatal(err)
+	}
+
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+	ts.login(t, "admin@example.com", "pa$$word1234")
+
+	tests := []struct {
+		page     string
+		wantCode int
+	}{
+		{"", http.StatusOK},
+		{"-1", http.StatusOK},
+		{"2", http.StatusOK},
+		{strconv.Itoa(maxAuditPage), http.StatusOK},
+		{strconv.Itoa(maxAuditPage + 1), http.StatusNotFound},
+		{"9223372036854775807", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.page, func(t *testing.T) {
+			code, _, _ := ts.get(t, "/admin/audit?page="+tt.page)
+			assert.Equal(t, code, tt.wantCode)
+		})
+	}
+}
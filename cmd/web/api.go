@@ -0,0 +1,266 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/julienschmidt/httprouter"
+	"io"
+	"mime"
+	"net/http"
+	"runtime/debug"
+	"snippetbox-n/internal/models"
+	"snippetbox-n/internal/validator"
+	"strconv"
+)
+
+// The /api/v1 routes sit outside noSurf. Requests with a body must be sent as
+// application/json, which a browser won't do cross-origin without a CORS
+// preflight we never answer, so session cookies can't be ridden from other
+// sites.
+
+// envelope wraps every JSON response body. Failures are reported under "error",
+// with validation failures listed under "field_errors".
+type envelope map[string]any
+
+const (
+	maxJSONBytes     = 1 << 20
+	defaultListLimit = 20
+	maxListLimit     = 100
+)
+
+var errUnsupportedMediaType = errors.New("Content-Type must be application/json")
+
+func (app *Application) writeJSON(w http.ResponseWriter, status int, data envelope) {
+	js, err := json.Marshal(data)
+	if err != nil {
+		app.apiServerError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(append(js, '\n'))
+}
+
+func (app *Application) readJSON(w http.ResponseWriter, r *http.Request, dst any) error {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != "application/json" {
+		return errUnsupportedMediaType
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxJSONBytes)
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+
+	err = dec.Decode(dst)
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+		switch {
+		case errors.Is(err, io.EOF):
+			return errors.New("body must not be empty")
+		case errors.As(err, &maxBytesError):
+			return fmt.Errorf("body must not be larger than %d bytes", maxBytesError.Limit)
+		default:
+			return fmt.Errorf("body contains badly-formed JSON: %w", err)
+		}
+	}
+
+	if dec.More() {
+		return errors.New("body must only contain a single JSON value")
+	}
+	return nil
+}
+
+func (app *Application) apiError(w http.ResponseWriter, status int, message string) {
+	app.writeJSON(w, status, envelope{"error": message})
+}
+
+func (app *Application) apiServerError(w http.ResponseWriter, err error) {
+	trace := fmt.Sprintf("%s\n%s", err.Error(), debug.Stack())
+	app.errorLog.Print(trace)
+	app.apiError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+}
+
+func (app *Application) apiReadError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errUnsupportedMediaType) {
+		app.apiError(w, http.StatusUnsupportedMediaType, err.Error())
+		return
+	}
+	app.apiError(w, http.StatusBadRequest, err.Error())
+}
+
+func (app *Application) apiValidationError(w http.ResponseWriter, v validator.Validator) {
+	app.writeJSON(w, http.StatusUnprocessableEntity, envelope{
+		"error":        "validation failed",
+		"field_errors": v.FieldErrors,
+	})
+}
+
+func (app *Application) apiSnippetList(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	var v validator.Validator
+	limit := queryInt(query.Get("limit"), defaultListLimit, &v, "limit")
+	offset := queryInt(query.Get("offset"), 0, &v, "offset")
+	v.CheckField(limit >= 1 && limit <= maxListLimit, "limit", fmt.Sprintf("This field must be between 1 and %d", maxListLimit))
+	v.CheckField(offset >= 0, "offset", "This field cannot be negative")
+	v.CheckField(validator.PermittedVal(query.Get("mine"), "", "true", "false"), "mine", "This field must be either: true, false")
+	v.CheckField(validator.MaxChars(query.Get("q"), 100), "q", "This field cannot be more than 100 characters long")
+	if !v.Valid() {
+		app.apiValidationError(w, v)
+		return
+	}
+
+	userID := 0
+	if query.Get("mine") == "true" {
+		userID = app.authenticatedUserID(r)
+		if userID == 0 {
+			app.apiError(w, http.StatusUnauthorized, "you must be authenticated to list your snippets")
+			return
+		}
+	}
+
+	snippets, err := app.snippetModel.List(userID, query.Get("q"), limit, offset)
+	if err != nil {
+		app.apiServerError(w, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"snippets": snippets})
+}
+
+func (app *Application) apiSnippetCreate(w http.ResponseWriter, r *http.Request) {
+	var form ContentForm
+	err := app.readJSON(w, r, &form)
+	if err != nil {
+		app.apiReadError(w, err)
+		return
+	}
+
+	form.validate()
+	if !form.Valid() {
+		app.apiValidationError(w, form.Validator)
+		return
+	}
+
+	id, err := app.snippetModel.Insert(app.authenticatedUserID(r), form.Title, form.Content, form.Language, form.Expires)
+	if err != nil {
+		app.apiServerError(w, err)
+		return
+	}
+
+	snippet, err := app.snippetModel.Get(id)
+	if err != nil {
+		app.apiServerError(w, err)
+		return
+	}
+
+	w.Header().Set("Location", fmt.Sprintf("/api/v1/snippets/%d", id))
+	app.writeJSON(w, http.StatusCreated, envelope{"snippet": snippet})
+}
+
+func (app *Application) apiSnippetGet(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.apiSnippetFromParams(w, r)
+	if !ok {
+		return
+	}
+	app.writeJSON(w, http.StatusOK, envelope{"snippet": snippet})
+}
+
+func (app *Application) apiSnippetUpdate(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.apiOwnSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	var form ContentForm
+	err := app.readJSON(w, r, &form)
+	if err != nil {
+		app.apiReadError(w, err)
+		return
+	}
+
+	form.validate()
+	if !form.Valid() {
+		app.apiValidationError(w, form.Validator)
+		return
+	}
+
+	err = app.snippetModel.Update(snippet.ID, form.Title, form.Content, form.Language, form.Expires)
+	if err != nil {
+		app.apiServerError(w, err)
+		return
+	}
+
+	snippet, err = app.snippetModel.Get(snippet.ID)
+	if err != nil {
+		app.apiServerError(w, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"snippet": snippet})
+}
+
+func (app *Application) apiSnippetDelete(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.apiOwnSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.snippetModel.Delete(snippet.ID)
+	if err != nil {
+		app.apiServerError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (app *Application) apiSnippetFromParams(w http.ResponseWriter, r *http.Request) (models.Snippet, bool) {
+	params := httprouter.ParamsFromContext(r.Context())
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil || id < 1 {
+		app.apiError(w, http.StatusNotFound, "snippet not found")
+		return models.Snippet{}, false
+	}
+
+	snippet, err := app.snippetModel.Get(id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.apiError(w, http.StatusNotFound, "snippet not found")
+		} else {
+			app.apiServerError(w, err)
+		}
+		return models.Snippet{}, false
+	}
+	return snippet, true
+}
+
+// apiOwnSnippet is apiSnippetFromParams restricted to the snippet's owner,
+// snippets without an owner can't be changed through the API
+func (app *Application) apiOwnSnippet(w http.ResponseWriter, r *http.Request) (models.Snippet, bool) {
+	snippet, ok := app.apiSnippetFromParams(w, r)
+	if !ok {
+		return models.Snippet{}, false
+	}
+	if snippet.UserID == 0 || snippet.UserID != app.authenticatedUserID(r) {
+		app.apiError(w, http.StatusForbidden, "you do not own this snippet")
+		return models.Snippet{}, false
+	}
+	return snippet, true
+}
+
+// queryInt parses an optional integer query parameter, recording a field error
+// on v when it isn't a number
+func queryInt(value string, fallback int, v *validator.Validator, key string) int {
+	if value == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		v.AddFieldError(key, "This field must be an integer")
+		return fallback
+	}
+	return n
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"snippetbox-n/internal/assert"
+	"strings"
+	"testing"
+)
+
+func TestAPIRequiresAuth(t *testing.T) {
+	app := newTestApplication(t)
+
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+	}{
+		{"Create", http.MethodPost, "/api/v1/snippets"},
+		{"Update", http.MethodPut, "/api/v1/snippets/1"},
+		{"Delete", http.MethodDelete, "/api/v1/snippets/1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, header, body := ts.do(t, tt.method, tt.path, "application/json", strings.NewReader(`{}`))
+
+			assert.Equal(t, code, http.StatusUnauthorized)
+			assert.Equal(t, header.Get("Content-Type"), "application/json")
+			assert.Equal(t, body, `{"error":"you must be authenticated to access this resource"}`)
+		})
+	}
+}
+
+func TestReadJSON(t *testing.T) {
+	app := newTestApplication(t)
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		wantErr     string
+	}{
+		{
+			name:        "Valid",
+			contentType: "application/json; charset=utf-8",
+			body:        `{"title": "O snail", "content": "Climb Mount Fuji", "expires": 7}`,
+		},
+		{
+			name:        "Form encoded",
+			contentType: "application/x-www-form-urlencoded",
+			body:        `title=O+snail`,
+			wantErr:     errUnsupportedMediaType.Error(),
+		},
+		{
+			name:        "Empty",
+			contentType: "application/json",
+			body:        ``,
+			wantErr:     "body must not be empty",
+		},
+		{
+			name:        "Unknown field",
+			contentType: "application/json",
+			body:        `{"FieldErrors": {}}`,
+			wantErr:     `body contains badly-formed JSON: json: unknown field "FieldErrors"`,
+		},
+		{
+			name:        "Trailing value",
+			contentType: "application/json",
+			body:        `{"title": "a"}{"title": "b"}`,
+			wantErr:     "body must only contain a single JSON value",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/api/v1/snippets", strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", tt.contentType)
+
+			var form ContentForm
+			err := app.readJSON(httptest.NewRecorder(), r, &form)
+
+			gotErr := ""
+			if err != nil {
+				gotErr = err.Error()
+			}
+			assert.Equal(t, gotErr, tt.wantErr)
+		})
+	}
+}
@@ -0,0 +1,313 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/julienschmidt/httprouter"
+	"net/http"
+	"snippetbox-n/internal/models"
+	"snippetbox-n/internal/validator"
+	"strconv"
+)
+
+type CollectionForm struct {
+	ID                  int    `form:"-"`
+	Name                string `form:"name"`
+	Visibility          string `form:"visibility"`
+	validator.Validator `form:"-"`
+}
+
+// CollectionSnippetForm is posted by the add, remove and move actions
+type CollectionSnippetForm struct {
+	CollectionID int    `form:"collection_id"`
+	SnippetID    int    `form:"snippet_id"`
+	Direction    string `form:"direction"`
+}
+
+func (app *Application) collectionList(w http.ResponseWriter, r *http.Request) {
+	collections, err := app.collectionModel.ForUser(app.authenticatedUserID(r))
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Collections = collections
+	app.render(w, http.StatusOK, "collections.tmpl.html", &data)
+}
+
+func (app *Application) collectionView(w http.ResponseWriter, r *http.Request) {
+	collection, ok := app.collectionFromParams(w, r)
+	if !ok {
+		return
+	}
+
+	owner := collection.UserID == app.authenticatedUserID(r)
+	if collection.Visibility != models.VisibilityPublic && !owner {
+		app.notFound(w)
+		return
+	}
+
+	snippets, err := app.collectionModel.Snippets(collection.ID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Collection = collection
+	data.SnippetSlice = snippets
+	app.render(w, http.StatusOK, "collection.tmpl.html", &data)
+}
+
+func (app *Application) collectionCreate(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	data.Form = CollectionForm{Visibility: models.VisibilityPrivate}
+	app.render(w, http.StatusOK, "collection_form.tmpl.html", &data)
+}
+
+func (app *Application) collectionCreatePost(w http.ResponseWriter, r *http.Request) {
+	form, ok := app.decodeCollectionForm(w, r)
+	if !ok {
+		return
+	}
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, http.StatusUnprocessableEntity, "collection_form.tmpl.html", &data)
+		return
+	}
+
+	id, err := app.collectionModel.Insert(app.authenticatedUserID(r), form.Name, form.Visibility)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Collection successfully created!")
+	http.Redirect(w, r, fmt.Sprintf("/collection/view/%d", id), http.StatusSeeOther)
+}
+
+func (app *Application) collectionEdit(w http.ResponseWriter, r *http.Request) {
+	collection, ok := app.ownCollection(w, r, 0)
+	if !ok {
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Form = CollectionForm{ID: collection.ID, Name: collection.Name, Visibility: collection.Visibility}
+	app.render(w, http.StatusOK, "collection_form.tmpl.html", &data)
+}
+
+func (app *Application) collectionEditPost(w http.ResponseWriter, r *http.Request) {
+	collection, ok := app.ownCollection(w, r, 0)
+	if !ok {
+		return
+	}
+
+	form, ok := app.decodeCollectionForm(w, r)
+	if !ok {
+		return
+	}
+	form.ID = collection.ID
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, http.StatusUnprocessableEntity, "collection_form.tmpl.html", &data)
+		return
+	}
+
+	err := app.collectionModel.Update(collection.ID, form.Name, form.Visibility)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Collection updated!")
+	http.Redirect(w, r, fmt.Sprintf("/collection/view/%d", collection.ID), http.StatusSeeOther)
+}
+
+func (app *Application) collectionDeletePost(w http.ResponseWriter, r *http.Request) {
+	collection, ok := app.ownCollection(w, r, 0)
+	if !ok {
+		return
+	}
+
+	err := app.collectionModel.Delete(collection.ID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Collection deleted")
+	http.Redirect(w, r, "/collection/mine", http.StatusSeeOther)
+}
+
+func (app *Application) collectionAddPost(w http.ResponseWriter, r *http.Request) {
+	form, ok := app.decodeCollectionSnippetForm(w, r)
+	if !ok {
+		return
+	}
+
+	collection, ok := app.ownCollection(w, r, form.CollectionID)
+	if !ok {
+		return
+	}
+
+	_, err := app.snippetModel.Get(form.SnippetID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	err = app.collectionModel.AddSnippet(collection.ID, form.SnippetID)
+	switch {
+	case errors.Is(err, models.ErrDuplicateSnippet):
+		app.sessionManager.Put(r.Context(), "flash", fmt.Sprintf("This snippet is already in %s", collection.Name))
+	case err != nil:
+		app.serverError(w, err)
+		return
+	default:
+		app.sessionManager.Put(r.Context(), "flash", fmt.Sprintf("Snippet added to %s", collection.Name))
+	}
+	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", form.SnippetID), http.StatusSeeOther)
+}
+
+func (app *Application) collectionRemovePost(w http.ResponseWriter, r *http.Request) {
+	collection, ok := app.ownCollection(w, r, 0)
+	if !ok {
+		return
+	}
+
+	form, ok := app.decodeCollectionSnippetForm(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.collectionModel.RemoveSnippet(collection.ID, form.SnippetID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Snippet removed from collection")
+	http.Redirect(w, r, fmt.Sprintf("/collection/view/%d", collection.ID), http.StatusSeeOther)
+}
+
+func (app *Application) collectionMovePost(w http.ResponseWriter, r *http.Request) {
+	collection, ok := app.ownCollection(w, r, 0)
+	if !ok {
+		return
+	}
+
+	form, ok := app.decodeCollectionSnippetForm(w, r)
+	if !ok {
+		return
+	}
+	if !validator.PermittedVal(form.Direction, "up", "down") {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	err := app.collectionModel.MoveSnippet(collection.ID, form.SnippetID, form.Direction == "up")
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/collection/view/%d", collection.ID), http.StatusSeeOther)
+}
+
+func (app *Application) decodeCollectionForm(w http.ResponseWriter, r *http.Request) (CollectionForm, bool) {
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return CollectionForm{}, false
+	}
+
+	var form CollectionForm
+	err = app.formDecoder.Decode(&form, r.PostForm)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return CollectionForm{}, false
+	}
+
+	form.CheckField(validator.NotBlank(form.Name), "name", "This field cannot be blank")
+	form.CheckField(validator.MaxChars(form.Name, 100), "name", "This field cannot be more than 100 characters long")
+	form.CheckField(validator.PermittedVal(form.Visibility, models.VisibilityPrivate, models.VisibilityPublic), "visibility", "This field must be either: private, public")
+
+	return form, true
+}
+
+func (app *Application) decodeCollectionSnippetForm(w http.ResponseWriter, r *http.Request) (CollectionSnippetForm, bool) {
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return CollectionSnippetForm{}, false
+	}
+
+	var form CollectionSnippetForm
+	err = app.formDecoder.Decode(&form, r.PostForm)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return CollectionSnippetForm{}, false
+	}
+	return form, true
+}
+
+// collectionFromParams loads the collection named by the :id parameter, writing
+// the error response itself when it can't
+func (app *Application) collectionFromParams(w http.ResponseWriter, r *http.Request) (models.Collection, bool) {
+	params := httprouter.ParamsFromContext(r.Context())
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil || id < 1 {
+		app.notFound(w)
+		return models.Collection{}, false
+	}
+	return app.getCollection(w, id)
+}
+
+func (app *Application) getCollection(w http.ResponseWriter, id int) (models.Collection, bool) {
+	collection, err := app.collectionModel.Get(id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return models.Collection{}, false
+	}
+	return collection, true
+}
+
+// ownCollection loads a collection belonging to the current user, from id or
+// from the :id parameter when id is 0. Other users' collections are reported as
+// missing so private ones don't leak.
+func (app *Application) ownCollection(w http.ResponseWriter, r *http.Request, id int) (models.Collection, bool) {
+	var collection models.Collection
+	var ok bool
+	if id == 0 {
+		collection, ok = app.collectionFromParams(w, r)
+	} else {
+		collection, ok = app.getCollection(w, id)
+	}
+	if !ok {
+		return models.Collection{}, false
+	}
+
+	if collection.UserID != app.authenticatedUserID(r) {
+		app.notFound(w)
+		return models.Collection{}, false
+	}
+	return collection, true
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"snippetbox-n/internal/assert"
+	"snippetbox-n/internal/models"
+	"strings"
+	"testing"
+)
+
+func TestCollectionOwnerOnly(t *testing.T) {
+	app, _ := newTestApplicationDB(t)
+
+	ownerID := insertUser(t, app, "Alice", "alice@example.com", "pa$$word1234")
+	insertUser(t, app, "Bob", "bob@example.com", "pa$$word1234")
+
+	first, err := app.snippetModel.Insert(ownerID, "First", "first", "", 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := app.snippetModel.Insert(ownerID, "Second", "second", "", 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := app.collectionModel.Insert(ownerID, "Mine", models.VisibilityPrivate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, snippetID := range []int{first, second} {
+		if err := app.collectionModel.AddSnippet(id, snippetID); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+	ts.login(t, "bob@example.com", "pa$$word1234")
+
+	snippet := fmt.Sprint(second)
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		form   url.Values
+	}{
+		{"Edit form", http.MethodGet, fmt.Sprintf("/collection/edit/%d", id), nil},
+		{"Edit", http.MethodPost, fmt.Sprintf("/collection/edit/%d", id), url.Values{"name": {"Bob's"}, "visibility": {models.VisibilityPublic}}},
+		{"Delete", http.MethodPost, fmt.Sprintf("/collection/delete/%d", id), nil},
+		{"Add", http.MethodPost, "/collection/add", url.Values{"collection_id": {fmt.Sprint(id)}, "snippet_id": {snippet}}},
+		{"Remove", http.MethodPost, fmt.Sprintf("/collection/remove/%d", id), url.Values{"snippet_id": {snippet}}},
+		{"Move", http.MethodPost, fmt.Sprintf("/collection/move/%d", id), url.Values{"snippet_id": {snippet}, "direction": {"up"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var code int
+			if tt.method == http.MethodGet {
+				code, _, _ = ts.get(t, tt.path)
+			} else {
+				code, _, _ = ts.postForm(t, tt.path, tt.form)
+			}
+			assert.Equal(t, code, http.StatusNotFound)
+		})
+	}
+
+	collection, err := app.collectionModel.Get(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, collection.Name, "Mine")
+	assert.Equal(t, collection.Visibility, models.VisibilityPrivate)
+
+	snippets, err := app.collectionModel.Snippets(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, len(snippets), 2)
+	assert.Equal(t, snippets[0].ID, first)
+	assert.Equal(t, snippets[1].ID, second)
+}
+
+func TestCollectionAddDuplicate(t *testing.T) {
+	app, _ := newTestApplicationDB(t)
+
+	userID := insertUser(t, app, "Alice", "alice@example.com", "pa$$word1234")
+	snippetID, err := app.snippetModel.Insert(userID, "First", "first", "", 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := app.collectionModel.Insert(userID, "Mine", models.VisibilityPrivate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := app.collectionModel.AddSnippet(id, snippetID); err != nil {
+		t.Fatal(err)
+	}
+
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+	ts.login(t, "alice@example.com", "pa$$word1234")
+
+	code, header, _ := ts.postForm(t, "/collection/add", url.Values{
+		"collection_id": {fmt.Sprint(id)},
+		"snippet_id":    {fmt.Sprint(snippetID)},
+	})
+	assert.Equal(t, code, http.StatusSeeOther)
+
+	_, _, body := ts.get(t, header.Get("Location"))
+	assert.Equal(t, strings.Contains(body, "This snippet is already in Mine"), true)
+
+	snippets, err := app.collectionModel.Snippets(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, len(snippets), 1)
+}
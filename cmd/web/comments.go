@@ -0,0 +1,212 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/julienschmidt/httprouter"
+	"net/http"
+	"snippetbox-n/internal/models"
+	"snippetbox-n/internal/validator"
+	"strconv"
+)
+
+type CommentForm struct {
+	ID                  int    `form:"-"`
+	SnippetID           int    `form:"snippet_id"`
+	ParentID            int    `form:"parent_id"`
+	Content             string `form:"content"`
+	validator.Validator `form:"-"`
+}
+
+func (app *Application) commentCreatePost(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	var form CommentForm
+	err = app.formDecoder.Decode(&form, r.PostForm)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	snippet, err := app.snippetModel.Get(form.SnippetID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	form.CheckField(validator.NotBlank(form.Content), "content", "This field cannot be blank")
+	form.CheckField(validator.MaxChars(form.Content, 2000), "content", "This field cannot be more than 2000 characters long")
+
+	if !form.Valid() {
+		app.renderSnippet(w, r, http.StatusUnprocessableEntity, snippet, form)
+		return
+	}
+
+	id, err := app.commentModel.Insert(snippet.ID, form.ParentID, app.authenticatedUserID(r), form.Content)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrThreadLocked):
+			form.AddNonFieldError("This thread has been locked by a moderator")
+			app.renderSnippet(w, r, http.StatusUnprocessableEntity, snippet, form)
+		case errors.Is(err, models.ErrNoRecord):
+			app.notFound(w)
+		default:
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Comment posted!")
+	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d#comment-%d", snippet.ID, id), http.StatusSeeOther)
+}
+
+func (app *Application) commentEdit(w http.ResponseWriter, r *http.Request) {
+	comment, ok := app.ownComment(w, r)
+	if !ok {
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Form = CommentForm{ID: comment.ID, SnippetID: comment.SnippetID, Content: comment.Content}
+	app.render(w, http.StatusOK, "comment_edit.tmpl.html", &data)
+}
+
+func (app *Application) commentEditPost(w http.ResponseWriter, r *http.Request) {
+	comment, ok := app.ownComment(w, r)
+	if !ok {
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	var form CommentForm
+	err = app.formDecoder.Decode(&form, r.PostForm)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+	form.ID = comment.ID
+	form.SnippetID = comment.SnippetID
+
+	form.CheckField(validator.NotBlank(form.Content), "content", "This field cannot be blank")
+	form.CheckField(validator.MaxChars(form.Content, 2000), "content", "This field cannot be more than 2000 characters long")
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, http.StatusUnprocessableEntity, "comment_edit.tmpl.html", &data)
+		return
+	}
+
+	err = app.commentModel.Update(comment.ID, form.Content)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Comment updated!")
+	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d#comment-%d", comment.SnippetID, comment.ID), http.StatusSeeOther)
+}
+
+func (app *Application) commentDeletePost(w http.ResponseWriter, r *http.Request) {
+	comment, ok := app.ownComment(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.commentModel.Delete(comment.ID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Comment deleted")
+	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", comment.SnippetID), http.StatusSeeOther)
+}
+
+func (app *Application) commentThreadLockPost(w http.ResponseWriter, r *http.Request) {
+	comment, ok := app.commentFromParams(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.commentModel.SetLocked(comment.ID, !comment.Locked)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	if comment.Locked {
+		app.sessionManager.Put(r.Context(), "flash", "Thread unlocked")
+	} else {
+		app.sessionManager.Put(r.Context(), "flash", "Thread locked")
+	}
+	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d#comment-%d", comment.SnippetID, comment.ThreadID), http.StatusSeeOther)
+}
+
+func (app *Application) commentThreadDeletePost(w http.ResponseWriter, r *http.Request) {
+	comment, ok := app.commentFromParams(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.commentModel.DeleteThread(comment.ID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Thread deleted")
+	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", comment.SnippetID), http.StatusSeeOther)
+}
+
+// commentFromParams loads the comment named by the :id parameter, writing the
+// error response itself when it can't
+func (app *Application) commentFromParams(w http.ResponseWriter, r *http.Request) (models.Comment, bool) {
+	params := httprouter.ParamsFromContext(r.Context())
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil || id < 1 {
+		app.notFound(w)
+		return models.Comment{}, false
+	}
+
+	comment, err := app.commentModel.Get(id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return models.Comment{}, false
+	}
+	return comment, true
+}
+
+// ownComment is commentFromParams restricted to the comment's author
+func (app *Application) ownComment(w http.ResponseWriter, r *http.Request) (models.Comment, bool) {
+	comment, ok := app.commentFromParams(w, r)
+	if !ok {
+		return models.Comment{}, false
+	}
+	if comment.Deleted {
+		app.notFound(w)
+		return models.Comment{}, false
+	}
+	if comment.UserID != app.authenticatedUserID(r) {
+		app.clientError(w, http.StatusForbidden)
+		return models.Comment{}, false
+	}
+	return comment, true
+}
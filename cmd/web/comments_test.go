@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"snippetbox-n/internal/assert"
+	"strings"
+	"testing"
+)
+
+func TestCommentAuthorOnly(t *testing.T) {
+	app, _ := newTestApplicationDB(t)
+	aliceID := insertUser(t, app, "Alice", "alice@example.com", "pa$$word1234")
+	insertUser(t, app, "Bob", "bob@example.com", "pa$$word1234")
+
+	snippetID, err := app.snippetModel.Insert(aliceID, "First", "first", "", 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := app.commentModel.Insert(snippetID, 0, aliceID, "Alice's comment")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+	ts.login(t, "bob@example.com", "pa$$word1234")
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		form   url.Values
+	}{
+		{"Edit form", http.MethodGet, fmt.Sprintf("/comment/edit/%d", id), nil},
+		{"Edit", http.MethodPost, fmt.Sprintf("/comment/edit/%d", id), url.Values{"content": {"Bob was here"}}},
+		{"Delete", http.MethodPost, fmt.Sprintf("/comment/delete/%d", id), nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var code int
+			if tt.method == http.MethodGet {
+				code, _, _ = ts.get(t, tt.path)
+			} else {
+				code, _, _ = ts.postForm(t, tt.path, tt.form)
+			}
+			assert.Equal(t, code, http.StatusForbidden)
+		})
+	}
+
+	comment, err := app.commentModel.Get(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, comment.Content, "Alice's comment")
+	assert.Equal(t, comment.Deleted, false)
+}
+
+func TestCommentLockedThread(t *testing.T) {
+	app, _ := newTestApplicationDB(t)
+	aliceID := insertUser(t, app, "Alice", "alice@example.com", "pa$$word1234")
+	insertUser(t, app, "Bob", "bob@example.com", "pa$$word1234")
+
+	snippetID, err := app.snippetModel.Insert(aliceID, "First", "first", "", 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := app.commentModel.Insert(snippetID, 0, aliceID, "Alice's comment")
+	if err != nil {
+		t.Fatal(err)
+	}
+	reply, err := app.commentModel.Insert(snippetID, root, aliceID, "Alice's reply")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := app.commentModel.SetLocked(root, true); err != nil {
+		t.Fatal(err)
+	}
+
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+	ts.login(t, "bob@example.com", "pa$$word1234")
+
+	// replying to the root or deeper in the thread
+	for _, parent := range []int{root, reply} {
+		code, _, body := ts.postForm(t, "/comment/create", url.Values{
+			"snippet_id": {fmt.Sprint(snippetID)},
+			"parent_id":  {fmt.Sprint(parent)},
+			"content":    {"Bob's reply"},
+		})
+		assert.Equal(t, code, http.StatusUnprocessableEntity)
+		assert.Equal(t, strings.Contains(body, "This thread has been locked by a moderator"), true)
+	}
+
+	comments, err := app.commentModel.ForSnippet(snippetID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, len(comments), 2)
+}
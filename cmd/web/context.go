@@ -1,5 +1,18 @@
 package main
 
+import "snippetbox-n/internal/models"
+
 type contextKey string
 
-const isAuthenticatedContextKey = contextKey("isAuthenticated")
+// authenticatedUserContextKey holds an authenticatedUser, it's only set once
+// the request is authenticated
+const authenticatedUserContextKey = contextKey("authenticatedUser")
+
+// tokenScopeContextKey is only set for requests authenticated with an API token
+const tokenScopeContextKey = contextKey("tokenScope")
+
+// authenticatedUser is who a request is authenticated as
+type authenticatedUser struct {
+	ID   int
+	Role models.Role
+}
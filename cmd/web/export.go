@@ -0,0 +1,341 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"snippetbox-n/internal/models"
+	"snippetbox-n/internal/validator"
+	"time"
+)
+
+// userExport is everything handed over by "download my data", each field
+// becomes one JSON file in the archive
+type userExport struct {
+	Profile     exportProfile
+	Snippets    []models.Snippet
+	Comments    []exportComment
+	Collections []exportCollection
+	Tokens      []exportToken
+	Passkeys    []exportPasskey
+	Sessions    []exportSession
+	Identities  []exportIdentity
+}
+
+type exportProfile struct {
+	ID            int         `json:"id"`
+	Name          string      `json:"name"`
+	Email         string      `json:"email"`
+	EmailVerified bool        `json:"email_verified"`
+	Role          models.Role `json:"role"`
+	TwoFactor     bool        `json:"two_factor"`
+	RecoveryCodes int         `json:"recovery_codes_left,omitempty"`
+	Created       time.Time   `json:"created"`
+}
+
+type exportComment struct {
+	ID        int        `json:"id"`
+	SnippetID int        `json:"snippet_id"`
+	ParentID  int        `json:"parent_id,omitempty"`
+	Content   string     `json:"content"`
+	Deleted   bool       `json:"deleted"`
+	Created   time.Time  `json:"created"`
+	Edited    *time.Time `json:"edited,omitempty"`
+}
+
+type exportCollection struct {
+	ID         int       `json:"id"`
+	Name       string    `json:"name"`
+	Visibility string    `json:"visibility"`
+	Created    time.Time `json:"created"`
+	Snippets   []int     `json:"snippets"`
+}
+
+// exportToken leaves the token itself out, only its hash is stored anyway
+type exportToken struct {
+	Name     string     `json:"name"`
+	Scope    string     `json:"scope"`
+	Created  time.Time  `json:"created"`
+	LastUsed *time.Time `json:"last_used,omitempty"`
+}
+
+// exportPasskey leaves the credential itself out
+type exportPasskey struct {
+	Name     string     `json:"name"`
+	Created  time.Time  `json:"created"`
+	LastUsed *time.Time `json:"last_used,omitempty"`
+}
+
+type exportSession struct {
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"user_agent"`
+	Created   time.Time `json:"created"`
+	LastSeen  time.Time `json:"last_seen"`
+	Expires   time.Time `json:"expires"`
+}
+
+type exportIdentity struct {
+	Provider string    `json:"provider"`
+	Subject  string    `json:"subject"`
+	Created  time.Time `json:"created"`
+}
+
+type AccountDeleteForm struct {
+	Password            string `form:"password"`
+	Snippets            string `form:"snippets"`
+	validator.Validator `form:"-"`
+}
+
+func (app *Application) accountExport(w http.ResponseWriter, r *http.Request) {
+	export, err := app.gatherExport(app.authenticatedUserID(r))
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	filename := fmt.Sprintf("snippetbox-%d-%s.zip", export.Profile.ID, time.Now().UTC().Format("2006-01-02"))
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	w.Header().Set("Cache-Control", "no-store")
+
+	// headers are gone by the time writing the archive can fail, so all that's
+	// left to do is log it
+	err = writeExport(w, export)
+	if err != nil {
+		app.errorLog.Print(err)
+	}
+}
+
+func (app *Application) gatherExport(userID int) (userExport, error) {
+	var export userExport
+
+	user, err := app.userModel.Get(userID)
+	if err != nil {
+		return export, err
+	}
+	export.Profile = exportProfile{
+		ID:            user.ID,
+		Name:          user.Name,
+		Email:         user.Email,
+		EmailVerified: user.EmailVerified,
+		Role:          user.Role,
+		TwoFactor:     user.TwoFactor,
+		Created:       user.Created,
+	}
+	if user.TwoFactor {
+		export.Profile.RecoveryCodes, err = app.twoFactorModel.RecoveryCodesLeft(userID)
+		if err != nil {
+			return export, err
+		}
+	}
+
+	export.Snippets, err = app.snippetModel.ForUser(userID)
+	if err != nil {
+		return export, err
+	}
+
+	comments, err := app.commentModel.ForUser(userID)
+	if err != nil {
+		return export, err
+	}
+	export.Comments = make([]exportComment, 0, len(comments))
+	for _, c := range comments {
+		export.Comments = append(export.Comments, exportComment{
+			ID:        c.ID,
+			SnippetID: c.SnippetID,
+			ParentID:  c.ParentID,
+			Content:   c.Content,
+			Deleted:   c.Deleted,
+			Created:   c.Created,
+			Edited:    optionalTime(c.Edited),
+		})
+	}
+
+	collections, err := app.collectionModel.ForUser(userID)
+	if err != nil {
+		return export, err
+	}
+	export.Collections = make([]exportCollection, 0, len(collections))
+	for _, c := range collections {
+		snippets, err := app.collectionModel.Snippets(c.ID)
+		if err != nil {
+			return export, err
+		}
+		ids := make([]int, 0, len(snippets))
+		for _, s := range snippets {
+			ids = append(ids, s.ID)
+		}
+		export.Collections = append(export.Collections, exportCollection{
+			ID:         c.ID,
+			Name:       c.Name,
+			Visibility: c.Visibility,
+			Created:    c.Created,
+			Snippets:   ids,
+		})
+	}
+
+	tokens, err := app.tokenModel.ForUser(userID)
+	if err != nil {
+		return export, err
+	}
+	export.Tokens = make([]exportToken, 0, len(tokens))
+	for _, t := range tokens {
+		export.Tokens = append(export.Tokens, exportToken{
+			Name:     t.Name,
+			Scope:    t.Scope,
+			Created:  t.Created,
+			LastUsed: optionalTime(t.LastUsed),
+		})
+	}
+
+	passkeys, err := app.passkeyModel.ForUser(userID)
+	if err != nil {
+		return export, err
+	}
+	export.Passkeys = make([]exportPasskey, 0, len(passkeys))
+	for _, p := range passkeys {
+		export.Passkeys = append(export.Passkeys, exportPasskey{
+			Name:     p.Name,
+			Created:  p.Created,
+			LastUsed: optionalTime(p.LastUsed),
+		})
+	}
+
+	sessions, err := app.sessionModel.ForUser(userID)
+	if err != nil {
+		return export, err
+	}
+	export.Sessions = make([]exportSession, 0, len(sessions))
+	for _, s := range sessions {
+		export.Sessions = append(export.Sessions, exportSession{
+			IP:        s.IP,
+			UserAgent: s.UserAgent,
+			Created:   s.Created,
+			LastSeen:  s.LastSeen,
+			Expires:   s.Expires,
+		})
+	}
+
+	identities, err := app.identityModel.ForUser(userID)
+	if err != nil {
+		return export, err
+	}
+	export.Identities = make([]exportIdentity, 0, len(identities))
+	for _, i := range identities {
+		export.Identities = append(export.Identities, exportIdentity{
+			Provider: i.Provider,
+			Subject:  i.Subject,
+			Created:  i.Created,
+		})
+	}
+
+	return export, nil
+}
+
+// writeExport writes the export as a zip archive of JSON files
+func writeExport(w io.Writer, export userExport) error {
+	files := []struct {
+		name string
+		data any
+	}{
+		{"profile.json", export.Profile},
+		{"snippets.json", export.Snippets},
+		{"comments.json", export.Comments},
+		{"collections.json", export.Collections},
+		{"tokens.json", export.Tokens},
+		{"passkeys.json", export.Passkeys},
+		{"sessions.json", export.Sessions},
+		{"identities.json", export.Identities},
+	}
+
+	zw := zip.NewWriter(w)
+	for _, f := range files {
+		fw, err := zw.Create(f.name)
+		if err != nil {
+			return err
+		}
+		enc := json.NewEncoder(fw)
+		enc.SetIndent("", "\t")
+		if err := enc.Encode(f.data); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+func (app *Application) accountDelete(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	data.Form = AccountDeleteForm{Snippets: "delete"}
+	app.render(w, http.StatusOK, "account_delete.tmpl.html", &data)
+}
+
+func (app *Application) accountDeletePost(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	var form AccountDeleteForm
+	err = app.formDecoder.Decode(&form, r.PostForm)
+	if err != nil {
+		app.clientError(w, http.StatusUnprocessableEntity)
+		return
+	}
+
+	form.CheckField(validator.NotBlank(form.Password), "password", "This field cannot be blank")
+	form.CheckField(validator.PermittedVal(form.Snippets, "delete", "anonymize"), "snippets", "This field must be either: delete, anonymize")
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, http.StatusUnprocessableEntity, "account_delete.tmpl.html", &data)
+		return
+	}
+
+	id := app.authenticatedUserID(r)
+	user, err := app.userModel.Get(id)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	_, err = app.checkPassword(r, user.Email, form.Password)
+	if err != nil {
+		msg, status, ok := passwordRefused(err, "Your password is incorrect")
+		if !ok {
+			app.serverError(w, err)
+			return
+		}
+		form.AddFieldError("password", msg)
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, status, "account_delete.tmpl.html", &data)
+		return
+	}
+
+	err = app.userModel.Delete(id, form.Snippets == "anonymize")
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	err = app.sessionManager.RenewToken(r.Context())
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.sessionManager.Remove(r.Context(), "authenticatedUser")
+	app.sessionManager.Put(r.Context(), "flash", "Your account has been deleted")
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
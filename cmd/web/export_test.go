@@ -0,0 +1,79 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"snippetbox-n/internal/assert"
+	"snippetbox-n/internal/models"
+	"testing"
+	"time"
+)
+
+func TestWriteExport(t *testing.T) {
+	created := time.Date(2024, 3, 17, 10, 15, 0, 0, time.UTC)
+	export := userExport{
+		Profile:  exportProfile{ID: 1, Name: "Alice", Email: "alice@example.com", Created: created},
+		Snippets: []models.Snippet{{ID: 4, UserID: 1, Title: "An old silent pond", Created: created}},
+		Comments: []exportComment{{ID: 9, SnippetID: 4, Content: "Nice", Created: created}},
+	}
+
+	var buf bytes.Buffer
+	err := writeExport(&buf, export)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+	}
+	assert.Equal(t, len(names), 8)
+	assert.Equal(t, names[0], "profile.json")
+
+	rc, err := zr.File[1].Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+
+	var snippets []models.Snippet
+	err = json.NewDecoder(rc).Decode(&snippets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, len(snippets), 1)
+	assert.Equal(t, snippets[0].Title, "An old silent pond")
+}
+
+func TestGatherExport(t *testing.T) {
+	app, _ := newTestApplicationDB(t)
+	id := insertUser(t, app, "Alice", "alice@example.com", "pa$$word1234")
+
+	err := app.identityModel.Link(id, "example", "alice-at-example")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+	ts.login(t, "alice@example.com", "pa$$word1234")
+
+	export, err := app.gatherExport(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, export.Profile.Role, models.RoleUser)
+	assert.Equal(t, export.Profile.TwoFactor, false)
+	assert.Equal(t, len(export.Passkeys), 0)
+	assert.Equal(t, len(export.Sessions), 1)
+	assert.Equal(t, export.Sessions[0].UserAgent, "Go-http-client/1.1")
+	assert.Equal(t, len(export.Identities), 1)
+	assert.Equal(t, export.Identities[0].Subject, "alice-at-example")
+}
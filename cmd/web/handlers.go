@@ -5,17 +5,31 @@ import (
 	"fmt"
 	"github.com/julienschmidt/httprouter"
 	"net/http"
+	"regexp"
 	"snippetbox-n/internal/models"
 	"snippetbox-n/internal/validator"
 	"strconv"
 )
 
+// languageRegex allows an empty language, snippets don't have to declare one
+var languageRegex = regexp.MustCompile(`^[a-z0-9+#.-]{0,20}$`)
+
 // JUST USE A FUCKING MACRO!!!!!!
 type ContentForm struct {
-	Title               string `form:"title"`
-	Content             string `form:"content"`
-	Expires             int    `form:"expires"`
-	validator.Validator `form:"-"`
+	Title               string `form:"title" json:"title"`
+	Content             string `form:"content" json:"content"`
+	Language            string `form:"language" json:"language"`
+	Expires             int    `form:"expires" json:"expires"`
+	validator.Validator `form:"-" json:"-"`
+}
+
+// validate holds the snippet rules shared by the HTML form and the API
+func (form *ContentForm) validate() {
+	form.CheckField(validator.NotBlank(form.Title), "title", "This field cannot be blank")
+	form.CheckField(validator.MaxChars(form.Title, 100), "title", "This field cannot be more than 100 characters long")
+	form.CheckField(validator.NotBlank(form.Content), "content", "This field cannot be blank")
+	form.CheckField(validator.Matches(form.Language, languageRegex), "language", "This field must be a short language name such as go or c++")
+	form.CheckField(validator.PermittedVal(form.Expires, 1, 7, 365), "expires", "This field must be either: 1, 7, 365")
 }
 
 type SignUpForm struct {
@@ -28,6 +42,7 @@ type SignUpForm struct {
 type LoginForm struct {
 	Email               string `form:"email"`
 	Password            string `form:"password"`
+	Remember            bool   `form:"remember"`
 	validator.Validator `form:"-"`
 }
 
@@ -68,11 +83,37 @@ func (app *Application) snippetView(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	app.recordView(r, snippet.ID)
+
+	app.renderSnippet(w, r, http.StatusOK, snippet, CommentForm{SnippetID: snippet.ID})
+	// fmt.Fprintf(w, "%+v", snippet)
+}
+
+// renderSnippet shows a snippet with its comment thread, form is the new comment
+// form so failed submissions can be shown with their errors
+func (app *Application) renderSnippet(w http.ResponseWriter, r *http.Request, status int, snippet models.Snippet, form CommentForm) {
+	comments, err := app.commentModel.ForSnippet(snippet.ID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	var collections []models.Collection
+	if id := app.authenticatedUserID(r); id != 0 {
+		collections, err = app.collectionModel.ForUser(id)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+	}
+
 	data := app.newTemplateData(r)
 	data.Snippet = snippet
+	data.Comments = comments
+	data.Collections = collections
+	data.Form = form
 
-	app.render(w, http.StatusOK, "view.tmpl.html", &data)
-	// fmt.Fprintf(w, "%+v", snippet)
+	app.render(w, status, "view.tmpl.html", &data)
 }
 
 func (app *Application) snippetCreatePost(w http.ResponseWriter, r *http.Request) {
@@ -97,10 +138,7 @@ func (app *Application) snippetCreatePost(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	form.CheckField(validator.NotBlank(form.Title), "title", "This field cannot be blank")
-	form.CheckField(validator.MaxChars(form.Title, 100), "title", "This field cannot be more than 100 characters long")
-	form.CheckField(validator.NotBlank(form.Content), "content", "This field cannot be blank")
-	form.CheckField(validator.PermittedVal(form.Expires, 1, 7, 365), "expires", "This field must be either: 1, 7, 365")
+	form.validate()
 
 	if !form.Valid() {
 		data := app.newTemplateData(r)
@@ -109,7 +147,7 @@ func (app *Application) snippetCreatePost(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	id, err := app.snippetModel.Insert(form.Title, form.Content, expires)
+	id, err := app.snippetModel.Insert(app.authenticatedUserID(r), form.Title, form.Content, form.Language, expires)
 	if err != nil {
 		app.serverError(w, err)
 		return
@@ -148,15 +186,17 @@ func (app *Application) userSignupPost(w http.ResponseWriter, r *http.Request) {
 	form.CheckField(validator.Matches(form.Email, validator.EmailRegex), "email", "This field must be a valid email address")
 	form.CheckField(validator.NotBlank(form.Password), "password", "This field cannot be blank")
 	form.CheckField(validator.MinChars(form.Password, 8), "password", "This field must be at least 8 characters long")
+	strength := app.checkNewPassword(&form.Validator, "password", form.Password, form.Name, form.Email)
 
 	if !form.Valid() {
 		data := app.newTemplateData(r)
 		data.Form = form
+		data.PasswordFeedback = strength.Feedback
 		app.render(w, http.StatusUnprocessableEntity, "signup.tmpl.html", &data)
 		return
 	}
 
-	err = app.userModel.Insert(form.Name, form.Email, form.Password)
+	id, err := app.userModel.Insert(form.Name, form.Email, form.Password)
 	if err != nil {
 		if errors.Is(err, models.ErrDuplicateEmail) {
 			form.AddFieldError("email", "Email address is already in use")
@@ -169,7 +209,9 @@ func (app *Application) userSignupPost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	app.sessionManager.Put(r.Context(), "flash", "Your signup was succesful. Please log in")
+	app.sendVerification(models.User{ID: id, Name: form.Name, Email: form.Email})
+
+	app.sessionManager.Put(r.Context(), "flash", "Your signup was succesful. We've emailed you a link to verify your address, please log in")
 	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
 
 }
@@ -201,39 +243,67 @@ func (app *Application) userLoginPost(w http.ResponseWriter, r *http.Request) {
 		data := app.newTemplateData(r)
 		data.Form = form
 		app.render(w, http.StatusUnprocessableEntity, "login.tmpl.html", &data)
+		return
 	}
 
-	id, err := app.userModel.Authenticate(form.Email, form.Password)
+	id, err := app.checkPassword(r, form.Email, form.Password)
 	if err != nil {
-		if errors.Is(err, models.ErrInvalidCredentails) {
-			form.AddNonFieldError("Email or Password is incorrect, Please verify your credentials")
-			data := app.newTemplateData(r)
-			data.Form = form
-			app.render(w, http.StatusUnprocessableEntity, "login.tmpl.html", &data)
-		} else {
+		msg, status, ok := passwordRefused(err, "Email or Password is incorrect, Please verify your credentials")
+		if !ok {
 			app.serverError(w, err)
+			return
 		}
+		form.AddNonFieldError(msg)
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, status, "login.tmpl.html", &data)
 		return
 	}
 
-	err = app.sessionManager.RenewToken(r.Context())
+	user, err := app.userModel.Get(id)
 	if err != nil {
 		app.serverError(w, err)
 		return
 	}
 
-	app.sessionManager.Put(r.Context(), "authenticatedUser", id)
+	// failures aren't forgiven until the second factor is in too
+	if user.TwoFactor {
+		err = app.startTwoFactor(r, id, form.Remember)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+		http.Redirect(w, r, "/user/login/2fa", http.StatusSeeOther)
+		return
+	}
+
+	err = app.logIn(r, id, form.Remember)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	app.loginSucceeded(form.Email)
+
 	http.Redirect(w, r, "/snippet/create", http.StatusSeeOther)
 }
 
 func (app *Application) userLogoutPost(w http.ResponseWriter, r *http.Request) {
+	sid := app.sessionManager.GetInt(r.Context(), "sid")
+	if sid != 0 {
+		err := app.sessionModel.Delete(app.authenticatedUserID(r), sid)
+		if err != nil && !errors.Is(err, models.ErrNoRecord) {
+			app.serverError(w, err)
+			return
+		}
+	}
+
 	err := app.sessionManager.RenewToken(r.Context())
 	if err != nil {
 		app.serverError(w, err)
 		return
 	}
 
-	app.sessionManager.Remove(r.Context(), "authenticatedUser")
+	app.forgetLogIn(r)
 	app.sessionManager.Put(r.Context(), "flash", "You have been logged out successfully")
 	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
@@ -2,8 +2,10 @@ package main
 
 import (
 	"net/http"
+	"net/url"
 	"snippetbox-n/internal/assert"
 	"testing"
+	"time"
 )
 
 // func TestPing(t *testing.T) {
@@ -40,3 +42,43 @@ func TestPing(t *testing.T) {
 	assert.Equal(t, code, http.StatusOK)
 	assert.Equal(t, body, "OK")
 }
+
+func TestUserLoginRememberMe(t *testing.T) {
+	app, _ := newTestApplicationDB(t)
+	id := insertUser(t, app, "Alice", "alice@example.com", "pa$$word1234")
+
+	tests := []struct {
+		name         string
+		remember     string
+		wantPersist  bool
+		wantLifetime time.Duration
+	}{
+		{"Ticked", "true", true, app.rememberFor},
+		{"Not ticked", "", false, app.sessionManager.Lifetime},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestServer(t, app.routes())
+			defer ts.Close()
+
+			code, header, _ := ts.postForm(t, "/user/login", url.Values{
+				"email":    {"alice@example.com"},
+				"password": {"pa$$word1234"},
+				"remember": {tt.remember},
+			})
+			assert.Equal(t, code, http.StatusSeeOther)
+
+			// only a remembered cookie outlives the browser
+			wantExpires := time.Now().Add(tt.wantLifetime)
+			cookie := sessionCookie(t, header)
+			assert.Equal(t, !cookie.Expires.IsZero(), tt.wantPersist)
+			if tt.wantPersist {
+				assert.Equal(t, cookie.Expires.Sub(wantExpires).Abs() < time.Minute, true)
+			}
+
+			session := newestSession(t, app, id)
+			assert.Equal(t, session.Expires.Sub(wantExpires).Abs() < time.Minute, true)
+		})
+	}
+}
@@ -2,9 +2,12 @@ package main
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"net/http"
 	"runtime/debug"
+	"snippetbox-n/internal/mailer"
+	"snippetbox-n/internal/models"
 	"time"
 
 	"github.com/justinas/nosurf"
@@ -53,14 +56,95 @@ func (app *Application) newTemplateData(r *http.Request) templateData {
 		CurrentYear:     time.Now().Year(),
 		Flash:           app.sessionManager.PopString(r.Context(), "flash"),
 		IsAuthenticated: app.isAuthenticated(r),
+		UserID:          app.authenticatedUserID(r),
+		IsModerator:     app.hasRole(r, models.RoleModerator),
+		IsAdmin:         app.hasRole(r, models.RoleAdmin),
 		CSRFToken:       nosurf.Token(r),
+		LoginProviders:  app.oidcProviders,
 	}
 }
 
-func (app *Application) isAuthenticated(r *http.Request) bool {
-	isAuth, ok := r.Context().Value(isAuthenticatedContextKey).(bool)
+// currentUser returns the zero authenticatedUser when the request isn't
+// authenticated
+func (app *Application) currentUser(r *http.Request) authenticatedUser {
+	user, ok := r.Context().Value(authenticatedUserContextKey).(authenticatedUser)
 	if !ok {
-		return false
+		return authenticatedUser{}
+	}
+	return user
+}
+
+func (app *Application) isAuthenticated(r *http.Request) bool {
+	return app.currentUser(r).ID != 0
+}
+
+// authenticatedUserID returns 0 when the request isn't authenticated
+func (app *Application) authenticatedUserID(r *http.Request) int {
+	return app.currentUser(r).ID
+}
+
+// hasRole reports whether the request is authenticated as a user with role,
+// or one above it
+func (app *Application) hasRole(r *http.Request, role models.Role) bool {
+	return app.isAuthenticated(r) && app.currentUser(r).Role.Has(role)
+}
+
+// logIn puts an authenticated user into the session under a fresh token.
+// Remembered sessions outlive the browser, for -remember-lifetime, and aren't
+// logged out when idle.
+func (app *Application) logIn(r *http.Request, id int, remember bool) error {
+	version, _, err := app.userModel.SessionState(id)
+	if err != nil {
+		return err
+	}
+
+	// logging in again, as after an account change, replaces the session's
+	// old row rather than listing it twice
+	if old := app.sessionManager.GetInt(r.Context(), "sid"); old != 0 {
+		err = app.sessionModel.Delete(id, old)
+		if err != nil && !errors.Is(err, models.ErrNoRecord) {
+			return err
+		}
 	}
-	return isAuth
+
+	err = app.sessionManager.RenewToken(r.Context())
+	if err != nil {
+		return err
+	}
+
+	app.sessionManager.RememberMe(r.Context(), remember)
+	if remember {
+		app.sessionManager.SetDeadline(r.Context(), time.Now().Add(app.rememberFor))
+	}
+
+	app.sessionManager.Put(r.Context(), "authenticatedUser", id)
+	app.sessionManager.Put(r.Context(), "sessionVersion", version)
+	app.sessionManager.Put(r.Context(), "rememberMe", remember)
+	return app.trackSession(r, id)
+}
+
+// trackSession records the session in the user's list of sessions
+func (app *Application) trackSession(r *http.Request, id int) error {
+	sid, err := app.sessionModel.Insert(id, clientIP(r), r.UserAgent(), app.sessionManager.Deadline(r.Context()))
+	if err != nil {
+		return err
+	}
+	app.sessionManager.Put(r.Context(), "sid", sid)
+	return nil
+}
+
+// sendMail delivers msg in the background so handlers don't wait on the mail
+// server, failures are only logged
+func (app *Application) sendMail(msg mailer.Message) {
+	go func() {
+		defer func() {
+			if err := recover(); err != nil {
+				app.errorLog.Print(fmt.Errorf("%s", err))
+			}
+		}()
+
+		if err := app.mailer.Send(msg); err != nil {
+			app.errorLog.Print(err)
+		}
+	}()
 }
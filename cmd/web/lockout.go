@@ -0,0 +1,145 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"snippetbox-n/internal/auth"
+	"snippetbox-n/internal/mailer"
+	"snippetbox-n/internal/models"
+	"snippetbox-n/internal/throttle"
+	"strings"
+	"time"
+)
+
+// Failed logins are counted per email address, whether or not it has an
+// account, and per client IP. The IP limit is looser since many people can
+// share an address.
+func newLoginLimiters() (accounts, ips *throttle.Limiter) {
+	accounts = &throttle.Limiter{
+		Free:      3,
+		Base:      time.Second,
+		Max:       time.Minute,
+		LockAfter: 10,
+		LockFor:   15 * time.Minute,
+		Forget:    time.Hour,
+	}
+	ips = &throttle.Limiter{
+		Free:      20,
+		Base:      time.Second,
+		Max:       time.Minute,
+		LockAfter: 100,
+		LockFor:   time.Hour,
+		Forget:    time.Hour,
+	}
+	return accounts, ips
+}
+
+// clientIP is the address a request came from. Behind a reverse proxy that's
+// the proxy's, unless it's named with -trusted-proxy and realIP has swapped in
+// the one it forwarded for.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func loginKey(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// loginWait is how long until a login for email from this client may be tried
+func (app *Application) loginWait(r *http.Request, email string) time.Duration {
+	return max(app.loginAccounts.Wait(loginKey(email)), app.loginIPs.Wait(clientIP(r)))
+}
+
+// loginFailed counts a wrong password, letting the owner of the account know
+// when it gets locked
+func (app *Application) loginFailed(r *http.Request, email string) {
+	app.loginIPs.Fail(clientIP(r))
+	if !app.loginAccounts.Fail(loginKey(email)) {
+		return
+	}
+
+	app.infoLog.Printf("login locked for %s after repeated failures, last from %s", email, clientIP(r))
+
+	user, err := app.userModel.GetByEmail(email)
+	if err != nil {
+		if !errors.Is(err, models.ErrNoRecord) {
+			app.errorLog.Print(err)
+		}
+		return
+	}
+
+	app.sendMail(mailer.Message{
+		To:      user.Email,
+		Subject: "Too many failed logins to your Snippetbox account",
+		Body: fmt.Sprintf("Hi %s,\n\nThere have been several failed attempts to log in to your Snippetbox account, "+
+			"the latest from %s. Logins to it are paused for a while.\n\n"+
+			"If this wasn't you, someone may be trying to guess your password. You can change it here:\n\n%s/user/password/forgot\n",
+			user.Name, clientIP(r), app.baseURL),
+	})
+}
+
+func (app *Application) loginSucceeded(email string) {
+	app.loginAccounts.Reset(loginKey(email))
+}
+
+// loginPausedError turns away a password check while the account or client is
+// waiting out earlier failures
+type loginPausedError struct {
+	wait time.Duration
+}
+
+func (e *loginPausedError) Error() string {
+	return "Too many failed attempts, please try again in " + waitMessage(e.wait)
+}
+
+// checkPassword is how every password is checked, at login or when a logged
+// in user confirms one, so all of them count towards the same limits. A wrong
+// password is models.ErrInvalidCredentails and a paused one *loginPausedError.
+// The count is reset by loginSucceeded once a whole login has gone through.
+func (app *Application) checkPassword(r *http.Request, email, password string) (int, error) {
+	// the same for every address, so it doesn't give away which have accounts
+	if wait := app.loginWait(r, email); wait > 0 {
+		return 0, &loginPausedError{wait: wait}
+	}
+
+	id, err := app.authenticator.Authenticate(email, password)
+	if errors.Is(err, models.ErrInvalidCredentails) {
+		app.loginFailed(r, email)
+	}
+	return id, err
+}
+
+// passwordRefused turns a checkPassword error into the message to show the
+// user and the status to show it with, incorrect being the wording for a wrong
+// password. ok is false for any other error, which is the server's fault.
+func passwordRefused(err error, incorrect string) (msg string, status int, ok bool) {
+	var paused *loginPausedError
+	switch {
+	case errors.As(err, &paused):
+		return paused.Error(), http.StatusTooManyRequests, true
+	case errors.Is(err, models.ErrInvalidCredentails):
+		return incorrect, http.StatusUnprocessableEntity, true
+	case errors.Is(err, auth.ErrUnverifiedEmail):
+		return "An account with this email address hasn't verified it yet, log in with its own password and verify it first", http.StatusUnprocessableEntity, true
+	default:
+		return "", 0, false
+	}
+}
+
+// waitMessage tells someone how long to wait, rounded up to make sure they do
+func waitMessage(wait time.Duration) string {
+	if wait > time.Minute {
+		return fmt.Sprintf("%d minutes", int((wait+time.Minute-1)/time.Minute))
+	}
+	seconds := int((wait + time.Second - 1) / time.Second)
+	if seconds == 1 {
+		return "1 second"
+	}
+	return fmt.Sprintf("%d seconds", seconds)
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"snippetbox-n/internal/assert"
+	"snippetbox-n/internal/auth"
+	"snippetbox-n/internal/models"
+	"snippetbox-n/internal/totp"
+	"testing"
+	"time"
+)
+
+func TestPasswordRefused(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantMsg    string
+		wantStatus int
+		wantOK     bool
+	}{
+		{"Paused", &loginPausedError{wait: time.Minute}, "Too many failed attempts, please try again in 60 seconds", http.StatusTooManyRequests, true},
+		{"Wrong", fmt.Errorf("ldap: %w", models.ErrInvalidCredentails), "Wrong password", http.StatusUnprocessableEntity, true},
+		{"Unverified", auth.ErrUnverifiedEmail, "An account with this email address hasn't verified it yet, log in with its own password and verify it first", http.StatusUnprocessableEntity, true},
+		{"Server", errors.New("directory unreachable"), "", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, status, ok := passwordRefused(tt.err, "Wrong password")
+			assert.Equal(t, msg, tt.wantMsg)
+			assert.Equal(t, status, tt.wantStatus)
+			assert.Equal(t, ok, tt.wantOK)
+		})
+	}
+}
+
+func TestWaitMessage(t *testing.T) {
+	tests := []struct {
+		wait time.Duration
+		want string
+	}{
+		{time.Second, "1 second"},
+		{1500 * time.Millisecond, "2 seconds"},
+		{time.Minute, "60 seconds"},
+		{61 * time.Second, "2 minutes"},
+		{15 * time.Minute, "15 minutes"},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, waitMessage(tt.wait), tt.want)
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	r := httptest.NewRequest("POST", "/user/login", nil)
+	r.RemoteAddr = "203.0.113.7:51234"
+	assert.Equal(t, clientIP(r), "203.0.113.7")
+
+	r.RemoteAddr = "[2001:db8::1]:443"
+	assert.Equal(t, clientIP(r), "2001:db8::1")
+}
+
+func TestCheckPasswordLimits(t *testing.T) {
+	app, _ := newTestApplicationDB(t)
+	insertUser(t, app, "Alice", "alice@example.com", "pa$$word1234")
+
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+	ts.login(t, "alice@example.com", "pa$$word1234")
+
+	form := func(current string) url.Values {
+		return url.Values{
+			"current_password": {current},
+			"new_password":     {"violet tractor ember moss"},
+			"confirm":          {"violet tractor ember moss"},
+		}
+	}
+
+	// the free failures, then one that starts a wait
+	for range app.loginAccounts.Free + 1 {
+		code, _, _ := ts.postForm(t, "/account/password", form("wrong password"))
+		assert.Equal(t, code, http.StatusUnprocessableEntity)
+	}
+
+	code, _, _ := ts.postForm(t, "/account/password", form("pa$$word1234"))
+	assert.Equal(t, code, http.StatusTooManyRequests)
+
+	// and logging in has to wait too
+	other := newTestServer(t, app.routes())
+	defer other.Close()
+	code, _, _ = other.postForm(t, "/user/login", url.Values{"email": {"alice@example.com"}, "password": {"pa$$word1234"}})
+	assert.Equal(t, code, http.StatusTooManyRequests)
+}
+
+func TestLoginTwoFactorLimits(t *testing.T) {
+	app, _ := newTestApplicationDB(t)
+
+	secret, err := totp.NewSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, email := range []string{"alice@example.com", "bob@example.com"} {
+		id := insertUser(t, app, "User", email, "pa$$word1234")
+		if _, err := app.twoFactorModel.Enable(id, secret); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	logIn := func(ts *TestServer, email, password, code string) (int, string) {
+		status, header, _ := ts.postForm(t, "/user/login", url.Values{"email": {email}, "password": {password}})
+		if status != http.StatusSeeOther || code == "" {
+			return status, header.Get("Location")
+		}
+		status, header, _ = ts.postForm(t, "/user/login/2fa", url.Values{"code": {code}})
+		return status, header.Get("Location")
+	}
+
+	t.Run("Wrong codes count", func(t *testing.T) {
+		ts := newTestServer(t, app.routes())
+		defer ts.Close()
+
+		// a right password in between doesn't wipe out the failures
+		for range 2 {
+			code, _ := logIn(&ts, "alice@example.com", "wrong password", "")
+			assert.Equal(t, code, http.StatusUnprocessableEntity)
+		}
+		code, location := logIn(&ts, "alice@example.com", "pa$$word1234", "")
+		assert.Equal(t, code, http.StatusSeeOther)
+		assert.Equal(t, location, "/user/login/2fa")
+
+		for range app.loginAccounts.Free + 1 - 2 {
+			code, _, _ := ts.postForm(t, "/user/login/2fa", url.Values{"code": {"000000"}})
+			assert.Equal(t, code, http.StatusUnprocessableEntity)
+		}
+		assert.Equal(t, app.loginAccounts.Wait(loginKey("alice@example.com")) > 0, true)
+
+		right, err := totp.Code(secret, totp.Step(time.Now()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		code, _, _ = ts.postForm(t, "/user/login/2fa", url.Values{"code": {right}})
+		assert.Equal(t, code, http.StatusTooManyRequests)
+	})
+
+	t.Run("Reset after the second factor", func(t *testing.T) {
+		ts := newTestServer(t, app.routes())
+		defer ts.Close()
+
+		for range app.loginAccounts.Free {
+			code, _ := logIn(&ts, "bob@example.com", "wrong password", "")
+			assert.Equal(t, code, http.StatusUnprocessableEntity)
+		}
+
+		right, err := totp.Code(secret, totp.Step(time.Now()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		code, location := logIn(&ts, "bob@example.com", "pa$$word1234", right)
+		assert.Equal(t, code, http.StatusSeeOther)
+		assert.Equal(t, location, "/snippet/create")
+
+		// without the reset this failure would be one too many
+		app.loginAccounts.Fail(loginKey("bob@example.com"))
+		assert.Equal(t, app.loginAccounts.Wait(loginKey("bob@example.com")), time.Duration(0))
+	})
+}
@@ -1,30 +1,68 @@
 package main
 
 import (
+	"context"
+	"crypto/rand"
 	"crypto/tls"
 	"database/sql"
+	"errors"
 	"flag"
+	"fmt"
 	"github.com/alexedwards/scs/mysqlstore"
 	"github.com/alexedwards/scs/v2"
 	"github.com/go-playground/form/v4"
+	"github.com/go-webauthn/webauthn/webauthn"
 	"html/template"
 	"log"
 	"net/http"
+	"net/netip"
 	"os"
+	"os/signal"
+	"snippetbox-n/internal/auth"
+	"snippetbox-n/internal/mailer"
 	"snippetbox-n/internal/models"
+	"snippetbox-n/internal/password"
+	"snippetbox-n/internal/throttle"
+	"strings"
+	"syscall"
 	"time"
 
 	_ "github.com/go-sql-driver/mysql"
 )
 
 type Application struct {
-	errorLog       *log.Logger
-	infoLog        *log.Logger //do we have to use pointers?
-	userModel      *models.UserModel
-	snippetModel   *models.SnippetModel //has to be a pointer because it contains a db context, which we don't want copying
-	templateCache  map[string]*template.Template
-	formDecoder    *form.Decoder
-	sessionManager *scs.SessionManager
+	errorLog        *log.Logger
+	infoLog         *log.Logger //do we have to use pointers?
+	userModel       *models.UserModel
+	authenticator   auth.Authenticator   //checks login passwords, locally or against a directory
+	loginAccounts   *throttle.Limiter    //failed logins per email address
+	loginIPs        *throttle.Limiter    //failed logins per client IP
+	breaches        password.RangeSource //breached password hashes, nil when not configured
+	snippetModel    *models.SnippetModel //has to be a pointer because it contains a db context, which we don't want copying
+	commentModel    *models.CommentModel
+	collectionModel *models.CollectionModel
+	viewModel       *models.ViewModel
+	viewCounter     *viewCounter
+	tokenModel      *models.TokenModel
+	resetModel      *models.PasswordResetModel
+	twoFactorModel  *models.TwoFactorModel
+	passkeyModel    *models.PasskeyModel
+	sessionModel    *models.SessionModel
+	statsModel      *models.StatsModel
+	auditModel      *models.AuditModel
+	webAuthn        *webauthn.WebAuthn
+	identityModel   *models.IdentityModel
+	oidcProviders   []*oidcProvider
+	mailer          mailer.Sender
+	baseURL         string
+	secret          []byte //signs links that have no database row behind them
+	verifiedOnly    bool   //unverified users can't create snippets
+	templateCache   map[string]*template.Template
+	formDecoder     *form.Decoder
+	sessionManager  *scs.SessionManager
+	rememberFor     time.Duration  //how long "remember me" sessions last
+	idleTimeout     time.Duration  //0 never logs idle sessions out
+	trustedProxies  []netip.Prefix //peers whose X-Forwarded-For header is believed
 }
 
 func openDB(dsn string) (*sql.DB, error) {
@@ -38,20 +76,187 @@ func openDB(dsn string) (*sql.DB, error) {
 	return db, nil
 }
 
-func parseArgs() (string, string) {
-	port := flag.String("port", ":4000", "Port binded to by HTTPS server")
-	dsn := flag.String("dsn", "web:komboyagi.2006Y@/snippetbox?parseTime=true", "The means of connecting to your database")
+type config struct {
+	port    string
+	dsn     string
+	baseURL string //used to build links in emails
+	smtp    struct {
+		host     string
+		port     int
+		username string
+		password string
+	}
+	mailFrom string
+	mailLog  string //where LogSender writes when no SMTP host is set
+	secret   string
+	//what unverified users may do: "allow" everything, or "restrict" them
+	//from creating snippets
+	unverifiedPolicy string
+	oidcConfig       string //JSON file listing OpenID Connect providers
+	authenticators   string //comma separated, tried in order: local, ldap
+	passwordHash     string //scheme for new password hashes, argon2id or bcrypt
+	bcryptCost       int
+	hibpRanges       string //Pwned Passwords range files, a directory or one sorted file
+	sessionLifetime  time.Duration
+	rememberLifetime time.Duration //for sessions logged in with "remember me"
+	idleTimeout      time.Duration //0 never logs idle sessions out
+	trustedProxies   []netip.Prefix
+	ldap             struct {
+		url          string
+		startTLS     bool
+		bindDN       string
+		bindPassword string
+		baseDN       string
+		userFilter   string
+		roleGroups   map[models.Role][]string
+	}
+}
+
+func parseArgs() config {
+	var cfg config
+	flag.StringVar(&cfg.port, "port", ":4000", "Port binded to by HTTPS server")
+	flag.StringVar(&cfg.dsn, "dsn", "web:komboyagi.2006Y@/snippetbox?parseTime=true", "The means of connecting to your database")
+	flag.StringVar(&cfg.baseURL, "base-url", "https://localhost:4000", "Public URL of the site, used in emailed links")
+	flag.StringVar(&cfg.smtp.host, "smtp-host", "", "SMTP server for outgoing mail, mail is logged instead when empty")
+	flag.IntVar(&cfg.smtp.port, "smtp-port", 587, "SMTP server port")
+	flag.StringVar(&cfg.smtp.username, "smtp-username", "", "SMTP username")
+	flag.StringVar(&cfg.smtp.password, "smtp-password", "", "SMTP password")
+	flag.StringVar(&cfg.mailFrom, "mail-from", "Snippetbox <no-reply@snippetbox.local>", "From address for outgoing mail")
+	flag.StringVar(&cfg.mailLog, "mail-log", "", "File to log outgoing mail to when no SMTP host is set, stdout when empty")
+	flag.StringVar(&cfg.secret, "secret", "", "Key used to sign email verification links, a random one is used when empty")
+	flag.StringVar(&cfg.unverifiedPolicy, "unverified-policy", "restrict", `What users with an unverified email may do: "allow" or "restrict" (no new snippets)`)
+	flag.StringVar(&cfg.oidcConfig, "oidc-config", "", "JSON file listing OpenID Connect providers to offer single sign-on with")
+	flag.StringVar(&cfg.passwordHash, "password-hash", "argon2id", `How to hash passwords, "argon2id" or "bcrypt". Other hashes are replaced as users log in`)
+	flag.IntVar(&cfg.bcryptCost, "bcrypt-cost", password.DefaultBcryptCost, "bcrypt cost for password hashes, raising it rehashes passwords as users log in")
+	flag.StringVar(&cfg.hibpRanges, "hibp-ranges", "", "Pwned Passwords hashes to turn down breached passwords with, a directory of range files or one sorted file")
+	flag.DurationVar(&cfg.sessionLifetime, "session-lifetime", 12*time.Hour, "How long a login lasts at most, the cookie also ends with the browser")
+	flag.DurationVar(&cfg.rememberLifetime, "remember-lifetime", 30*24*time.Hour, `How long a login with "remember me" lasts, the cookie outlives the browser`)
+	flag.DurationVar(&cfg.idleTimeout, "session-idle-timeout", 2*time.Hour, `Log out sessions unused for this long, except "remember me" ones; 0 never does`)
+	flag.Func("trusted-proxy", "Address or CIDR range of a reverse proxy whose X-Forwarded-For header gives the client's IP, repeatable", func(s string) error {
+		prefix, err := netip.ParsePrefix(s)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(s)
+			if addrErr != nil {
+				return err
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		cfg.trustedProxies = append(cfg.trustedProxies, prefix.Masked())
+		return nil
+	})
+	flag.StringVar(&cfg.authenticators, "authenticators", "local", `Where login passwords are checked, tried in order: "local", "ldap" or both, comma separated`)
+	flag.StringVar(&cfg.ldap.url, "ldap-url", "", "LDAP server, ldap:// or ldaps://")
+	flag.BoolVar(&cfg.ldap.startTLS, "ldap-starttls", false, "Upgrade ldap:// connections with StartTLS")
+	flag.StringVar(&cfg.ldap.bindDN, "ldap-bind-dn", "", "DN to search the directory as, anonymous when empty")
+	flag.StringVar(&cfg.ldap.bindPassword, "ldap-bind-password", "", "Password for -ldap-bind-dn")
+	flag.StringVar(&cfg.ldap.baseDN, "ldap-base-dn", "", "Where in the directory to look for users")
+	flag.StringVar(&cfg.ldap.userFilter, "ldap-user-filter", "(&(objectClass=person)(mail=%s))", "Filter finding a user's entry, %s is their email")
+	cfg.ldap.roleGroups = map[models.Role][]string{}
+	flag.Func("ldap-role", `Give a role, moderator or admin, to members of a group, as "role=group DN", repeatable`, func(s string) error {
+		name, group, ok := strings.Cut(s, "=")
+		if !ok || name == "" || group == "" {
+			return errors.New(`expected "role=group DN"`)
+		}
+		role, err := models.ParseRole(name)
+		if err != nil {
+			return err
+		}
+		cfg.ldap.roleGroups[role] = append(cfg.ldap.roleGroups[role], group)
+		return nil
+	})
 	flag.Parse()
-	return *port, *dsn
+
+	cfg.baseURL = strings.TrimRight(cfg.baseURL, "/")
+	return cfg
+}
+
+func newMailer(cfg config) (mailer.Sender, error) {
+	if cfg.smtp.host != "" {
+		return &mailer.SMTPSender{
+			Host:     cfg.smtp.host,
+			Port:     cfg.smtp.port,
+			Username: cfg.smtp.username,
+			Password: cfg.smtp.password,
+			From:     cfg.mailFrom,
+		}, nil
+	}
+
+	if cfg.mailLog == "" {
+		return &mailer.LogSender{Out: os.Stdout, From: cfg.mailFrom}, nil
+	}
+	f, err := os.OpenFile(cfg.mailLog, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &mailer.LogSender{Out: f, From: cfg.mailFrom}, nil
+}
+
+func newAuthenticator(cfg config, users *models.UserModel, identities *models.IdentityModel, sessions *models.SessionModel) (auth.Authenticator, error) {
+	var chain auth.Chain
+	for _, name := range strings.Split(cfg.authenticators, ",") {
+		switch strings.TrimSpace(name) {
+		case "local":
+			chain = append(chain, users)
+		case "ldap":
+			if cfg.ldap.url == "" || cfg.ldap.baseDN == "" {
+				return nil, errors.New("the ldap authenticator needs -ldap-url and -ldap-base-dn")
+			}
+			l := &auth.LDAP{
+				URL:          cfg.ldap.url,
+				StartTLS:     cfg.ldap.startTLS,
+				BindDN:       cfg.ldap.bindDN,
+				BindPassword: cfg.ldap.bindPassword,
+				BaseDN:       cfg.ldap.baseDN,
+				UserFilter:   cfg.ldap.userFilter,
+				Users:        users,
+				Identities:   identities,
+				Sessions:     sessions,
+			}
+			if len(cfg.ldap.roleGroups) > 0 {
+				l.RoleGroups = cfg.ldap.roleGroups
+			}
+			chain = append(chain, l)
+		default:
+			return nil, fmt.Errorf("unknown authenticator %q", name)
+		}
+	}
+	return chain, nil
 }
 
 func main() {
 	infoLog := log.New(os.Stdout, "INFO:/t", log.Ldate|log.Ltime)
 	errLog := log.New(os.Stderr, "ERROR:/t", log.Ldate|log.Ltime|log.Lshortfile)
 
-	port, dsn := parseArgs()
+	cfg := parseArgs()
+	if cfg.unverifiedPolicy != "allow" && cfg.unverifiedPolicy != "restrict" {
+		errLog.Fatalf("unknown -unverified-policy %q", cfg.unverifiedPolicy)
+	}
+	if cfg.sessionLifetime <= 0 || cfg.rememberLifetime < cfg.sessionLifetime || cfg.idleTimeout < 0 {
+		errLog.Fatal("-session-lifetime must be positive, -remember-lifetime at least as long and -session-idle-timeout not negative")
+	}
+	hasher, err := password.New(cfg.passwordHash, cfg.bcryptCost)
+	if err != nil {
+		errLog.Fatal(err)
+	}
+
+	var breaches password.RangeSource
+	if cfg.hibpRanges != "" {
+		breaches, err = password.OpenRanges(cfg.hibpRanges)
+		if err != nil {
+			errLog.Fatal(err)
+		}
+	}
+
+	secret := []byte(cfg.secret)
+	if len(secret) == 0 {
+		infoLog.Print("no -secret given, verification links will stop working on restart")
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			errLog.Fatal(err)
+		}
+	}
 
-	db, dErr := openDB(dsn)
+	db, dErr := openDB(cfg.dsn)
 	if dErr != nil {
 		errLog.Fatal(dErr)
 	}
@@ -64,27 +269,96 @@ func main() {
 
 	formDecoder := form.NewDecoder()
 
+	mail, err := newMailer(cfg)
+	if err != nil {
+		errLog.Fatal(err)
+	}
+
+	webAuthn, err := newWebAuthn(cfg.baseURL)
+	if err != nil {
+		errLog.Fatal(err)
+	}
+
+	userModel := &models.UserModel{DB: db, Hasher: hasher}
+	identityModel := &models.IdentityModel{DB: db}
+	sessionModel := &models.SessionModel{DB: db}
+	authenticator, err := newAuthenticator(cfg, userModel, identityModel, sessionModel)
+	if err != nil {
+		errLog.Fatal(err)
+	}
+
+	var oidcProviders []*oidcProvider
+	if cfg.oidcConfig != "" {
+		configs, err := loadOIDCConfig(cfg.oidcConfig)
+		if err != nil {
+			errLog.Fatal(err)
+		}
+		for _, c := range configs {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			provider, err := newOIDCProvider(ctx, c, cfg.baseURL)
+			cancel()
+			if err != nil {
+				errLog.Fatalf("oidc provider %s: %v", c.Name, err)
+			}
+			oidcProviders = append(oidcProviders, provider)
+		}
+	}
+
 	sessionManager := scs.New()
 	sessionManager.Store = mysqlstore.New(db)
-	sessionManager.Lifetime = 12 * time.Hour
+	sessionManager.Lifetime = cfg.sessionLifetime
 	sessionManager.Cookie.Secure = true
+	// cookies only persist when "remember me" is ticked
+	sessionManager.Cookie.Persist = false
+
+	viewModel := &models.ViewModel{DB: db}
+	loginAccounts, loginIPs := newLoginLimiters()
 
 	application := &Application{
-		errLog,
-		infoLog,
-		&models.UserModel{DB: db},
-		&models.SnippetModel{DB: db},
-		templateCache,
-		formDecoder,
-		sessionManager,
+		errorLog:        errLog,
+		infoLog:         infoLog,
+		userModel:       userModel,
+		authenticator:   authenticator,
+		loginAccounts:   loginAccounts,
+		loginIPs:        loginIPs,
+		breaches:        breaches,
+		snippetModel:    &models.SnippetModel{DB: db},
+		commentModel:    &models.CommentModel{DB: db},
+		collectionModel: &models.CollectionModel{DB: db},
+		viewModel:       viewModel,
+		viewCounter:     newViewCounter(viewModel),
+		tokenModel:      &models.TokenModel{DB: db},
+		resetModel:      &models.PasswordResetModel{DB: db},
+		twoFactorModel:  &models.TwoFactorModel{DB: db},
+		passkeyModel:    &models.PasskeyModel{DB: db},
+		sessionModel:    sessionModel,
+		statsModel:      &models.StatsModel{DB: db},
+		auditModel:      &models.AuditModel{DB: db},
+		webAuthn:        webAuthn,
+		identityModel:   identityModel,
+		oidcProviders:   oidcProviders,
+		mailer:          mail,
+		baseURL:         cfg.baseURL,
+		secret:          secret,
+		verifiedOnly:    cfg.unverifiedPolicy == "restrict",
+		templateCache:   templateCache,
+		formDecoder:     formDecoder,
+		sessionManager:  sessionManager,
+		rememberFor:     cfg.rememberLifetime,
+		idleTimeout:     cfg.idleTimeout,
+		trustedProxies:  cfg.trustedProxies,
 	}
 
+	go application.viewCounter.run(viewFlushInterval, errLog)
+	go loginAccounts.Run(10 * time.Minute)
+	go loginIPs.Run(10 * time.Minute)
+
 	tlsConfig := tls.Config{
 		CurvePreferences: []tls.CurveID{tls.X25519, tls.CurveP256},
 	}
 
 	server := &http.Server{
-		Addr:         port,
+		Addr:         cfg.port,
 		ErrorLog:     errLog,
 		Handler:      application.routes(),
 		TLSConfig:    &tlsConfig,
@@ -93,8 +367,31 @@ func main() {
 		WriteTimeout: 5 * time.Second,
 	}
 
-	infoLog.Printf("Starting Server on port: %s", port)
+	shutdownErr := make(chan error)
+	go func() {
+		quit := make(chan os.Signal, 1)
+		signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+		s := <-quit
+
+		infoLog.Printf("Shutting down server: %s", s)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		shutdownErr <- server.Shutdown(ctx)
+	}()
+
+	infoLog.Printf("Starting Server on port: %s", cfg.port)
 
 	err = server.ListenAndServeTLS("./tls/cert.pem", "./tls/key.pem")
-	errLog.Fatal(err)
+	if !errors.Is(err, http.ErrServerClosed) {
+		errLog.Fatal(err)
+	}
+	if err := <-shutdownErr; err != nil {
+		errLog.Print(err)
+	}
+
+	// no more requests are coming, write out the views still buffered
+	if err := application.viewCounter.flush(); err != nil {
+		errLog.Print(err)
+	}
+	infoLog.Print("Server stopped")
 }
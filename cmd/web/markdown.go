@@ -0,0 +1,107 @@
+package main
+
+import (
+	"html/template"
+	"regexp"
+	"strings"
+)
+
+// markdown-lite: paragraphs, line breaks, fenced and inline code, **bold**,
+// *italic* and [text](http links). Everything else is shown as typed.
+var (
+	mdBold   = regexp.MustCompile(`\*\*(\S(?:[^*]*\S)?)\*\*`)
+	mdItalic = regexp.MustCompile(`\*(\S(?:[^*]*\S)?)\*`)
+	mdLink   = regexp.MustCompile(`\[([^\]]+)\]\((https?://[^\s)]+)\)`)
+)
+
+const mdFence = "```"
+
+func markdownLite(s string) template.HTML {
+	var b strings.Builder
+	var para []string
+
+	flush := func() {
+		if len(para) == 0 {
+			return
+		}
+		b.WriteString("<p>")
+		for i, line := range para {
+			if i > 0 {
+				b.WriteString("<br>")
+			}
+			b.WriteString(mdInline(line))
+		}
+		b.WriteString("</p>")
+		para = nil
+	}
+
+	lines := strings.Split(strings.ReplaceAll(s, "\r\n", "\n"), "\n")
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		if strings.HasPrefix(strings.TrimSpace(line), mdFence) {
+			flush()
+			var code []string
+			for i++; i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), mdFence); i++ {
+				code = append(code, lines[i])
+			}
+			b.WriteString("<pre><code>")
+			b.WriteString(template.HTMLEscapeString(strings.Join(code, "\n")))
+			b.WriteString("</code></pre>")
+			continue
+		}
+		if strings.TrimSpace(line) == "" {
+			flush()
+			continue
+		}
+		para = append(para, line)
+	}
+	flush()
+
+	return template.HTML(b.String())
+}
+
+// mdInline formats a single line, text between backticks is escaped but
+// otherwise left alone
+func mdInline(line string) string {
+	var b strings.Builder
+
+	parts := strings.Split(line, "`")
+	for i, part := range parts {
+		if i%2 == 1 {
+			if i < len(parts)-1 {
+				b.WriteString("<code>")
+				b.WriteString(template.HTMLEscapeString(part))
+				b.WriteString("</code>")
+				continue
+			}
+			b.WriteString("`") //unmatched
+		}
+		b.WriteString(mdLinks(template.HTMLEscapeString(part)))
+	}
+	return b.String()
+}
+
+// mdLinks expects already escaped text, emphasis is applied around links and to
+// their text but never to the url itself
+func mdLinks(s string) string {
+	var b strings.Builder
+
+	last := 0
+	for _, m := range mdLink.FindAllStringSubmatchIndex(s, -1) {
+		b.WriteString(mdEmphasis(s[last:m[0]]))
+		b.WriteString(`<a href="`)
+		b.WriteString(s[m[4]:m[5]])
+		b.WriteString(`" rel="nofollow noopener">`)
+		b.WriteString(mdEmphasis(s[m[2]:m[3]]))
+		b.WriteString("</a>")
+		last = m[1]
+	}
+	b.WriteString(mdEmphasis(s[last:]))
+
+	return b.String()
+}
+
+func mdEmphasis(s string) string {
+	s = mdBold.ReplaceAllString(s, "<strong>$1</strong>")
+	return mdItalic.ReplaceAllString(s, "<em>$1</em>")
+}
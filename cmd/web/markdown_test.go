@@ -0,0 +1,61 @@
+package main
+
+import (
+	"snippetbox-n/internal/assert"
+	"testing"
+)
+
+func TestMarkdownLite(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{
+			name:  "Plain",
+			input: "An old silent pond",
+			want:  "<p>An old silent pond</p>",
+		},
+		{
+			name:  "Escapes HTML",
+			input: "<script>alert('hi')</script>",
+			want:  "<p>&lt;script&gt;alert(&#39;hi&#39;)&lt;/script&gt;</p>",
+		},
+		{
+			name:  "Paragraphs and breaks",
+			input: "one\ntwo\n\nthree",
+			want:  "<p>one<br>two</p><p>three</p>",
+		},
+		{
+			name:  "Emphasis",
+			input: "**bold** and *italic*",
+			want:  "<p><strong>bold</strong> and <em>italic</em></p>",
+		},
+		{
+			name:  "Inline code",
+			input: "use `**x** < y` here",
+			want:  "<p>use <code>**x** &lt; y</code> here</p>",
+		},
+		{
+			name:  "Fenced code",
+			input: "look:\n```\nif a < b {\n\n}\n```\ndone",
+			want:  "<p>look:</p><pre><code>if a &lt; b {\n\n}</code></pre><p>done</p>",
+		},
+		{
+			name:  "Link",
+			input: "[the *docs*](https://go.dev/doc?a=1&b=2)",
+			want:  `<p><a href="https://go.dev/doc?a=1&amp;b=2" rel="nofollow noopener">the <em>docs</em></a></p>`,
+		},
+		{
+			name:  "Unsafe link",
+			input: "[click](javascript:alert(1))",
+			want:  "<p>[click](javascript:alert(1))</p>",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, string(markdownLite(tt.input)), tt.want)
+		})
+	}
+}
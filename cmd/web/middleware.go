@@ -2,9 +2,15 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"github.com/justinas/alice"
 	"github.com/justinas/nosurf"
+	"net"
 	"net/http"
+	"net/netip"
+	"snippetbox-n/internal/models"
+	"strings"
 )
 
 func secureHeaders(next http.Handler) http.Handler {
@@ -22,6 +28,48 @@ func secureHeaders(next http.Handler) http.Handler {
 	)
 }
 
+// realIP puts the client's address in RemoteAddr for requests that came
+// through a trusted proxy. Each proxy appends the address it got the request
+// from to X-Forwarded-For, so reading from the right, the first address that
+// isn't a trusted proxy is the client's; anything further left could have been
+// made up by the client.
+func (app *Application) realIP(next http.Handler) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			host, port, err := net.SplitHostPort(r.RemoteAddr)
+			if err == nil && app.trustedProxy(host) {
+				hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+				for i := len(hops) - 1; i >= 0; i-- {
+					hop := strings.TrimSpace(hops[i])
+					if _, err := netip.ParseAddr(hop); err != nil {
+						break
+					}
+					host = hop
+					if !app.trustedProxy(hop) {
+						break
+					}
+				}
+				r.RemoteAddr = net.JoinHostPort(host, port)
+			}
+			next.ServeHTTP(w, r)
+		},
+	)
+}
+
+func (app *Application) trustedProxy(host string) bool {
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range app.trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
 func (app *Application) logRequest(next http.Handler) http.Handler {
 	return http.HandlerFunc(
 		func(w http.ResponseWriter, r *http.Request) {
@@ -58,6 +106,60 @@ func (app *Application) requireAuth(next http.Handler) http.Handler {
 	)
 }
 
+// apiRequireAuth is requireAuth for the JSON API, it answers with a 401 rather
+// than redirecting to the login page
+func (app *Application) apiRequireAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			if !app.isAuthenticated(r) {
+				app.apiError(w, http.StatusUnauthorized, "you must be authenticated to access this resource")
+				return
+			}
+			w.Header().Add("Cache-Control", "no-store")
+			next.ServeHTTP(w, r)
+		},
+	)
+}
+
+// requireVerified keeps users whose email isn't verified yet away from
+// routes the -unverified-policy restricts, sending them to the page that
+// resends the link
+func (app *Application) requireVerified(next http.Handler) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			verified, err := app.emailVerified(r)
+			if err != nil {
+				app.serverError(w, err)
+				return
+			}
+			if !verified {
+				app.sessionManager.Put(r.Context(), "flash", "Please verify your email address before creating snippets")
+				http.Redirect(w, r, "/user/verify", http.StatusSeeOther)
+				return
+			}
+			next.ServeHTTP(w, r)
+		},
+	)
+}
+
+// apiRequireVerified is requireVerified for the JSON API
+func (app *Application) apiRequireVerified(next http.Handler) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			verified, err := app.emailVerified(r)
+			if err != nil {
+				app.apiServerError(w, err)
+				return
+			}
+			if !verified {
+				app.apiError(w, http.StatusForbidden, "verify your email address before creating snippets")
+				return
+			}
+			next.ServeHTTP(w, r)
+		},
+	)
+}
+
 func noSurf(next http.Handler) http.Handler {
 	csrfHandler := nosurf.New(next)
 	csrfHandler.SetBaseCookie(
@@ -79,15 +181,29 @@ func (app *Application) authenticate(next http.Handler) http.Handler {
 				return
 			}
 
-			exists, err := app.userModel.Exists(id)
+			// a session from before the user's last password change is stale
+			version, role, err := app.userModel.SessionState(id)
+			if err != nil && !errors.Is(err, models.ErrNoRecord) {
+				app.serverError(w, err)
+				return
+			}
+
+			if err != nil || version != app.sessionManager.GetInt(r.Context(), "sessionVersion") {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// the session has to still be in the user's list, sessions from
+			// before the list existed are added to it
+			ok, err := app.touchSession(r, id)
 			if err != nil {
 				app.serverError(w, err)
 				return
 			}
 
-			if exists {
-				ctx := context.WithValue(r.Context(), isAuthenticatedContextKey, true)
-				r = r.WithContext(ctx)
+			if ok {
+				user := authenticatedUser{ID: id, Role: role}
+				r = r.WithContext(context.WithValue(r.Context(), authenticatedUserContextKey, user))
 			}
 
 			next.ServeHTTP(w, r)
@@ -95,4 +211,101 @@ func (app *Application) authenticate(next http.Handler) http.Handler {
 	)
 }
 
+// authenticateToken is authenticate for requests carrying an
+// "Authorization: Bearer" API token. Those never load a session or see CSRF
+// checks; anything without a bearer token is handed to the session chain.
+func (app *Application) authenticateToken(next http.Handler) http.Handler {
+	return app.bearerAuth(next, app.sessionManager.LoadAndSave(app.authenticate(next)))
+}
+
+// optionalToken is authenticateToken for routes that never use sessions,
+// requests without a bearer token carry on anonymously
+func (app *Application) optionalToken(next http.Handler) http.Handler {
+	return app.bearerAuth(next, next)
+}
+
+// bearerAuth authenticates bearer token requests before passing them to next,
+// requests without one go to fallback untouched
+func (app *Application) bearerAuth(next, fallback http.Handler) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			plaintext, ok := bearerToken(r)
+			if !ok {
+				fallback.ServeHTTP(w, r)
+				return
+			}
+
+			token, err := app.tokenModel.Authenticate(plaintext)
+			if err != nil {
+				if errors.Is(err, models.ErrInvalidCredentails) {
+					w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+					app.apiError(w, http.StatusUnauthorized, "invalid or revoked API token")
+				} else {
+					app.apiServerError(w, err)
+				}
+				return
+			}
+
+			_, role, err := app.userModel.SessionState(token.UserID)
+			if err != nil {
+				if errors.Is(err, models.ErrNoRecord) {
+					w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+					app.apiError(w, http.StatusUnauthorized, "invalid or revoked API token")
+				} else {
+					app.apiServerError(w, err)
+				}
+				return
+			}
+
+			user := authenticatedUser{ID: token.UserID, Role: role}
+			ctx := context.WithValue(r.Context(), authenticatedUserContextKey, user)
+			ctx = context.WithValue(ctx, tokenScopeContextKey, token.Scope)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		},
+	)
+}
+
+// requireRole keeps routes to users with role or one above it, it follows
+// requireAuth in a chain
+func (app *Application) requireRole(role models.Role) alice.Constructor {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				if !app.hasRole(r, role) {
+					app.clientError(w, http.StatusForbidden)
+					return
+				}
+				next.ServeHTTP(w, r)
+			},
+		)
+	}
+}
+
+// requireScope stops token authenticated requests whose token lacks scope,
+// session authenticated requests can do anything their user can
+func (app *Application) requireScope(scope string) alice.Constructor {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				tokenScope, ok := r.Context().Value(tokenScopeContextKey).(string)
+				if ok && tokenScope != scope && tokenScope != models.ScopeWrite {
+					w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer error="insufficient_scope", scope="%s"`, scope))
+					app.apiError(w, http.StatusForbidden, fmt.Sprintf("this API token needs the %s scope", scope))
+					return
+				}
+				next.ServeHTTP(w, r)
+			},
+		)
+	}
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, found := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
 // adding a random ligature here! --> #[] #()
@@ -1,12 +1,15 @@
 package main
 
 import "bytes"
+import "context"
 import "io"
 import "net/http"
 import "net/http/httptest"
+import "net/netip"
 import "testing"
 
 import "snippetbox-n/internal/assert"
+import "snippetbox-n/internal/models"
 
 func TestSecureHeaders(t *testing.T) {
 	rr := httptest.NewRecorder()
@@ -46,3 +49,152 @@ func TestSecureHeaders(t *testing.T) {
 	bytes.TrimSpace(body)
 	assert.Equal(t, string(body), "OK")
 }
+
+func TestRequireScope(t *testing.T) {
+	app := newTestApplication(t)
+
+	tests := []struct {
+		name       string
+		tokenScope string //empty for a session authenticated request
+		scope      string
+		wantCode   int
+	}{
+		{"Session", "", models.ScopeWrite, http.StatusOK},
+		{"Read token reading", models.ScopeRead, models.ScopeRead, http.StatusOK},
+		{"Read token writing", models.ScopeRead, models.ScopeWrite, http.StatusForbidden},
+		{"Write token reading", models.ScopeWrite, models.ScopeRead, http.StatusOK},
+		{"Write token writing", models.ScopeWrite, models.ScopeWrite, http.StatusOK},
+	}
+
+	next := http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("OK"))
+		},
+	)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			r, err := http.NewRequest(http.MethodGet, "/api/v1/snippets", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.tokenScope != "" {
+				r = r.WithContext(context.WithValue(r.Context(), tokenScopeContextKey, tt.tokenScope))
+			}
+
+			app.requireScope(tt.scope)(next).ServeHTTP(rr, r)
+			assert.Equal(t, rr.Code, tt.wantCode)
+		})
+	}
+}
+
+func TestRequireRole(t *testing.T) {
+	app := newTestApplication(t)
+
+	tests := []struct {
+		name     string
+		user     authenticatedUser //zero for an anonymous request
+		role     models.Role
+		wantCode int
+	}{
+		{"Anonymous", authenticatedUser{}, models.RoleModerator, http.StatusForbidden},
+		{"User", authenticatedUser{ID: 1, Role: models.RoleUser}, models.RoleModerator, http.StatusForbidden},
+		{"Moderator", authenticatedUser{ID: 1, Role: models.RoleModerator}, models.RoleModerator, http.StatusOK},
+		{"Admin as moderator", authenticatedUser{ID: 1, Role: models.RoleAdmin}, models.RoleModerator, http.StatusOK},
+		{"Moderator as admin", authenticatedUser{ID: 1, Role: models.RoleModerator}, models.RoleAdmin, http.StatusForbidden},
+	}
+
+	next := http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("OK"))
+		},
+	)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			r, err := http.NewRequest(http.MethodGet, "/admin", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.user.ID != 0 {
+				r = r.WithContext(context.WithValue(r.Context(), authenticatedUserContextKey, tt.user))
+			}
+
+			app.requireRole(tt.role)(next).ServeHTTP(rr, r)
+			assert.Equal(t, rr.Code, tt.wantCode)
+		})
+	}
+}
+
+func TestBearerToken(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		want   string
+		wantOK bool
+	}{
+		{"Missing", "", "", false},
+		{"Bearer", "Bearer sb_abc", "sb_abc", true},
+		{"Lower case", "bearer sb_abc", "sb_abc", true},
+		{"Basic", "Basic dXNlcjpwYXNz", "", false},
+		{"Empty", "Bearer ", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := http.NewRequest(http.MethodGet, "/", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r.Header.Set("Authorization", tt.header)
+
+			token, ok := bearerToken(r)
+			assert.Equal(t, token, tt.want)
+			assert.Equal(t, ok, tt.wantOK)
+		})
+	}
+}
+
+func TestRealIP(t *testing.T) {
+	app := &Application{trustedProxies: []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("2001:db8::/32"),
+	}}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  []string
+		want       string
+	}{
+		{"No proxy", "203.0.113.7:5000", nil, "203.0.113.7"},
+		{"Untrusted peer", "203.0.113.7:5000", []string{"198.51.100.1"}, "203.0.113.7"},
+		{"Trusted proxy", "10.0.0.2:5000", []string{"198.51.100.1"}, "198.51.100.1"},
+		{"Spoofed hop", "10.0.0.2:5000", []string{"192.0.2.66, 198.51.100.1"}, "198.51.100.1"},
+		{"Chain of proxies", "10.0.0.2:5000", []string{"198.51.100.1, 10.0.0.3"}, "198.51.100.1"},
+		{"Repeated header", "10.0.0.2:5000", []string{"198.51.100.1", "10.0.0.3"}, "198.51.100.1"},
+		{"IPv6 proxy", "[2001:db8::1]:5000", []string{"198.51.100.1"}, "198.51.100.1"},
+		{"Garbage", "10.0.0.2:5000", []string{"198.51.100.1, unknown"}, "10.0.0.2"},
+		{"No header", "10.0.0.2:5000", nil, "10.0.0.2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for _, v := range tt.forwarded {
+				r.Header.Add("X-Forwarded-For", v)
+			}
+
+			var got string
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = clientIP(r)
+			})
+			app.realIP(next).ServeHTTP(httptest.NewRecorder(), r)
+
+			assert.Equal(t, got, tt.want)
+		})
+	}
+}
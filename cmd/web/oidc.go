@@ -0,0 +1,349 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"snippetbox-n/internal/models"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/julienschmidt/httprouter"
+	"golang.org/x/oauth2"
+)
+
+// Single sign-on uses the OpenID Connect authorization code flow with PKCE.
+// The state, nonce and code verifier of a login in progress are kept in the
+// session between the redirect to the provider and its redirect back.
+
+// oidcLoginTimeout is how long someone has at the provider before the login
+// in progress is forgotten
+const oidcLoginTimeout = 10 * time.Minute
+
+var oidcNameRX = regexp.MustCompile(`^[a-z0-9-]+$`)
+
+// oidcConfig is one provider in the file named by -oidc-config, which holds a
+// JSON array of them
+type oidcConfig struct {
+	Name         string   `json:"name"` //used in URLs and to link accounts, don't change it
+	DisplayName  string   `json:"display_name"`
+	Issuer       string   `json:"issuer"`
+	ClientID     string   `json:"client_id"`
+	ClientSecret string   `json:"client_secret"`
+	Scopes       []string `json:"scopes"` //on top of openid, email and profile
+	AllowSignup  bool     `json:"allow_signup"`
+}
+
+func loadOIDCConfig(path string) ([]oidcConfig, error) {
+	js, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var configs []oidcConfig
+	if err := json.Unmarshal(js, &configs); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	seen := map[string]bool{}
+	for _, c := range configs {
+		switch {
+		case !oidcNameRX.MatchString(c.Name):
+			return nil, fmt.Errorf("%s: provider name %q must be lower case letters, digits and dashes", path, c.Name)
+		case seen[c.Name]:
+			return nil, fmt.Errorf("%s: provider %q is listed twice", path, c.Name)
+		case c.Issuer == "" || c.ClientID == "":
+			return nil, fmt.Errorf("%s: provider %q needs an issuer and a client_id", path, c.Name)
+		}
+		seen[c.Name] = true
+	}
+	return configs, nil
+}
+
+// oidcProvider is a configured identity provider, Name and DisplayName are
+// used by the login page
+type oidcProvider struct {
+	Name        string
+	DisplayName string
+	allowSignup bool
+	oauth2      oauth2.Config
+	verifier    *oidc.IDTokenVerifier
+}
+
+// newOIDCProvider fetches the provider's discovery document, which names its
+// endpoints and the keys ID tokens are signed with
+func newOIDCProvider(ctx context.Context, cfg oidcConfig, baseURL string) (*oidcProvider, error) {
+	provider, err := oidc.NewProvider(ctx, cfg.Issuer)
+	if err != nil {
+		return nil, err
+	}
+
+	displayName := cfg.DisplayName
+	if displayName == "" {
+		displayName = cfg.Name
+	}
+
+	return &oidcProvider{
+		Name:        cfg.Name,
+		DisplayName: displayName,
+		allowSignup: cfg.AllowSignup,
+		oauth2: oauth2.Config{
+			ClientID:     cfg.ClientID,
+			ClientSecret: cfg.ClientSecret,
+			Endpoint:     provider.Endpoint(),
+			RedirectURL:  baseURL + "/user/login/oidc/" + cfg.Name + "/callback",
+			Scopes:       append([]string{oidc.ScopeOpenID, "email", "profile"}, cfg.Scopes...),
+		},
+		verifier: provider.Verifier(&oidc.Config{ClientID: cfg.ClientID}),
+	}, nil
+}
+
+// authURL is where the user is sent to log in at the provider
+func (p *oidcProvider) authURL(state, nonce, verifier string) string {
+	return p.oauth2.AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier))
+}
+
+type oidcClaims struct {
+	Subject       string `json:"sub"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	Name          string `json:"name"`
+}
+
+// exchange trades the code the provider redirected back with for an ID token,
+// and checks it was issued by the provider, for us, for this login
+func (p *oidcProvider) exchange(ctx context.Context, code, verifier, nonce string) (oidcClaims, error) {
+	var claims oidcClaims
+
+	token, err := p.oauth2.Exchange(ctx, code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		return claims, err
+	}
+	raw, ok := token.Extra("id_token").(string)
+	if !ok {
+		return claims, errors.New("oidc: token response has no id_token")
+	}
+
+	idToken, err := p.verifier.Verify(ctx, raw)
+	if err != nil {
+		return claims, err
+	}
+	if subtle.ConstantTimeCompare([]byte(idToken.Nonce), []byte(nonce)) != 1 {
+		return claims, errors.New("oidc: id_token nonce doesn't match")
+	}
+
+	if err := idToken.Claims(&claims); err != nil {
+		return claims, err
+	}
+	claims.Subject = idToken.Subject
+	return claims, nil
+}
+
+// oidcLogin is a login in progress, kept in the session
+type oidcLogin struct {
+	Provider string `json:"provider"`
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+	Started  int64  `json:"started"`
+	Remember bool   `json:"remember"` //"remember me" was ticked on the login page
+}
+
+func (app *Application) oidcProvider(name string) *oidcProvider {
+	for _, p := range app.oidcProviders {
+		if p.Name == name {
+			return p
+		}
+	}
+	return nil
+}
+
+// oidcStart sends the user to the provider. remember=true in the query carries
+// the login page's "remember me" box through to the callback.
+func (app *Application) oidcStart(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+	provider := app.oidcProvider(params.ByName("provider"))
+	if provider == nil {
+		app.notFound(w)
+		return
+	}
+
+	login := oidcLogin{
+		Provider: provider.Name,
+		Verifier: oauth2.GenerateVerifier(),
+		Started:  time.Now().Unix(),
+		Remember: r.URL.Query().Get("remember") == "true",
+	}
+	var err error
+	if login.State, err = randomString(); err != nil {
+		app.serverError(w, err)
+		return
+	}
+	if login.Nonce, err = randomString(); err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	js, err := json.Marshal(login)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	app.sessionManager.Put(r.Context(), "oidcLogin", string(js))
+
+	http.Redirect(w, r, provider.authURL(login.State, login.Nonce, login.Verifier), http.StatusSeeOther)
+}
+
+func (app *Application) oidcCallback(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+	provider := app.oidcProvider(params.ByName("provider"))
+	if provider == nil {
+		app.notFound(w)
+		return
+	}
+
+	// each login can only come back once
+	var login oidcLogin
+	js := app.sessionManager.PopString(r.Context(), "oidcLogin")
+	if js == "" || json.Unmarshal([]byte(js), &login) != nil {
+		app.oidcFailed(w, r, "Your login didn't complete, please try again")
+		return
+	}
+
+	query := r.URL.Query()
+	state := query.Get("state")
+	switch {
+	case login.Provider != provider.Name || subtle.ConstantTimeCompare([]byte(login.State), []byte(state)) != 1:
+		app.oidcFailed(w, r, "Your login didn't complete, please try again")
+		return
+	case time.Since(time.Unix(login.Started, 0)) > oidcLoginTimeout:
+		app.oidcFailed(w, r, "Your login timed out, please try again")
+		return
+	case query.Get("error") != "" || query.Get("code") == "":
+		app.oidcFailed(w, r, fmt.Sprintf("%s didn't log you in", provider.DisplayName))
+		return
+	}
+
+	claims, err := provider.exchange(r.Context(), query.Get("code"), login.Verifier, login.Nonce)
+	if err != nil {
+		app.errorLog.Printf("oidc %s: %v", provider.Name, err)
+		app.oidcFailed(w, r, fmt.Sprintf("%s didn't log you in", provider.DisplayName))
+		return
+	}
+
+	id, err := app.oidcUser(provider, claims)
+	if err != nil {
+		var refused oidcRefused
+		if errors.As(err, &refused) {
+			app.oidcFailed(w, r, string(refused))
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	user, err := app.userModel.Get(id)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	if user.Disabled {
+		app.oidcFailed(w, r, "Your account has been disabled")
+		return
+	}
+
+	if user.TwoFactor {
+		err = app.startTwoFactor(r, id, login.Remember)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+		http.Redirect(w, r, "/user/login/2fa", http.StatusSeeOther)
+		return
+	}
+
+	err = app.logIn(r, id, login.Remember)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	http.Redirect(w, r, "/snippet/create", http.StatusSeeOther)
+}
+
+// oidcRefused is a login the provider vouched for that we still turn away,
+// the message is shown to the user
+type oidcRefused string
+
+func (e oidcRefused) Error() string {
+	return string(e)
+}
+
+// oidcUser finds the user an ID token is for. Accounts already linked to the
+// provider are found by subject. Otherwise the token's email has to be
+// verified by the provider, and is used to link an existing user or, when the
+// provider allows signups, to create one.
+func (app *Application) oidcUser(provider *oidcProvider, claims oidcClaims) (int, error) {
+	id, err := app.identityModel.Get(provider.Name, claims.Subject)
+	if err == nil || !errors.Is(err, models.ErrNoRecord) {
+		return id, err
+	}
+
+	if claims.Email == "" || !claims.EmailVerified {
+		return 0, oidcRefused(fmt.Sprintf("Your %s account has no verified email address", provider.DisplayName))
+	}
+
+	user, err := app.userModel.GetByEmail(claims.Email)
+	if err == nil {
+		// anyone can sign up with an address they don't own, only link
+		// accounts whose owner has proved it's theirs
+		if !user.EmailVerified {
+			return 0, oidcRefused("Log in with your password and verify your email address before using " + provider.DisplayName)
+		}
+		err = app.identityModel.Link(user.ID, provider.Name, claims.Subject)
+		if err != nil {
+			return 0, err
+		}
+		// whoever holds the provider account takes this one over, so nobody
+		// else stays logged in to it
+		err = app.userModel.BumpSessionVersion(user.ID)
+		if err != nil {
+			return 0, err
+		}
+		return user.ID, app.sessionModel.DeleteOthers(user.ID, 0)
+	}
+	if !errors.Is(err, models.ErrNoRecord) {
+		return 0, err
+	}
+
+	if !provider.allowSignup {
+		return 0, oidcRefused(fmt.Sprintf("No account uses %s, please sign up first", claims.Email))
+	}
+
+	name := strings.TrimSpace(claims.Name)
+	if name == "" {
+		name, _, _ = strings.Cut(claims.Email, "@")
+	}
+	return app.identityModel.Provision(provider.Name, claims.Subject, name, claims.Email)
+}
+
+func (app *Application) oidcFailed(w http.ResponseWriter, r *http.Request, msg string) {
+	app.sessionManager.Put(r.Context(), "flash", msg)
+	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+}
+
+func randomString() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,368 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"snippetbox-n/internal/assert"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// mockIssuer is an OpenID Connect provider with just enough of one to log in
+// against: a discovery document, its signing key and a token endpoint
+type mockIssuer struct {
+	t      *testing.T
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	mu     sync.Mutex
+	grants map[string]mockGrant
+}
+
+// mockGrant is what the issuer remembers about a code it handed out
+type mockGrant struct {
+	challenge string
+	claims    map[string]any
+}
+
+func newMockIssuer(t *testing.T) *mockIssuer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &mockIssuer{t: t, key: key, grants: map[string]mockGrant{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", m.discovery)
+	mux.HandleFunc("/keys", m.keys)
+	mux.HandleFunc("/token", m.token)
+	m.server = httptest.NewServer(mux)
+	t.Cleanup(m.server.Close)
+	return m
+}
+
+func (m *mockIssuer) discovery(w http.ResponseWriter, r *http.Request) {
+	issuer := m.server.URL
+	json.NewEncoder(w).Encode(map[string]any{
+		"issuer":                                issuer,
+		"authorization_endpoint":                issuer + "/authorize",
+		"token_endpoint":                        issuer + "/token",
+		"jwks_uri":                              issuer + "/keys",
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+	})
+}
+
+func (m *mockIssuer) keys(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(map[string]any{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"alg": "RS256",
+			"use": "sig",
+			"kid": "test",
+			"n":   b64url(m.key.N.Bytes()),
+			"e":   b64url(big.NewInt(int64(m.key.E)).Bytes()),
+		}},
+	})
+}
+
+// token redeems a code once, checking the PKCE verifier against the challenge
+// it was issued for
+func (m *mockIssuer) token(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	m.mu.Lock()
+	grant, ok := m.grants[r.PostForm.Get("code")]
+	delete(m.grants, r.PostForm.Get("code"))
+	m.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !ok || b64url(sum[:]) != grant.challenge {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error":"invalid_grant"}`))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"access_token": "access",
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     m.sign(m.key, grant.claims),
+	})
+}
+
+func (m *mockIssuer) sign(key *rsa.PrivateKey, claims map[string]any) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "test", "typ": "JWT"})
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		m.t.Fatal(err)
+	}
+
+	signed := b64url(header) + "." + b64url(payload)
+	digest := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		m.t.Fatal(err)
+	}
+	return signed + "." + b64url(sig)
+}
+
+// authorize stands in for the user logging in at the issuer: it reads the
+// login request out of authURL and returns the code the issuer would redirect
+// back with. edit can change the ID token's claims from the usual ones.
+func (m *mockIssuer) authorize(authURL string, edit func(claims map[string]any)) string {
+	u, err := url.Parse(authURL)
+	if err != nil {
+		m.t.Fatal(err)
+	}
+	query := u.Query()
+	assert.Equal(m.t, query.Get("code_challenge_method"), "S256")
+
+	now := time.Now()
+	claims := map[string]any{
+		"iss":            m.server.URL,
+		"sub":            "user-1",
+		"aud":            query.Get("client_id"),
+		"exp":            now.Add(time.Hour).Unix(),
+		"iat":            now.Unix(),
+		"nonce":          query.Get("nonce"),
+		"email":          "alice@example.com",
+		"email_verified": true,
+		"name":           "Alice",
+	}
+	if edit != nil {
+		edit(claims)
+	}
+
+	code, err := randomString()
+	if err != nil {
+		m.t.Fatal(err)
+	}
+	m.mu.Lock()
+	m.grants[code] = mockGrant{challenge: query.Get("code_challenge"), claims: claims}
+	m.mu.Unlock()
+	return code
+}
+
+func TestOIDCExchange(t *testing.T) {
+	issuer := newMockIssuer(t)
+	provider, err := newOIDCProvider(context.Background(), oidcConfig{
+		Name:     "mock",
+		Issuer:   issuer.server.URL,
+		ClientID: "snippetbox",
+	}, "https://localhost:4000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, provider.oauth2.RedirectURL, "https://localhost:4000/user/login/oidc/mock/callback")
+
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name         string
+		edit         func(claims map[string]any)
+		verifier     string
+		nonce        string
+		wantErr      bool
+		wantVerified bool
+	}{
+		{
+			name:         "Valid",
+			wantVerified: true,
+		},
+		{
+			name:     "Wrong verifier",
+			verifier: "not-the-verifier-that-was-challenged-for-this-login",
+			wantErr:  true,
+		},
+		{
+			name:    "Wrong nonce",
+			nonce:   "another-login",
+			wantErr: true,
+		},
+		{
+			name:    "Other audience",
+			edit:    func(claims map[string]any) { claims["aud"] = "another-client" },
+			wantErr: true,
+		},
+		{
+			name:    "Other issuer",
+			edit:    func(claims map[string]any) { claims["iss"] = "https://issuer.example.net" },
+			wantErr: true,
+		},
+		{
+			name:    "Expired",
+			edit:    func(claims map[string]any) { claims["exp"] = time.Now().Add(-time.Hour).Unix() },
+			wantErr: true,
+		},
+		{
+			name: "Unverified email",
+			edit: func(claims map[string]any) { claims["email_verified"] = false },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state, _ := randomString()
+			nonce, _ := randomString()
+			verifier := "a-verifier-long-enough-for-pkce-which-wants-43-characters"
+
+			code := issuer.authorize(provider.authURL(state, nonce, verifier), tt.edit)
+			if tt.verifier != "" {
+				verifier = tt.verifier
+			}
+			if tt.nonce != "" {
+				nonce = tt.nonce
+			}
+
+			claims, err := provider.exchange(context.Background(), code, verifier, nonce)
+			assert.Equal(t, err != nil, tt.wantErr)
+			if err == nil {
+				assert.Equal(t, claims.Subject, "user-1")
+				assert.Equal(t, claims.Email, "alice@example.com")
+				assert.Equal(t, claims.EmailVerified, tt.wantVerified)
+			}
+		})
+	}
+
+	t.Run("Other key", func(t *testing.T) {
+		nonce, _ := randomString()
+		verifier := "a-verifier-long-enough-for-pkce-which-wants-43-characters"
+		code := issuer.authorize(provider.authURL("state", nonce, verifier), nil)
+
+		// swap in an ID token signed by a key the issuer doesn't publish
+		issuer.mu.Lock()
+		grant := issuer.grants[code]
+		issuer.mu.Unlock()
+		forged := issuer.sign(otherKey, grant.claims)
+		_, err := provider.verifier.Verify(context.Background(), forged)
+		assert.Equal(t, err != nil, true)
+	})
+}
+
+func TestLoadOIDCConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		wantErr bool
+	}{
+		{"Valid", `[{"name": "corp-sso", "issuer": "https://sso.example.com", "client_id": "id", "allow_signup": true}]`, false},
+		{"Bad name", `[{"name": "Corp SSO", "issuer": "https://sso.example.com", "client_id": "id"}]`, true},
+		{"Duplicate", `[{"name": "a", "issuer": "https://a.example.com", "client_id": "id"}, {"name": "a", "issuer": "https://b.example.com", "client_id": "id"}]`, true},
+		{"No issuer", `[{"name": "a", "client_id": "id"}]`, true},
+		{"Not JSON", `name = a`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "oidc.json")
+			if err := os.WriteFile(path, []byte(tt.config), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			configs, err := loadOIDCConfig(path)
+			assert.Equal(t, err != nil, tt.wantErr)
+			if err == nil {
+				assert.Equal(t, len(configs), 1)
+				assert.Equal(t, configs[0].AllowSignup, true)
+			}
+		})
+	}
+}
+
+func TestOIDCUser(t *testing.T) {
+	app, _ := newTestApplicationDB(t)
+	provider := &oidcProvider{Name: "mock", DisplayName: "Mock", allowSignup: true}
+
+	verified := insertUser(t, app, "Alice", "alice@example.com", "pa$$word1234")
+	_, err := app.userModel.Insert("Bob", "bob@example.com", "pa$$word1234")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id, err := app.oidcUser(provider, oidcClaims{Subject: "alice", Email: "alice@example.com", EmailVerified: true})
+	assert.Equal(t, err, nil)
+	assert.Equal(t, id, verified)
+
+	// Bob never proved the address is his
+	_, err = app.oidcUser(provider, oidcClaims{Subject: "bob", Email: "bob@example.com", EmailVerified: true})
+	var refused oidcRefused
+	assert.Equal(t, errors.As(err, &refused), true)
+
+	id, err = app.oidcUser(provider, oidcClaims{Subject: "carol", Email: "carol@example.com", EmailVerified: true, Name: strings.Repeat("é", 300)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, err := app.userModel.Get(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, user.Name, strings.Repeat("é", 255))
+	assert.Equal(t, user.EmailVerified, true)
+}
+
+func TestOIDCLoginRememberMe(t *testing.T) {
+	app, _ := newTestApplicationDB(t)
+	insertUser(t, app, "Alice", "alice@example.com", "pa$$word1234")
+
+	issuer := newMockIssuer(t)
+	provider, err := newOIDCProvider(context.Background(), oidcConfig{
+		Name:     "mock",
+		Issuer:   issuer.server.URL,
+		ClientID: "snippetbox",
+	}, app.baseURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.oidcProviders = []*oidcProvider{provider}
+
+	tests := []struct {
+		name        string
+		query       string
+		wantPersist bool
+	}{
+		{"Ticked", "?remember=true", true},
+		{"Not ticked", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestServer(t, app.routes())
+			defer ts.Close()
+
+			code, header, _ := ts.get(t, "/user/login/oidc/mock"+tt.query)
+			assert.Equal(t, code, http.StatusSeeOther)
+
+			authURL := header.Get("Location")
+			u, err := url.Parse(authURL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			callback := url.Values{
+				"state": {u.Query().Get("state")},
+				"code":  {issuer.authorize(authURL, nil)},
+			}
+
+			code, header, _ = ts.get(t, "/user/login/oidc/mock/callback?"+callback.Encode())
+			assert.Equal(t, code, http.StatusSeeOther)
+			assert.Equal(t, header.Get("Location"), "/snippet/create")
+			assert.Equal(t, !sessionCookie(t, header).Expires.IsZero(), tt.wantPersist)
+		})
+	}
+}
@@ -0,0 +1,360 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"snippetbox-n/internal/models"
+	"snippetbox-n/internal/validator"
+	"strconv"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/julienschmidt/httprouter"
+)
+
+// The passkey ceremonies are driven by ui/static/js/main.js: a "begin" request
+// returns options for navigator.credentials, whose result is posted to the
+// matching "finish" endpoint. The challenge in between is kept in the session.
+// Both sit behind noSurf, the script sends the token in an X-CSRF-Token header.
+
+const maxPasskeyBytes = 64 << 10
+
+var errNoPasskeyCeremony = errors.New("no passkey request in progress")
+
+// webauthnUser is a user as the WebAuthn library sees them
+type webauthnUser struct {
+	user        models.User
+	credentials []webauthn.Credential
+}
+
+func (u *webauthnUser) WebAuthnID() []byte {
+	return userHandle(u.user.ID)
+}
+
+func (u *webauthnUser) WebAuthnName() string {
+	return u.user.Email
+}
+
+func (u *webauthnUser) WebAuthnDisplayName() string {
+	return u.user.Name
+}
+
+func (u *webauthnUser) WebAuthnIcon() string {
+	return ""
+}
+
+func (u *webauthnUser) WebAuthnCredentials() []webauthn.Credential {
+	return u.credentials
+}
+
+// userHandle is the opaque id authenticators keep for a user, and hand back
+// during a passkey login so we know whose credential it is
+func userHandle(id int) []byte {
+	return binary.BigEndian.AppendUint64(nil, uint64(id))
+}
+
+func handleUserID(handle []byte) (int, bool) {
+	if len(handle) != 8 {
+		return 0, false
+	}
+	id := int(binary.BigEndian.Uint64(handle))
+	return id, id > 0
+}
+
+// newWebAuthn configures WebAuthn for the site at baseURL, credentials are
+// bound to its host name. Both ceremonies require user verification, a PIN or
+// biometric, as a passkey login stands in for the password and the second
+// factor.
+func newWebAuthn(baseURL string) (*webauthn.WebAuthn, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, err
+	}
+	return webauthn.New(&webauthn.Config{
+		RPID:          u.Hostname(),
+		RPDisplayName: "Snippetbox",
+		RPOrigins:     []string{u.Scheme + "://" + u.Host},
+		AuthenticatorSelection: protocol.AuthenticatorSelection{
+			UserVerification: protocol.VerificationRequired,
+		},
+	})
+}
+
+func (app *Application) loadWebauthnUser(id int) (*webauthnUser, error) {
+	user, err := app.userModel.Get(id)
+	if err != nil {
+		return nil, err
+	}
+
+	passkeys, err := app.passkeyModel.ForUser(id)
+	if err != nil {
+		return nil, err
+	}
+
+	wu := &webauthnUser{user: user}
+	for _, p := range passkeys {
+		var c webauthn.Credential
+		if err := json.Unmarshal(p.Data, &c); err != nil {
+			return nil, err
+		}
+		wu.credentials = append(wu.credentials, c)
+	}
+	return wu, nil
+}
+
+// finishPasskeyRegistration checks an authenticator's response to the
+// registration options in session
+func finishPasskeyRegistration(wa *webauthn.WebAuthn, user webauthn.User, session webauthn.SessionData, body io.Reader) (*webauthn.Credential, error) {
+	parsed, err := protocol.ParseCredentialCreationResponseBody(body)
+	if err != nil {
+		return nil, err
+	}
+	return wa.CreateCredential(user, session, parsed)
+}
+
+// finishPasskeyLogin checks an authenticator's response to the login options in
+// session, returning whose credential signed it. lookup loads the user named by
+// the response's user handle.
+func finishPasskeyLogin(wa *webauthn.WebAuthn, session webauthn.SessionData, body io.Reader, lookup func(id int) (webauthn.User, error)) (int, *webauthn.Credential, error) {
+	parsed, err := protocol.ParseCredentialRequestResponseBody(body)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	id, ok := handleUserID(parsed.Response.UserHandle)
+	if !ok {
+		return 0, nil, protocol.ErrBadRequest.WithDetails("unknown user handle")
+	}
+
+	credential, err := wa.ValidateDiscoverableLogin(
+		func(rawID, userHandle []byte) (webauthn.User, error) {
+			return lookup(id)
+		},
+		session, parsed)
+	if err != nil {
+		return 0, nil, err
+	}
+	// a counter going backwards means the credential's key has been copied
+	if credential.Authenticator.CloneWarning {
+		return 0, nil, protocol.ErrBadRequest.WithDetails("signature counter went backwards")
+	}
+	return id, credential, nil
+}
+
+func (app *Application) putCeremony(r *http.Request, key string, session *webauthn.SessionData) error {
+	js, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+	app.sessionManager.Put(r.Context(), key, string(js))
+	return nil
+}
+
+// popCeremony takes the ceremony state out of the session, each challenge can
+// only be answered once
+func (app *Application) popCeremony(r *http.Request, key string) (webauthn.SessionData, error) {
+	var session webauthn.SessionData
+	js := app.sessionManager.PopString(r.Context(), key)
+	if js == "" {
+		return session, errNoPasskeyCeremony
+	}
+	err := json.Unmarshal([]byte(js), &session)
+	return session, err
+}
+
+func (app *Application) passkeyList(w http.ResponseWriter, r *http.Request) {
+	passkeys, err := app.passkeyModel.ForUser(app.authenticatedUserID(r))
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Passkeys = passkeys
+	app.render(w, http.StatusOK, "passkeys.tmpl.html", &data)
+}
+
+func (app *Application) passkeyRegisterBegin(w http.ResponseWriter, r *http.Request) {
+	user, err := app.loadWebauthnUser(app.authenticatedUserID(r))
+	if err != nil {
+		app.apiServerError(w, err)
+		return
+	}
+
+	exclude := make([]protocol.CredentialDescriptor, 0, len(user.credentials))
+	for _, c := range user.credentials {
+		exclude = append(exclude, c.Descriptor())
+	}
+
+	creation, session, err := app.webAuthn.BeginRegistration(user,
+		webauthn.WithExclusions(exclude),
+		webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementRequired))
+	if err != nil {
+		app.apiServerError(w, err)
+		return
+	}
+
+	err = app.putCeremony(r, "passkeyRegistration", session)
+	if err != nil {
+		app.apiServerError(w, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"publicKey": creation.Response})
+}
+
+func (app *Application) passkeyRegisterFinish(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("name")
+	if name == "" {
+		name = "Passkey"
+	}
+	var v validator.Validator
+	v.CheckField(validator.MaxChars(name, 100), "name", "This field cannot be more than 100 characters long")
+	if !v.Valid() {
+		app.apiValidationError(w, v)
+		return
+	}
+
+	session, err := app.popCeremony(r, "passkeyRegistration")
+	if err != nil {
+		app.apiError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	id := app.authenticatedUserID(r)
+	user, err := app.loadWebauthnUser(id)
+	if err != nil {
+		app.apiServerError(w, err)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxPasskeyBytes)
+	credential, err := finishPasskeyRegistration(app.webAuthn, user, session, r.Body)
+	if err != nil {
+		app.apiError(w, http.StatusBadRequest, "the passkey could not be verified")
+		return
+	}
+
+	js, err := json.Marshal(credential)
+	if err != nil {
+		app.apiServerError(w, err)
+		return
+	}
+
+	_, err = app.passkeyModel.Insert(id, credential.ID, name, js)
+	if err != nil {
+		if errors.Is(err, models.ErrDuplicatePasskey) {
+			app.apiError(w, http.StatusConflict, "that passkey is already registered")
+		} else {
+			app.apiServerError(w, err)
+		}
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Passkey added")
+	app.writeJSON(w, http.StatusCreated, envelope{"redirect": "/account/passkeys"})
+}
+
+func (app *Application) passkeyDeletePost(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil || id < 1 {
+		app.notFound(w)
+		return
+	}
+
+	err = app.passkeyModel.Delete(app.authenticatedUserID(r), id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Passkey removed")
+	http.Redirect(w, r, "/account/passkeys", http.StatusSeeOther)
+}
+
+// passkeyLoginBegin takes the login page's "remember me" box as
+// {"remember": true}, a missing body leaves it unticked
+func (app *Application) passkeyLoginBegin(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Remember bool `json:"remember"`
+	}
+	if r.ContentLength != 0 {
+		err := app.readJSON(w, r, &input)
+		if err != nil {
+			app.apiError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	assertion, session, err := app.webAuthn.BeginDiscoverableLogin()
+	if err != nil {
+		app.apiServerError(w, err)
+		return
+	}
+
+	err = app.putCeremony(r, "passkeyLogin", session)
+	if err != nil {
+		app.apiServerError(w, err)
+		return
+	}
+	app.sessionManager.Put(r.Context(), "passkeyRemember", input.Remember)
+
+	app.writeJSON(w, http.StatusOK, envelope{"publicKey": assertion.Response})
+}
+
+// passkeyLoginFinish logs the user in without asking for a TOTP code, a
+// passkey is already something they have plus the PIN or biometric that user
+// verification requires
+func (app *Application) passkeyLoginFinish(w http.ResponseWriter, r *http.Request) {
+	remember := app.sessionManager.PopBool(r.Context(), "passkeyRemember")
+	session, err := app.popCeremony(r, "passkeyLogin")
+	if err != nil {
+		app.apiError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxPasskeyBytes)
+	id, credential, err := finishPasskeyLogin(app.webAuthn, session, r.Body,
+		func(id int) (webauthn.User, error) {
+			user, err := app.loadWebauthnUser(id)
+			if err != nil {
+				return nil, err
+			}
+			if user.user.Disabled {
+				return nil, models.ErrNoRecord
+			}
+			return user, nil
+		})
+	if err != nil {
+		app.apiError(w, http.StatusUnauthorized, "the passkey could not be verified")
+		return
+	}
+
+	js, err := json.Marshal(credential)
+	if err != nil {
+		app.apiServerError(w, err)
+		return
+	}
+	err = app.passkeyModel.Used(credential.ID, js)
+	if err != nil {
+		app.apiServerError(w, err)
+		return
+	}
+
+	err = app.logIn(r, id, remember)
+	if err != nil {
+		app.apiServerError(w, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"redirect": "/snippet/create"})
+}
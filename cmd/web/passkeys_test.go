@@ -0,0 +1,335 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net/http"
+	"snippetbox-n/internal/assert"
+	"snippetbox-n/internal/models"
+	"strings"
+	"testing"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+// softAuthenticator is a passkey held in memory, answering WebAuthn requests
+// the way a browser passes on a real authenticator's answers
+type softAuthenticator struct {
+	t          *testing.T
+	key        *ecdsa.PrivateKey
+	id         []byte
+	rpID       string
+	origin     string
+	userHandle []byte
+	counter    uint32
+	unverified bool //answers without the PIN or biometric check
+}
+
+func newSoftAuthenticator(t *testing.T, rpID, origin string) *softAuthenticator {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := make([]byte, 16)
+	rand.Read(id)
+	return &softAuthenticator{t: t, key: key, id: id, rpID: rpID, origin: origin}
+}
+
+func (a *softAuthenticator) clientData(typ string, challenge protocol.URLEncodedBase64) []byte {
+	js, err := json.Marshal(map[string]string{
+		"type":      typ,
+		"challenge": challenge.String(),
+		"origin":    a.origin,
+	})
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	return js
+}
+
+// authData builds authenticator data with the user present and, unless
+// unverified, verified flags set, plus the attested credential when registering
+func (a *softAuthenticator) authData(attested []byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(a.rpID))
+	flags := byte(0x01 | 0x04)
+	if a.unverified {
+		flags = 0x01
+	}
+	if attested != nil {
+		flags |= 0x40
+	}
+
+	data := append(rpIDHash[:], flags)
+	data = binary.BigEndian.AppendUint32(data, a.counter)
+	return append(data, attested...)
+}
+
+func (a *softAuthenticator) create(options protocol.PublicKeyCredentialCreationOptions) io.Reader {
+	a.userHandle = options.User.ID.(protocol.URLEncodedBase64)
+
+	coseKey, err := cbor.Marshal(map[int]any{
+		1:  2,  //kty: EC2
+		3:  -7, //alg: ES256
+		-1: 1,  //crv: P-256
+		-2: a.key.X.FillBytes(make([]byte, 32)),
+		-3: a.key.Y.FillBytes(make([]byte, 32)),
+	})
+	if err != nil {
+		a.t.Fatal(err)
+	}
+
+	attested := make([]byte, 16) //zero AAGUID
+	attested = binary.BigEndian.AppendUint16(attested, uint16(len(a.id)))
+	attested = append(attested, a.id...)
+	attested = append(attested, coseKey...)
+
+	attestation, err := cbor.Marshal(map[string]any{
+		"fmt":      "none",
+		"attStmt":  map[string]any{},
+		"authData": a.authData(attested),
+	})
+	if err != nil {
+		a.t.Fatal(err)
+	}
+
+	return a.respond(map[string]any{
+		"clientDataJSON":    b64url(a.clientData("webauthn.create", options.Challenge)),
+		"attestationObject": b64url(attestation),
+	})
+}
+
+func (a *softAuthenticator) get(options protocol.PublicKeyCredentialRequestOptions) io.Reader {
+	a.counter++
+	authData := a.authData(nil)
+	clientData := a.clientData("webauthn.get", options.Challenge)
+
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(authData, clientDataHash[:]...))
+	sig, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		a.t.Fatal(err)
+	}
+
+	return a.respond(map[string]any{
+		"clientDataJSON":    b64url(clientData),
+		"authenticatorData": b64url(authData),
+		"signature":         b64url(sig),
+		"userHandle":        b64url(a.userHandle),
+	})
+}
+
+func (a *softAuthenticator) respond(response map[string]any) io.Reader {
+	js, err := json.Marshal(map[string]any{
+		"id":       b64url(a.id),
+		"rawId":    b64url(a.id),
+		"type":     "public-key",
+		"response": response,
+	})
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	return bytes.NewReader(js)
+}
+
+func b64url(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func TestPasskeys(t *testing.T) {
+	wa, err := newWebAuthn("https://localhost:4000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := &webauthnUser{user: models.User{ID: 42, Name: "Alice", Email: "alice@example.com"}}
+	auth := newSoftAuthenticator(t, "localhost", "https://localhost:4000")
+
+	creation, session, err := wa.BeginRegistration(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, creation.Response.AuthenticatorSelection.UserVerification, protocol.VerificationRequired)
+
+	unverified := *auth
+	unverified.unverified = true
+	_, err = finishPasskeyRegistration(wa, user, *session, unverified.create(creation.Response))
+	assert.Equal(t, err != nil, true)
+
+	credential, err := finishPasskeyRegistration(wa, user, *session, auth.create(creation.Response))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, bytes.Equal(credential.ID, auth.id), true)
+
+	// credentials make a round trip through the database as JSON
+	stored, err := json.Marshal(credential)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lookup := func(id int) (webauthn.User, error) {
+		var c webauthn.Credential
+		if err := json.Unmarshal(stored, &c); err != nil {
+			return nil, err
+		}
+		if id != user.user.ID {
+			return nil, models.ErrNoRecord
+		}
+		return &webauthnUser{user: user.user, credentials: []webauthn.Credential{c}}, nil
+	}
+
+	t.Run("Valid", func(t *testing.T) {
+		assertion, session, err := wa.BeginDiscoverableLogin()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		id, used, err := finishPasskeyLogin(wa, *session, auth.get(assertion.Response), lookup)
+		assert.Equal(t, err, nil)
+		assert.Equal(t, id, 42)
+		assert.Equal(t, used.Authenticator.SignCount, auth.counter)
+
+		stored, _ = json.Marshal(used)
+	})
+
+	t.Run("Other challenge", func(t *testing.T) {
+		assertion, _, err := wa.BeginDiscoverableLogin()
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, session, err := wa.BeginDiscoverableLogin()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, _, err = finishPasskeyLogin(wa, *session, auth.get(assertion.Response), lookup)
+		assert.Equal(t, err != nil, true)
+	})
+
+	t.Run("Other origin", func(t *testing.T) {
+		assertion, session, err := wa.BeginDiscoverableLogin()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		phish := *auth
+		phish.origin = "https://snippetbox.example.net"
+		_, _, err = finishPasskeyLogin(wa, *session, phish.get(assertion.Response), lookup)
+		assert.Equal(t, err != nil, true)
+	})
+
+	t.Run("Unknown user", func(t *testing.T) {
+		assertion, session, err := wa.BeginDiscoverableLogin()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		stranger := *auth
+		stranger.userHandle = userHandle(7)
+		_, _, err = finishPasskeyLogin(wa, *session, stranger.get(assertion.Response), lookup)
+		assert.Equal(t, err != nil, true)
+	})
+
+	t.Run("Not verified", func(t *testing.T) {
+		assertion, session, err := wa.BeginDiscoverableLogin()
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, assertion.Response.UserVerification, protocol.VerificationRequired)
+
+		unverified := *auth
+		unverified.unverified = true
+		_, _, err = finishPasskeyLogin(wa, *session, unverified.get(assertion.Response), lookup)
+		assert.Equal(t, err != nil, true)
+	})
+
+	t.Run("Cloned key", func(t *testing.T) {
+		assertion, session, err := wa.BeginDiscoverableLogin()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		clone := *auth
+		clone.counter = 0
+		_, _, err = finishPasskeyLogin(wa, *session, clone.get(assertion.Response), lookup)
+		assert.Equal(t, err != nil, true)
+	})
+}
+
+func TestUserHandle(t *testing.T) {
+	id, ok := handleUserID(userHandle(1234))
+	assert.Equal(t, ok, true)
+	assert.Equal(t, id, 1234)
+
+	_, ok = handleUserID([]byte("abc"))
+	assert.Equal(t, ok, false)
+}
+
+func TestPasskeyLoginRememberMe(t *testing.T) {
+	app, _ := newTestApplicationDB(t)
+	id := insertUser(t, app, "Alice", "alice@example.com", "pa$$word1234")
+
+	// register a passkey the way passkeyRegisterFinish does
+	auth := newSoftAuthenticator(t, "localhost", "https://localhost:4000")
+	user, err := app.loadWebauthnUser(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	creation, session, err := app.webAuthn.BeginRegistration(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	credential, err := finishPasskeyRegistration(app.webAuthn, user, *session, auth.create(creation.Response))
+	if err != nil {
+		t.Fatal(err)
+	}
+	js, err := json.Marshal(credential)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = app.passkeyModel.Insert(id, credential.ID, "Laptop", js)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		begin       string
+		wantPersist bool
+	}{
+		{"Ticked", `{"remember":true}`, true},
+		{"Not ticked", `{"remember":false}`, false},
+		{"No body", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestServer(t, app.routes())
+			defer ts.Close()
+
+			code, _, body := ts.postJSON(t, "/user/login/passkey/begin", strings.NewReader(tt.begin))
+			assert.Equal(t, code, http.StatusOK)
+			var options struct {
+				PublicKey protocol.PublicKeyCredentialRequestOptions `json:"publicKey"`
+			}
+			if err := json.Unmarshal([]byte(body), &options); err != nil {
+				t.Fatal(err)
+			}
+
+			code, header, body := ts.postJSON(t, "/user/login/passkey/finish", auth.get(options.PublicKey))
+			assert.Equal(t, code, http.StatusOK)
+			assert.Equal(t, body, `{"redirect":"/snippet/create"}`)
+			assert.Equal(t, !sessionCookie(t, header).Expires.IsZero(), tt.wantPersist)
+
+			code, _, _ = ts.get(t, "/account")
+			assert.Equal(t, code, http.StatusOK)
+		})
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"snippetbox-n/internal/mailer"
+	"snippetbox-n/internal/models"
+	"snippetbox-n/internal/password"
+	"snippetbox-n/internal/validator"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// resetTokenTTL is how long an emailed reset link stays usable
+const resetTokenTTL = time.Hour
+
+// checkNewPassword turns down a new password that's common, has turned up in
+// a breach or is easy to guess, as field's error. userInputs are the user's
+// name and email, which shouldn't be in it. The estimate is returned for its
+// feedback.
+func (app *Application) checkNewPassword(v *validator.Validator, field, pw string, userInputs ...string) password.Strength {
+	policy := password.Policy{Breaches: app.breaches}
+	strength, err := policy.Check(pw, userInputs...)
+	if _, failed := v.FieldErrors[field]; failed {
+		return strength
+	}
+
+	switch {
+	case err == nil:
+	case errors.Is(err, password.ErrTooLong):
+		v.AddFieldError(field, fmt.Sprintf("This field must be no more than %d bytes long", password.MaxBytes))
+	case errors.Is(err, password.ErrCommon):
+		v.AddFieldError(field, "This is one of the most commonly used passwords, please choose another")
+	case errors.Is(err, password.ErrBreached):
+		v.AddFieldError(field, "This password has appeared in a data breach, please choose another")
+	case errors.Is(err, password.ErrTooEasy):
+		v.AddFieldError(field, "This password is too easy to guess")
+	default:
+		// not being able to check shouldn't stop anyone signing up
+		app.errorLog.Print(err)
+	}
+	return strength
+}
+
+type ForgotPasswordForm struct {
+	Email               string `form:"email"`
+	validator.Validator `form:"-"`
+}
+
+type ResetPasswordForm struct {
+	Token               string `form:"-"`
+	Password            string `form:"password"`
+	Confirm             string `form:"confirm"`
+	validator.Validator `form:"-"`
+}
+
+func (app *Application) passwordForgot(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	data.Form = ForgotPasswordForm{}
+	app.render(w, http.StatusOK, "forgot_password.tmpl.html", &data)
+}
+
+// passwordForgotPost answers the same way whether or not the address has an
+// account, so the form can't be used to find out who is signed up
+func (app *Application) passwordForgotPost(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	var form ForgotPasswordForm
+	err = app.formDecoder.Decode(&form, r.PostForm)
+	if err != nil {
+		app.clientError(w, http.StatusUnprocessableEntity)
+		return
+	}
+
+	form.CheckField(validator.NotBlank(form.Email), "email", "This field cannot be blank")
+	form.CheckField(validator.Matches(form.Email, validator.EmailRegex), "email", "This field must be a valid email address")
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, http.StatusUnprocessableEntity, "forgot_password.tmpl.html", &data)
+		return
+	}
+
+	user, err := app.userModel.GetByEmail(form.Email)
+	if err != nil && !errors.Is(err, models.ErrNoRecord) {
+		app.serverError(w, err)
+		return
+	}
+
+	// directory accounts change their password in the directory
+	if err == nil && !user.Disabled && !user.Directory {
+		token, err := app.resetModel.New(user.ID, resetTokenTTL)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+
+		app.sendMail(mailer.Message{
+			To:      user.Email,
+			Subject: "Reset your Snippetbox password",
+			Body: fmt.Sprintf("Hi %s,\n\nSomeone asked to reset the password for your Snippetbox account. "+
+				"If it was you, follow the link below within the next hour to choose a new one:\n\n%s/user/password/reset/%s\n\n"+
+				"If it wasn't you, you can ignore this email and your password will stay the same.\n",
+				user.Name, app.baseURL, token),
+		})
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "If that address has an account, we've emailed it a link to reset the password")
+	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+}
+
+func (app *Application) passwordReset(w http.ResponseWriter, r *http.Request) {
+	token := httprouter.ParamsFromContext(r.Context()).ByName("token")
+
+	_, err := app.resetModel.Check(token)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.sessionManager.Put(r.Context(), "flash", "That reset link has expired or was already used, please ask for a new one")
+			http.Redirect(w, r, "/user/password/forgot", http.StatusSeeOther)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Form = ResetPasswordForm{Token: token}
+	app.render(w, http.StatusOK, "reset_password.tmpl.html", &data)
+}
+
+func (app *Application) passwordResetPost(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	var form ResetPasswordForm
+	err = app.formDecoder.Decode(&form, r.PostForm)
+	if err != nil {
+		app.clientError(w, http.StatusUnprocessableEntity)
+		return
+	}
+	form.Token = httprouter.ParamsFromContext(r.Context()).ByName("token")
+
+	form.CheckField(validator.NotBlank(form.Password), "password", "This field cannot be blank")
+	form.CheckField(validator.MinChars(form.Password, 8), "password", "This field must be at least 8 characters long")
+	form.CheckField(form.Confirm == form.Password, "confirm", "The passwords don't match")
+	strength := app.checkNewPassword(&form.Validator, "password", form.Password)
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		data.PasswordFeedback = strength.Feedback
+		app.render(w, http.StatusUnprocessableEntity, "reset_password.tmpl.html", &data)
+		return
+	}
+
+	userID, err := app.userModel.ResetPassword(form.Token, form.Password)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.sessionManager.Put(r.Context(), "flash", "That reset link has expired or was already used, please ask for a new one")
+			http.Redirect(w, r, "/user/password/forgot", http.StatusSeeOther)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	// the new password logged every session out, clear them from the list
+	err = app.sessionModel.DeleteOthers(userID, 0)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Your password has been changed, please log in")
+	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"snippetbox-n/internal/assert"
+	"snippetbox-n/internal/models"
+	"snippetbox-n/internal/password"
+	"snippetbox-n/internal/validator"
+	"strings"
+	"testing"
+)
+
+func TestCheckNewPassword(t *testing.T) {
+	dir := t.TempDir()
+	app := newTestApplication(t)
+	app.breaches = password.RangeDir(dir)
+
+	// the hash of "correct horse battery staple", strong but well known
+	err := os.WriteFile(filepath.Join(dir, "ABF7A.txt"), []byte("AD6438836DBE526AA231ABDE2D0EEF74D42:3916\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		password string
+		want     string
+	}{
+		{"Strong", "violet tractor ember moss", ""},
+		{"Common", "letmein123", "This is one of the most commonly used passwords, please choose another"},
+		{"Weak", "alice1234", "This password is too easy to guess"},
+		{"Breached", "correct horse battery staple", "This password has appeared in a data breach, please choose another"},
+		{"Too long", strings.Repeat("violet tractor ", 5), "This field must be no more than 72 bytes long"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var v validator.Validator
+			app.checkNewPassword(&v, "password", tt.password, "Alice", "alice@example.com")
+			assert.Equal(t, v.FieldErrors["password"], tt.want)
+		})
+	}
+}
+
+func TestPasswordReset(t *testing.T) {
+	app, mail := newTestApplicationDB(t)
+	insertUser(t, app, "Alice", "alice@example.com", "pa$$word1234")
+
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	// unknown addresses get the same answer but no email
+	for _, email := range []string{"nobody@example.com", "alice@example.com"} {
+		code, header, _ := ts.postForm(t, "/user/password/forgot", url.Values{"email": {email}})
+		assert.Equal(t, code, http.StatusSeeOther)
+		assert.Equal(t, header.Get("Location"), "/user/login")
+	}
+
+	sent := mail.messages(t, 1)
+	assert.Equal(t, len(sent), 1)
+	assert.Equal(t, sent[0].To, "alice@example.com")
+
+	link := regexp.MustCompile(`/user/password/reset/\S+`).FindString(sent[0].Body)
+	if link == "" {
+		t.Fatalf("no reset link in %q", sent[0].Body)
+	}
+
+	code, _, _ := ts.get(t, link)
+	assert.Equal(t, code, http.StatusOK)
+
+	// a rejected form leaves the link usable
+	code, _, _ = ts.postForm(t, link, url.Values{"password": {"violet tractor ember moss"}, "confirm": {"violet tractor"}})
+	assert.Equal(t, code, http.StatusUnprocessableEntity)
+
+	code, header, _ := ts.postForm(t, link, url.Values{"password": {"violet tractor ember moss"}, "confirm": {"violet tractor ember moss"}})
+	assert.Equal(t, code, http.StatusSeeOther)
+	assert.Equal(t, header.Get("Location"), "/user/login")
+
+	// the link only works once
+	code, header, _ = ts.postForm(t, link, url.Values{"password": {"amber kettle violin fog"}, "confirm": {"amber kettle violin fog"}})
+	assert.Equal(t, code, http.StatusSeeOther)
+	assert.Equal(t, header.Get("Location"), "/user/password/forgot")
+
+	code, _, _ = ts.postForm(t, "/user/login", url.Values{"email": {"alice@example.com"}, "password": {"pa$$word1234"}})
+	assert.Equal(t, code, http.StatusUnprocessableEntity)
+	ts.login(t, "alice@example.com", "violet tractor ember moss")
+}
+
+func TestPasswordForgotDirectory(t *testing.T) {
+	app, _ := newTestApplicationDB(t)
+	id := insertUser(t, app, "Alice", "alice@example.com", "pa$$word1234")
+	err := app.identityModel.Link(id, models.ProviderLDAP, "uid=alice,ou=people,dc=example,dc=com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	code, header, _ := ts.postForm(t, "/user/password/forgot", url.Values{"email": {"alice@example.com"}})
+	assert.Equal(t, code, http.StatusSeeOther)
+	assert.Equal(t, header.Get("Location"), "/user/login")
+
+	var tokens int
+	err = app.resetModel.DB.QueryRow("SELECT COUNT(*) FROM password_resets").Scan(&tokens)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, tokens, 0)
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"snippetbox-n/internal/validator"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// POST / takes a paste from the command line, sprunge style:
+//
+//	cmd | curl -F 'f=<-' https://host/
+//	curl --data-binary @file.go 'https://host/?lang=go&expires=7'
+//
+// and answers with the snippet's URL as plain text. It sits outside noSurf and
+// never reads the session cookie, callers are anonymous unless they send an API
+// token. Anonymous pastes get smaller size and expiry limits.
+const (
+	maxAnonymousPasteBytes = 64 << 10
+	maxPasteBytes          = 1 << 20
+	defaultPasteExpires    = 7
+	pasteField             = "f"
+)
+
+func (app *Application) pastePost(w http.ResponseWriter, r *http.Request) {
+	userID := app.authenticatedUserID(r)
+
+	verified, err := app.emailVerified(r)
+	if err != nil {
+		app.errorLog.Print(err)
+		app.pasteError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	if !verified {
+		app.pasteError(w, http.StatusForbidden, "verify your email address before creating snippets")
+		return
+	}
+
+	limit := int64(maxPasteBytes)
+	if userID == 0 {
+		limit = maxAnonymousPasteBytes
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, limit)
+
+	content, err := pasteContent(r)
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			app.pasteError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("pastes are limited to %d bytes", limit))
+		} else {
+			app.pasteError(w, http.StatusBadRequest, err.Error())
+		}
+		return
+	}
+
+	query := r.URL.Query()
+	form := ContentForm{
+		Title:    query.Get("title"),
+		Content:  content,
+		Language: query.Get("lang"),
+		Expires:  defaultPasteExpires,
+	}
+	if form.Title == "" {
+		form.Title = pasteTitle(content)
+	}
+	if value := query.Get("expires"); value != "" {
+		form.Expires, err = strconv.Atoi(value)
+		if err != nil {
+			form.Expires = 0 //reported by validate
+		}
+	}
+
+	form.validate()
+	if userID == 0 {
+		form.CheckField(validator.PermittedVal(form.Expires, 1, 7), "expires", "Anonymous pastes must expire in either: 1, 7")
+	}
+	if !form.Valid() {
+		app.pasteError(w, http.StatusUnprocessableEntity, fieldErrorText(form.Validator))
+		return
+	}
+
+	id, err := app.snippetModel.Insert(userID, form.Title, form.Content, form.Language, form.Expires)
+	if err != nil {
+		app.errorLog.Print(err)
+		app.pasteError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusCreated)
+	fmt.Fprintf(w, "%s/snippet/view/%d\n", app.baseURL, id)
+}
+
+func (app *Application) pasteError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	fmt.Fprintln(w, strings.TrimSpace(message))
+}
+
+// pasteContent pulls the paste out of the request. Form posts carry it in the
+// "f" field, as a value or an uploaded file, anything else is taken to be the
+// paste itself.
+func pasteContent(r *http.Request) (string, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	switch mediaType {
+	case "multipart/form-data":
+		err := r.ParseMultipartForm(maxPasteBytes)
+		if err != nil {
+			return "", err
+		}
+		if values := r.MultipartForm.Value[pasteField]; len(values) > 0 {
+			return pasteText(values[0])
+		}
+		if files := r.MultipartForm.File[pasteField]; len(files) > 0 {
+			f, err := files[0].Open()
+			if err != nil {
+				return "", err
+			}
+			defer f.Close()
+			return readPaste(f)
+		}
+		return "", fmt.Errorf("no %q field in the form", pasteField)
+	case "application/x-www-form-urlencoded":
+		err := r.ParseForm()
+		if err != nil {
+			return "", err
+		}
+		if !r.PostForm.Has(pasteField) {
+			return "", fmt.Errorf("no %q field in the form", pasteField)
+		}
+		return pasteText(r.PostForm.Get(pasteField))
+	default:
+		return readPaste(r.Body)
+	}
+}
+
+func readPaste(r io.Reader) (string, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+	return pasteText(string(b))
+}
+
+// pasteText rejects anything that isn't UTF-8, whichever way the paste arrived
+func pasteText(s string) (string, error) {
+	if !utf8.ValidString(s) {
+		return "", errors.New("pastes must be UTF-8 text")
+	}
+	return s, nil
+}
+
+// pasteTitle names an untitled paste after its first non-blank line
+func pasteTitle(content string) string {
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if utf8.RuneCountInString(line) > 100 {
+			line = string([]rune(line)[:97]) + "..."
+		}
+		return line
+	}
+	return "Untitled paste"
+}
+
+// fieldErrorText lists validation failures one per line for plain text clients
+func fieldErrorText(v validator.Validator) string {
+	keys := make([]string, 0, len(v.FieldErrors))
+	for key := range v.FieldErrors {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	for _, key := range keys {
+		fmt.Fprintf(&b, "%s: %s\n", key, v.FieldErrors[key])
+	}
+	for _, msg := range v.NonFieldErrors {
+		fmt.Fprintln(&b, msg)
+	}
+	return b.String()
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"snippetbox-n/internal/assert"
+	"strings"
+	"testing"
+)
+
+func TestPasteContent(t *testing.T) {
+	multipartBody := func(file bool, value string) (string, *bytes.Buffer) {
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		if file {
+			fw, _ := mw.CreateFormFile("f", "main.go")
+			fw.Write([]byte(value))
+		} else {
+			mw.WriteField("f", value)
+		}
+		mw.Close()
+		return mw.FormDataContentType(), &body
+	}
+
+	fieldType, fieldBody := multipartBody(false, "package main\n")
+	fileType, fileBody := multipartBody(true, "package main\n")
+	binaryFieldType, binaryFieldBody := multipartBody(false, "\xff\xfe")
+	binaryFileType, binaryFileBody := multipartBody(true, "\xff\xfe")
+	missingType, missingBody := "multipart/form-data; boundary=x", strings.NewReader("--x--\r\n")
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        io.Reader
+		want        string
+		wantErr     bool
+	}{
+		{"Multipart field", fieldType, fieldBody, "package main\n", false},
+		{"Multipart file", fileType, fileBody, "package main\n", false},
+		{"Multipart missing", missingType, missingBody, "", true},
+		{"Multipart binary field", binaryFieldType, binaryFieldBody, "", true},
+		{"Multipart binary file", binaryFileType, binaryFileBody, "", true},
+		{"Form encoded", "application/x-www-form-urlencoded", strings.NewReader("f=package+main%0A"), "package main\n", false},
+		{"Form encoded binary", "application/x-www-form-urlencoded", strings.NewReader("f=%FF%FE"), "", true},
+		{"Raw", "text/plain", strings.NewReader("package main\n"), "package main\n", false},
+		{"No content type", "", strings.NewReader("package main\n"), "package main\n", false},
+		{"Binary", "application/octet-stream", bytes.NewReader([]byte{0xff, 0xfe}), "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/", tt.body)
+			if tt.contentType != "" {
+				r.Header.Set("Content-Type", tt.contentType)
+			}
+
+			content, err := pasteContent(r)
+			assert.Equal(t, content, tt.want)
+			assert.Equal(t, err != nil, tt.wantErr)
+		})
+	}
+}
+
+func TestPasteTitle(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"First line", "\n  package main  \nfunc main() {}", "package main"},
+		{"Blank", " \n\t\n", "Untitled paste"},
+		{"Long", strings.Repeat("x", 120), strings.Repeat("x", 97) + "..."},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, pasteTitle(tt.content), tt.want)
+		})
+	}
+}
+
+func TestPasteRejectsAnonymousLongExpiry(t *testing.T) {
+	app := newTestApplication(t)
+
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	code, header, body := ts.do(t, http.MethodPost, "/?expires=365", "text/plain", strings.NewReader("An old silent pond"))
+
+	assert.Equal(t, code, http.StatusUnprocessableEntity)
+	assert.Equal(t, header.Get("Content-Type"), "text/plain; charset=utf-8")
+	assert.Equal(t, body, "expires: Anonymous pastes must expire in either: 1, 7")
+}
+
+func TestPasteLinkIgnoresHost(t *testing.T) {
+	app, _ := newTestApplicationDB(t)
+
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("An old silent pond"))
+	r.Host = "evil.example"
+	rr := httptest.NewRecorder()
+	app.routes().ServeHTTP(rr, r)
+
+	assert.Equal(t, rr.Code, http.StatusCreated)
+	assert.Equal(t, strings.HasPrefix(rr.Body.String(), app.baseURL+"/snippet/view/"), true)
+}
@@ -3,6 +3,7 @@ package main
 import "github.com/julienschmidt/httprouter"
 import "github.com/justinas/alice"
 import "net/http"
+import "snippetbox-n/internal/models"
 
 func (app *Application) routes() http.Handler {
 	router := httprouter.New()
@@ -20,18 +21,98 @@ func (app *Application) routes() http.Handler {
 
 	router.Handler(http.MethodGet, "/", dynamic.ThenFunc(app.home))
 	router.Handler(http.MethodGet, "/snippet/view/:id", dynamic.ThenFunc(app.snippetView))
+	router.Handler(http.MethodGet, "/trending", dynamic.ThenFunc(app.trending))
+	router.Handler(http.MethodGet, "/collection/view/:id", dynamic.ThenFunc(app.collectionView))
 	router.Handler(http.MethodGet, "/user/signup", dynamic.ThenFunc(app.userSignup))
 	router.Handler(http.MethodPost, "/user/signup", dynamic.ThenFunc(app.userSignupPost))
 	router.Handler(http.MethodGet, "/user/login", dynamic.ThenFunc(app.userLogin))
 	router.Handler(http.MethodPost, "/user/login", dynamic.ThenFunc(app.userLoginPost))
+	router.Handler(http.MethodGet, "/user/login/2fa", dynamic.ThenFunc(app.userLoginTwoFactor))
+	router.Handler(http.MethodPost, "/user/login/2fa", dynamic.ThenFunc(app.userLoginTwoFactorPost))
+	router.Handler(http.MethodPost, "/user/login/passkey/begin", dynamic.ThenFunc(app.passkeyLoginBegin))
+	router.Handler(http.MethodPost, "/user/login/passkey/finish", dynamic.ThenFunc(app.passkeyLoginFinish))
+	router.Handler(http.MethodGet, "/user/login/oidc/:provider", dynamic.ThenFunc(app.oidcStart))
+	router.Handler(http.MethodGet, "/user/login/oidc/:provider/callback", dynamic.ThenFunc(app.oidcCallback))
+	router.Handler(http.MethodGet, "/user/password/forgot", dynamic.ThenFunc(app.passwordForgot))
+	router.Handler(http.MethodPost, "/user/password/forgot", dynamic.ThenFunc(app.passwordForgotPost))
+	router.Handler(http.MethodGet, "/user/password/reset/:token", dynamic.ThenFunc(app.passwordReset))
+	router.Handler(http.MethodPost, "/user/password/reset/:token", dynamic.ThenFunc(app.passwordResetPost))
+	router.Handler(http.MethodGet, "/user/verify/:token", dynamic.ThenFunc(app.userVerifyConfirm))
 
 	protected := dynamic.Append(app.requireAuth)
 
-	router.Handler(http.MethodGet, "/snippet/create", protected.ThenFunc(app.snippetCreate))
-	router.Handler(http.MethodPost, "/snippet/create", protected.ThenFunc(app.snippetCreatePost))
+	verified := protected.Append(app.requireVerified)
+
+	router.Handler(http.MethodGet, "/snippet/create", verified.ThenFunc(app.snippetCreate))
+	router.Handler(http.MethodPost, "/snippet/create", verified.ThenFunc(app.snippetCreatePost))
 	router.Handler(http.MethodPost, "/user/logout", protected.ThenFunc(app.userLogoutPost))
+	router.Handler(http.MethodGet, "/user/verify", protected.ThenFunc(app.userVerify))
+	router.Handler(http.MethodPost, "/user/verify", protected.ThenFunc(app.userVerifyPost))
+
+	router.Handler(http.MethodPost, "/comment/create", protected.ThenFunc(app.commentCreatePost))
+	router.Handler(http.MethodGet, "/comment/edit/:id", protected.ThenFunc(app.commentEdit))
+	router.Handler(http.MethodPost, "/comment/edit/:id", protected.ThenFunc(app.commentEditPost))
+	router.Handler(http.MethodPost, "/comment/delete/:id", protected.ThenFunc(app.commentDeletePost))
+
+	moderator := protected.Append(app.requireRole(models.RoleModerator))
+
+	router.Handler(http.MethodPost, "/comment/thread/lock/:id", moderator.ThenFunc(app.commentThreadLockPost))
+	router.Handler(http.MethodPost, "/comment/thread/delete/:id", moderator.ThenFunc(app.commentThreadDeletePost))
+
+	router.Handler(http.MethodGet, "/collection/mine", protected.ThenFunc(app.collectionList))
+	router.Handler(http.MethodGet, "/collection/create", protected.ThenFunc(app.collectionCreate))
+	router.Handler(http.MethodPost, "/collection/create", protected.ThenFunc(app.collectionCreatePost))
+	router.Handler(http.MethodGet, "/collection/edit/:id", protected.ThenFunc(app.collectionEdit))
+	router.Handler(http.MethodPost, "/collection/edit/:id", protected.ThenFunc(app.collectionEditPost))
+	router.Handler(http.MethodPost, "/collection/delete/:id", protected.ThenFunc(app.collectionDeletePost))
+	router.Handler(http.MethodPost, "/collection/add", protected.ThenFunc(app.collectionAddPost))
+	router.Handler(http.MethodPost, "/collection/remove/:id", protected.ThenFunc(app.collectionRemovePost))
+	router.Handler(http.MethodPost, "/collection/move/:id", protected.ThenFunc(app.collectionMovePost))
+
+	admin := protected.Append(app.requireRole(models.RoleAdmin))
+
+	router.Handler(http.MethodGet, "/admin", admin.ThenFunc(app.adminDashboard))
+	router.Handler(http.MethodPost, "/admin/users/disable/:id", admin.ThenFunc(app.adminUserDisablePost))
+	router.Handler(http.MethodPost, "/admin/users/enable/:id", admin.ThenFunc(app.adminUserEnablePost))
+	router.Handler(http.MethodPost, "/admin/snippets/delete/:id", admin.ThenFunc(app.adminSnippetDeletePost))
+	router.Handler(http.MethodGet, "/admin/audit", admin.ThenFunc(app.adminAudit))
+
+	router.Handler(http.MethodGet, "/account", protected.ThenFunc(app.account))
+	router.Handler(http.MethodPost, "/account/name", protected.ThenFunc(app.accountNamePost))
+	router.Handler(http.MethodPost, "/account/email", protected.ThenFunc(app.accountEmailPost))
+	router.Handler(http.MethodPost, "/account/password", protected.ThenFunc(app.accountPasswordPost))
+	router.Handler(http.MethodGet, "/account/2fa", protected.ThenFunc(app.twoFactor))
+	router.Handler(http.MethodGet, "/account/2fa/qr", protected.ThenFunc(app.twoFactorQR))
+	router.Handler(http.MethodPost, "/account/2fa/enable", protected.ThenFunc(app.twoFactorEnablePost))
+	router.Handler(http.MethodPost, "/account/2fa/disable", protected.ThenFunc(app.twoFactorDisablePost))
+	router.Handler(http.MethodPost, "/account/2fa/recovery", protected.ThenFunc(app.twoFactorRecoveryPost))
+	router.Handler(http.MethodGet, "/account/sessions", protected.ThenFunc(app.sessionList))
+	router.Handler(http.MethodPost, "/account/sessions/revoke/:id", protected.ThenFunc(app.sessionRevokePost))
+	router.Handler(http.MethodPost, "/account/sessions/logout-others", protected.ThenFunc(app.sessionLogoutOthersPost))
+	router.Handler(http.MethodGet, "/account/passkeys", protected.ThenFunc(app.passkeyList))
+	router.Handler(http.MethodPost, "/account/passkeys/register/begin", protected.ThenFunc(app.passkeyRegisterBegin))
+	router.Handler(http.MethodPost, "/account/passkeys/register/finish", protected.ThenFunc(app.passkeyRegisterFinish))
+	router.Handler(http.MethodPost, "/account/passkeys/delete/:id", protected.ThenFunc(app.passkeyDeletePost))
+	router.Handler(http.MethodGet, "/account/export", protected.ThenFunc(app.accountExport))
+	router.Handler(http.MethodGet, "/account/delete", protected.ThenFunc(app.accountDelete))
+	router.Handler(http.MethodPost, "/account/delete", protected.ThenFunc(app.accountDeletePost))
+	router.Handler(http.MethodGet, "/account/tokens", protected.ThenFunc(app.tokenList))
+	router.Handler(http.MethodPost, "/account/tokens", protected.ThenFunc(app.tokenCreatePost))
+	router.Handler(http.MethodPost, "/account/tokens/revoke/:id", protected.ThenFunc(app.tokenRevokePost))
+
+	api := alice.New(app.authenticateToken, app.requireScope(models.ScopeRead))
+	apiWrite := alice.New(app.authenticateToken, app.apiRequireAuth, app.requireScope(models.ScopeWrite))
+
+	router.Handler(http.MethodGet, "/api/v1/snippets", api.ThenFunc(app.apiSnippetList))
+	router.Handler(http.MethodPost, "/api/v1/snippets", apiWrite.Append(app.apiRequireVerified).ThenFunc(app.apiSnippetCreate))
+	router.Handler(http.MethodGet, "/api/v1/snippets/:id", api.ThenFunc(app.apiSnippetGet))
+	router.Handler(http.MethodPut, "/api/v1/snippets/:id", apiWrite.ThenFunc(app.apiSnippetUpdate))
+	router.Handler(http.MethodDelete, "/api/v1/snippets/:id", apiWrite.ThenFunc(app.apiSnippetDelete))
+
+	paste := alice.New(app.optionalToken, app.requireScope(models.ScopeWrite))
+	router.Handler(http.MethodPost, "/", paste.ThenFunc(app.pastePost))
 
-	midware := alice.New(app.panicHandler, app.logRequest, secureHeaders)
+	midware := alice.New(app.realIP, app.panicHandler, app.logRequest, secureHeaders)
 
 	return midware.Then(router)
 }
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"snippetbox-n/internal/models"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// touchSession checks the session is still in the user's list and notes it's
+// in use, logging it out if it has been idle too long. Sessions without a row,
+// from before sessions were listed, get one.
+func (app *Application) touchSession(r *http.Request, id int) (bool, error) {
+	sid := app.sessionManager.GetInt(r.Context(), "sid")
+	if sid == 0 {
+		return true, app.trackSession(r, id)
+	}
+
+	lastSeen, err := app.sessionModel.Touch(sid, id, clientIP(r))
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			// logged out from another session
+			app.forgetLogIn(r)
+			return false, nil
+		}
+		return false, err
+	}
+
+	if app.idleTimeout > 0 && !app.sessionManager.GetBool(r.Context(), "rememberMe") &&
+		time.Since(lastSeen) > app.idleTimeout {
+		err = app.sessionModel.Delete(id, sid)
+		if err != nil && !errors.Is(err, models.ErrNoRecord) {
+			return false, err
+		}
+		app.forgetLogIn(r)
+		return false, nil
+	}
+	return true, nil
+}
+
+func (app *Application) forgetLogIn(r *http.Request) {
+	app.sessionManager.Remove(r.Context(), "authenticatedUser")
+	app.sessionManager.Remove(r.Context(), "sid")
+	app.sessionManager.Remove(r.Context(), "rememberMe")
+	app.sessionManager.RememberMe(r.Context(), false)
+}
+
+func (app *Application) sessionList(w http.ResponseWriter, r *http.Request) {
+	sessions, err := app.sessionModel.ForUser(app.authenticatedUserID(r))
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Sessions = sessions
+	data.SessionID = app.sessionManager.GetInt(r.Context(), "sid")
+	app.render(w, http.StatusOK, "sessions.tmpl.html", &data)
+}
+
+func (app *Application) sessionRevokePost(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil || id < 1 {
+		app.notFound(w)
+		return
+	}
+
+	// this session is logged out with the logout button
+	if id == app.sessionManager.GetInt(r.Context(), "sid") {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	err = app.sessionModel.Delete(app.authenticatedUserID(r), id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Session logged out")
+	http.Redirect(w, r, "/account/sessions", http.StatusSeeOther)
+}
+
+// sessionLogoutOthersPost logs out everywhere but here. Bumping the session
+// version catches any session the list has missed.
+func (app *Application) sessionLogoutOthersPost(w http.ResponseWriter, r *http.Request) {
+	id := app.authenticatedUserID(r)
+
+	err := app.userModel.BumpSessionVersion(id)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	err = app.logIn(r, id, app.sessionManager.GetBool(r.Context(), "rememberMe"))
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	err = app.sessionModel.DeleteOthers(id, app.sessionManager.GetInt(r.Context(), "sid"))
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "You have been logged out everywhere else")
+	http.Redirect(w, r, "/account/sessions", http.StatusSeeOther)
+}
+
+// describeUserAgent turns a User-Agent header into something like "Firefox on
+// Windows". It only knows the common browsers, anything else is shown as is.
+func describeUserAgent(ua string) string {
+	if ua == "" {
+		return "Unknown device"
+	}
+
+	var browser string
+	switch {
+	case strings.Contains(ua, "Edg/") || strings.Contains(ua, "EdgA/") || strings.Contains(ua, "EdgiOS/"):
+		browser = "Edge"
+	case strings.Contains(ua, "OPR/"):
+		browser = "Opera"
+	case strings.Contains(ua, "Firefox/") || strings.Contains(ua, "FxiOS/"):
+		browser = "Firefox"
+	case strings.Contains(ua, "Chrome/") || strings.Contains(ua, "CriOS/"):
+		browser = "Chrome"
+	case strings.Contains(ua, "Safari/"):
+		browser = "Safari"
+	}
+
+	var platform string
+	switch {
+	case strings.Contains(ua, "iPhone") || strings.Contains(ua, "iPad"):
+		platform = "iOS"
+	case strings.Contains(ua, "Android"):
+		platform = "Android"
+	case strings.Contains(ua, "Windows"):
+		platform = "Windows"
+	case strings.Contains(ua, "Mac OS X"):
+		platform = "macOS"
+	case strings.Contains(ua, "CrOS"):
+		platform = "ChromeOS"
+	case strings.Contains(ua, "Linux"):
+		platform = "Linux"
+	}
+
+	switch {
+	case browser != "" && platform != "":
+		return browser + " on " + platform
+	case browser != "":
+		return browser
+	}
+
+	// a command line client or similar, its name is usually first
+	name, _, _ := strings.Cut(ua, " ")
+	return name
+}
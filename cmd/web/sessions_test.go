@@ -0,0 +1,196 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"snippetbox-n/internal/assert"
+	"snippetbox-n/internal/models"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newestSession returns the user's most recent login
+func newestSession(t *testing.T, app *Application, userID int) models.Session {
+	sessions, err := app.sessionModel.ForUser(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var newest models.Session
+	for _, s := range sessions {
+		if s.ID > newest.ID {
+			newest = s
+		}
+	}
+	return newest
+}
+
+func TestSessionRevokePost(t *testing.T) {
+	app, _ := newTestApplicationDB(t)
+	alice := insertUser(t, app, "Alice", "alice@example.com", "pa$$word1234")
+	bob := insertUser(t, app, "Bob", "bob@example.com", "pa$$word1234")
+
+	here := newTestServer(t, app.routes())
+	defer here.Close()
+	here.login(t, "alice@example.com", "pa$$word1234")
+	current := newestSession(t, app, alice).ID
+
+	phone := newTestServer(t, app.routes())
+	defer phone.Close()
+	phone.login(t, "alice@example.com", "pa$$word1234")
+	other := newestSession(t, app, alice).ID
+
+	bobs := newTestServer(t, app.routes())
+	defer bobs.Close()
+	bobs.login(t, "bob@example.com", "pa$$word1234")
+
+	// someone else's session isn't found, and stays logged in
+	code, _, _ := here.postForm(t, "/account/sessions/revoke/"+strconv.Itoa(newestSession(t, app, bob).ID), nil)
+	assert.Equal(t, code, http.StatusNotFound)
+	code, _, _ = bobs.get(t, "/account")
+	assert.Equal(t, code, http.StatusOK)
+
+	code, _, _ = here.postForm(t, "/account/sessions/revoke/"+strconv.Itoa(current), nil)
+	assert.Equal(t, code, http.StatusBadRequest)
+
+	code, header, _ := here.postForm(t, "/account/sessions/revoke/"+strconv.Itoa(other), nil)
+	assert.Equal(t, code, http.StatusSeeOther)
+	assert.Equal(t, header.Get("Location"), "/account/sessions")
+
+	// the revoked session is logged out on its next request
+	code, header, _ = phone.get(t, "/account")
+	assert.Equal(t, code, http.StatusSeeOther)
+	assert.Equal(t, header.Get("Location"), "/user/login")
+
+	code, _, _ = here.get(t, "/account")
+	assert.Equal(t, code, http.StatusOK)
+}
+
+func TestSessionLogoutOthersPost(t *testing.T) {
+	app, _ := newTestApplicationDB(t)
+	alice := insertUser(t, app, "Alice", "alice@example.com", "pa$$word1234")
+
+	var others []TestServer
+	for range 2 {
+		ts := newTestServer(t, app.routes())
+		defer ts.Close()
+		ts.login(t, "alice@example.com", "pa$$word1234")
+		others = append(others, ts)
+	}
+
+	here := newTestServer(t, app.routes())
+	defer here.Close()
+	here.login(t, "alice@example.com", "pa$$word1234")
+
+	code, header, _ := here.postForm(t, "/account/sessions/logout-others", nil)
+	assert.Equal(t, code, http.StatusSeeOther)
+	assert.Equal(t, header.Get("Location"), "/account/sessions")
+
+	for _, ts := range others {
+		code, header, _ = ts.get(t, "/account")
+		assert.Equal(t, code, http.StatusSeeOther)
+		assert.Equal(t, header.Get("Location"), "/user/login")
+	}
+
+	// this session carries on, and is the only one left on the list
+	code, _, body := here.get(t, "/account/sessions")
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, strings.Contains(body, "This session"), true)
+
+	sessions, err := app.sessionModel.ForUser(alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, len(sessions), 1)
+}
+
+func TestSessionIdleTimeout(t *testing.T) {
+	app, _ := newTestApplicationDB(t)
+	app.idleTimeout = 2 * time.Hour
+	id := insertUser(t, app, "Alice", "alice@example.com", "pa$$word1234")
+
+	tests := []struct {
+		name     string
+		remember string
+		wantCode int
+	}{
+		{"Not remembered", "", http.StatusSeeOther},
+		{"Remembered", "true", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestServer(t, app.routes())
+			defer ts.Close()
+
+			ts.postForm(t, "/user/login", url.Values{
+				"email":    {"alice@example.com"},
+				"password": {"pa$$word1234"},
+				"remember": {tt.remember},
+			})
+			code, _, _ := ts.get(t, "/account")
+			assert.Equal(t, code, http.StatusOK)
+
+			// leave the session unused for longer than the timeout
+			stmt := `UPDATE user_sessions SET last_seen = ? WHERE id = ?`
+			_, err := app.sessionModel.DB.Exec(stmt, time.Now().UTC().Add(-3*time.Hour), newestSession(t, app, id).ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			code, _, _ = ts.get(t, "/account")
+			assert.Equal(t, code, tt.wantCode)
+		})
+	}
+}
+
+func TestDescribeUserAgent(t *testing.T) {
+	tests := []struct {
+		name string
+		ua   string
+		want string
+	}{
+		{
+			name: "Firefox on Windows",
+			ua:   "Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:131.0) Gecko/20100101 Firefox/131.0",
+			want: "Firefox on Windows",
+		},
+		{
+			name: "Chrome on macOS",
+			ua:   "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/129.0.0.0 Safari/537.36",
+			want: "Chrome on macOS",
+		},
+		{
+			name: "Edge on Windows",
+			ua:   "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/129.0.0.0 Safari/537.36 Edg/129.0.0.0",
+			want: "Edge on Windows",
+		},
+		{
+			name: "Safari on iOS",
+			ua:   "Mozilla/5.0 (iPhone; CPU iPhone OS 17_6 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.6 Mobile/15E148 Safari/604.1",
+			want: "Safari on iOS",
+		},
+		{
+			name: "Chrome on Android",
+			ua:   "Mozilla/5.0 (Linux; Android 10; K) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/129.0.0.0 Mobile Safari/537.36",
+			want: "Chrome on Android",
+		},
+		{
+			name: "curl",
+			ua:   "curl/8.5.0",
+			want: "curl/8.5.0",
+		},
+		{
+			name: "Empty",
+			ua:   "",
+			want: "Unknown device",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, describeUserAgent(tt.ua), tt.want)
+		})
+	}
+}
@@ -2,21 +2,49 @@ package main
 
 import "html/template"
 import "path/filepath"
+import "strings"
 import "snippetbox-n/internal/models"
 import "time"
 
 type templateData struct {
-	CurrentYear     int
-	Snippet         models.Snippet
-	SnippetSlice    []models.Snippet
-	Form            any //god no...
-	Flash           string
-	IsAuthenticated bool
-	CSRFToken       string
+	CurrentYear      int
+	Snippet          models.Snippet
+	SnippetSlice     []models.Snippet
+	Trending         []models.TrendingSnippet
+	Comments         []models.Comment
+	Collection       models.Collection
+	Collections      []models.Collection
+	Tokens           []models.Token
+	NewToken         string
+	User             models.User
+	TOTPSecret       string   //shown while setting up two factor authentication
+	RecoveryCodes    []string //shown once, when they are issued
+	RecoveryLeft     int
+	Passkeys         []models.Passkey
+	Sessions         []models.Session
+	SessionID        int //the session being used, in Sessions
+	LoginProviders   []*oidcProvider
+	Stats            models.Stats
+	Users            []models.User
+	UserLookup       string //the email address or ID the admin looked Users up by
+	AuditEntries     []models.AuditEntry
+	PrevPage         int      //0 on the first page
+	NextPage         int      //0 on the last page
+	PasswordFeedback []string //suggestions for a stronger password
+	Form             any      //god no...
+	Flash            string
+	IsAuthenticated  bool
+	UserID           int
+	IsModerator      bool
+	IsAdmin          bool
+	CSRFToken        string
 }
 
 var functions = template.FuncMap{
 	"humanDate": humanDate,
+	"markdown":  markdownLite,
+	"lines":     snippetLines,
+	"userAgent": describeUserAgent,
 }
 
 func humanDate(t time.Time) string {
@@ -26,6 +54,25 @@ func humanDate(t time.Time) string {
 	return t.UTC().Format("02 Jan 2006 at 15:04")
 }
 
+// snippetLine is one line of a snippet as rendered on the view page, Number is
+// also used for the line's #L anchor
+type snippetLine struct {
+	Number int
+	Text   string
+}
+
+func snippetLines(content string) []snippetLine {
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+	content = strings.TrimSuffix(content, "\n")
+
+	split := strings.Split(content, "\n")
+	lines := make([]snippetLine, len(split))
+	for i, text := range split {
+		lines[i] = snippetLine{Number: i + 1, Text: text}
+	}
+	return lines
+}
+
 func newTemplateCache() (map[string]*template.Template, error) {
 	cache := map[string]*template.Template{}
 
@@ -36,3 +36,37 @@ func TestHumanDate(t *testing.T) {
 		})
 	}
 }
+
+func TestSnippetLines(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []snippetLine
+	}{
+		{
+			name:    "Single",
+			content: "An old silent pond",
+			want:    []snippetLine{{1, "An old silent pond"}},
+		},
+		{
+			name:    "Trailing newline",
+			content: "An old silent pond\nA frog jumps into the pond,\n",
+			want:    []snippetLine{{1, "An old silent pond"}, {2, "A frog jumps into the pond,"}},
+		},
+		{
+			name:    "CRLF and blank lines",
+			content: "one\r\n\r\nthree",
+			want:    []snippetLine{{1, "one"}, {2, ""}, {3, "three"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lines := snippetLines(tt.content)
+			assert.Equal(t, len(lines), len(tt.want))
+			for i := range min(len(lines), len(tt.want)) {
+				assert.Equal(t, lines[i], tt.want[i])
+			}
+		})
+	}
+}
@@ -2,12 +2,29 @@ package main
 
 import (
 	"bytes"
+	"html"
+	"html/template"
 	"io"
 	"log"
 	"net/http"
 	"net/http/cookiejar"
 	"net/http/httptest"
+	"net/url"
+	"os"
+	"regexp"
+	"snippetbox-n/internal/auth"
+	"snippetbox-n/internal/mailer"
+	"snippetbox-n/internal/models"
+	"snippetbox-n/internal/password"
+	"snippetbox-n/internal/testdb"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/alexedwards/scs/v2"
+	"github.com/go-playground/form/v4"
+	"golang.org/x/crypto/bcrypt"
 )
 
 type TestServer struct {
@@ -16,8 +33,128 @@ type TestServer struct {
 
 func newTestApplication(t *testing.T) Application {
 	return Application{
-		errorLog: log.New(io.Discard, "", 0),
-		infoLog:  log.New(io.Discard, "", 0),
+		errorLog:       log.New(io.Discard, "", 0),
+		infoLog:        log.New(io.Discard, "", 0),
+		formDecoder:    form.NewDecoder(),
+		sessionManager: scs.New(),
+	}
+}
+
+// newTestApplicationDB is a complete application on a database of its own,
+// for tests that go through the models. It is skipped when there's no test
+// database, see internal/testdb.
+func newTestApplicationDB(t *testing.T) (*Application, *testMailer) {
+	db := testdb.New(t)
+
+	// the cheapest hashes, tests log in a lot
+	hasher, err := password.New("bcrypt", bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	userModel := &models.UserModel{DB: db, Hasher: hasher}
+
+	webAuthn, err := newWebAuthn("https://localhost:4000")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mail := &testMailer{}
+	loginAccounts, loginIPs := newLoginLimiters()
+	viewModel := &models.ViewModel{DB: db}
+	app := &Application{
+		errorLog:        log.New(io.Discard, "", 0),
+		infoLog:         log.New(io.Discard, "", 0),
+		userModel:       userModel,
+		authenticator:   auth.Chain{userModel},
+		loginAccounts:   loginAccounts,
+		loginIPs:        loginIPs,
+		snippetModel:    &models.SnippetModel{DB: db},
+		commentModel:    &models.CommentModel{DB: db},
+		collectionModel: &models.CollectionModel{DB: db},
+		viewModel:       viewModel,
+		viewCounter:     newViewCounter(viewModel),
+		tokenModel:      &models.TokenModel{DB: db},
+		resetModel:      &models.PasswordResetModel{DB: db},
+		twoFactorModel:  &models.TwoFactorModel{DB: db},
+		passkeyModel:    &models.PasskeyModel{DB: db},
+		sessionModel:    &models.SessionModel{DB: db},
+		statsModel:      &models.StatsModel{DB: db},
+		auditModel:      &models.AuditModel{DB: db},
+		webAuthn:        webAuthn,
+		identityModel:   &models.IdentityModel{DB: db},
+		mailer:          mail,
+		baseURL:         "https://localhost:4000",
+		secret:          []byte("test secret"),
+		verifiedOnly:    true,
+		templateCache:   testTemplateCache(t),
+		formDecoder:     form.NewDecoder(),
+		sessionManager:  scs.New(),
+		rememberFor:     24 * time.Hour,
+	}
+	// as in main, only "remember me" cookies outlive the browser
+	app.sessionManager.Lifetime = time.Hour
+	app.sessionManager.Cookie.Persist = false
+	return app, mail
+}
+
+// testTemplateCache builds the template cache from the repository root, where
+// the templates' paths start
+func testTemplateCache(t *testing.T) map[string]*template.Template {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir("../.."); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	cache, err := newTemplateCache()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cache
+}
+
+// insertUser creates a user with a verified email
+func insertUser(t *testing.T, app *Application, name, email, password string) int {
+	id, err := app.userModel.Insert(name, email, password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := app.userModel.VerifyEmail(id); err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+// testMailer keeps the messages sent through it
+type testMailer struct {
+	mu   sync.Mutex
+	sent []mailer.Message
+}
+
+func (m *testMailer) Send(msg mailer.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+// messages waits for at least n messages, they're sent in the background,
+// and returns all of them
+func (m *testMailer) messages(t *testing.T, n int) []mailer.Message {
+	for deadline := time.Now().Add(2 * time.Second); ; {
+		m.mu.Lock()
+		sent := append([]mailer.Message(nil), m.sent...)
+		m.mu.Unlock()
+		if len(sent) >= n || time.Now().After(deadline) {
+			if len(sent) < n {
+				t.Fatalf("got %d messages, want %d", len(sent), n)
+			}
+			return sent
+		}
+		time.Sleep(10 * time.Millisecond)
 	}
 }
 
@@ -54,3 +191,91 @@ func (ts *TestServer) get(t *testing.T, urlPath string) (int, http.Header, strin
 
 	return rs.StatusCode, rs.Header, string(body)
 }
+
+func (ts *TestServer) do(t *testing.T, method, urlPath, contentType string, body io.Reader) (int, http.Header, string) {
+	req, err := http.NewRequest(method, ts.URL+urlPath, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	rs, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer rs.Body.Close()
+
+	b, err := io.ReadAll(rs.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return rs.StatusCode, rs.Header, string(bytes.TrimSpace(b))
+}
+
+var csrfTokenRX = regexp.MustCompile(`<input type='hidden' name='csrf_token' value='(.+?)'>`)
+
+// csrfToken returns a CSRF token for the test server's session
+func (ts *TestServer) csrfToken(t *testing.T) string {
+	_, _, body := ts.get(t, "/user/login")
+	matches := csrfTokenRX.FindStringSubmatch(body)
+	if len(matches) < 2 {
+		t.Fatal("no csrf token found in body")
+	}
+	return html.UnescapeString(matches[1])
+}
+
+// postForm posts form with a CSRF token added
+func (ts *TestServer) postForm(t *testing.T, urlPath string, form url.Values) (int, http.Header, string) {
+	if form == nil {
+		form = url.Values{}
+	}
+	form.Set("csrf_token", ts.csrfToken(t))
+	return ts.do(t, http.MethodPost, urlPath, "application/x-www-form-urlencoded", strings.NewReader(form.Encode()))
+}
+
+// postJSON posts body with the CSRF token in a header, the way the passkey
+// scripts do
+func (ts *TestServer) postJSON(t *testing.T, urlPath string, body io.Reader) (int, http.Header, string) {
+	req, err := http.NewRequest(http.MethodPost, ts.URL+urlPath, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-CSRF-Token", ts.csrfToken(t))
+
+	rs, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rs.Body.Close()
+
+	b, err := io.ReadAll(rs.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rs.StatusCode, rs.Header, string(bytes.TrimSpace(b))
+}
+
+// sessionCookie returns the session cookie a response set, failing the test if
+// there isn't one
+func sessionCookie(t *testing.T, header http.Header) *http.Cookie {
+	for _, c := range (&http.Response{Header: header}).Cookies() {
+		if c.Name == "session" {
+			return c
+		}
+	}
+	t.Fatal("no session cookie set")
+	return nil
+}
+
+// login logs the test server's client in, failing the test if it can't
+func (ts *TestServer) login(t *testing.T, email, password string) {
+	code, _, body := ts.postForm(t, "/user/login", url.Values{"email": {email}, "password": {password}})
+	if code != http.StatusSeeOther {
+		t.Fatalf("logging in as %s: got status %d\n%s", email, code, body)
+	}
+}
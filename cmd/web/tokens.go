@@ -0,0 +1,94 @@
+package main
+
+import (
+	"errors"
+	"github.com/julienschmidt/httprouter"
+	"net/http"
+	"snippetbox-n/internal/models"
+	"snippetbox-n/internal/validator"
+	"strconv"
+)
+
+type TokenForm struct {
+	Name                string `form:"name"`
+	Scope               string `form:"scope"`
+	validator.Validator `form:"-"`
+}
+
+// tokenList shows the user's tokens, and a token just created once: it's
+// popped from the session so reloading the page doesn't show it again
+func (app *Application) tokenList(w http.ResponseWriter, r *http.Request) {
+	newToken := app.sessionManager.PopString(r.Context(), "newToken")
+	app.renderTokens(w, r, http.StatusOK, TokenForm{Scope: models.ScopeRead}, newToken)
+}
+
+func (app *Application) tokenCreatePost(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	var form TokenForm
+	err = app.formDecoder.Decode(&form, r.PostForm)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.CheckField(validator.NotBlank(form.Name), "name", "This field cannot be blank")
+	form.CheckField(validator.MaxChars(form.Name, 100), "name", "This field cannot be more than 100 characters long")
+	form.CheckField(validator.PermittedVal(form.Scope, models.ScopeRead, models.ScopeWrite), "scope", "This field must be either: read, write")
+
+	if !form.Valid() {
+		app.renderTokens(w, r, http.StatusUnprocessableEntity, form, "")
+		return
+	}
+
+	plaintext, err := app.tokenModel.New(app.authenticatedUserID(r), form.Name, form.Scope)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	// the plaintext is never stored with the token, the session only holds it
+	// until tokenList shows it
+	app.sessionManager.Put(r.Context(), "newToken", plaintext)
+	http.Redirect(w, r, "/account/tokens", http.StatusSeeOther)
+}
+
+func (app *Application) tokenRevokePost(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil || id < 1 {
+		app.notFound(w)
+		return
+	}
+
+	err = app.tokenModel.Revoke(app.authenticatedUserID(r), id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Token revoked")
+	http.Redirect(w, r, "/account/tokens", http.StatusSeeOther)
+}
+
+func (app *Application) renderTokens(w http.ResponseWriter, r *http.Request, status int, form TokenForm, newToken string) {
+	tokens, err := app.tokenModel.ForUser(app.authenticatedUserID(r))
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Tokens = tokens
+	data.NewToken = newToken
+	data.Form = form
+	app.render(w, status, "tokens.tmpl.html", &data)
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"regexp"
+	"snippetbox-n/internal/assert"
+	"snippetbox-n/internal/models"
+	"testing"
+)
+
+func TestTokenCreateShownOnce(t *testing.T) {
+	app, _ := newTestApplicationDB(t)
+	id := insertUser(t, app, "Alice", "alice@example.com", "pa$$word1234")
+
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+	ts.login(t, "alice@example.com", "pa$$word1234")
+
+	code, header, _ := ts.postForm(t, "/account/tokens", url.Values{"name": {"laptop"}, "scope": {models.ScopeRead}})
+	assert.Equal(t, code, http.StatusSeeOther)
+	assert.Equal(t, header.Get("Location"), "/account/tokens")
+
+	tokenRX := regexp.MustCompile(`<code class='token'>(sb_[^<]+)</code>`)
+	_, _, body := ts.get(t, "/account/tokens")
+	matches := tokenRX.FindStringSubmatch(body)
+	if len(matches) < 2 {
+		t.Fatal("new token not shown")
+	}
+	_, err := app.tokenModel.Authenticate(matches[1])
+	assert.Equal(t, err, nil)
+
+	// reloading neither shows it again nor makes another
+	_, _, body = ts.get(t, "/account/tokens")
+	assert.Equal(t, tokenRX.MatchString(body), false)
+
+	tokens, err := app.tokenModel.ForUser(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, len(tokens), 1)
+}
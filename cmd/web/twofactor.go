@@ -0,0 +1,376 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"snippetbox-n/internal/models"
+	"snippetbox-n/internal/totp"
+	"snippetbox-n/internal/validator"
+	"strings"
+	"time"
+
+	"github.com/skip2/go-qrcode"
+)
+
+const (
+	totpIssuer = "Snippetbox"
+
+	// twoFactorTimeout is how long a password check stays good for while
+	// waiting for the second step of a login
+	twoFactorTimeout = 5 * time.Minute
+	// maxTwoFactorAttempts is how many wrong codes end a login, the user has
+	// to enter their password again after that
+	maxTwoFactorAttempts = 5
+)
+
+type TwoFactorForm struct {
+	Code                string `form:"code"`
+	Password            string `form:"password"`
+	validator.Validator `form:"-"`
+}
+
+// startTwoFactor holds a login whose password checked out until the second
+// step is done. Nothing is authenticated yet, authenticate only looks at
+// "authenticatedUser".
+func (app *Application) startTwoFactor(r *http.Request, id int, remember bool) error {
+	err := app.sessionManager.RenewToken(r.Context())
+	if err != nil {
+		return err
+	}
+
+	app.sessionManager.Put(r.Context(), "twoFactorUser", id)
+	app.sessionManager.Put(r.Context(), "twoFactorStarted", time.Now().Unix())
+	app.sessionManager.Put(r.Context(), "twoFactorAttempts", 0)
+	app.sessionManager.Put(r.Context(), "twoFactorRemember", remember)
+	return nil
+}
+
+// pendingTwoFactor returns the user waiting on the second login step, or 0
+// when there is none or it has timed out
+func (app *Application) pendingTwoFactor(r *http.Request) int {
+	started := time.Unix(app.sessionManager.GetInt64(r.Context(), "twoFactorStarted"), 0)
+	if time.Since(started) > twoFactorTimeout {
+		return 0
+	}
+	return app.sessionManager.GetInt(r.Context(), "twoFactorUser")
+}
+
+func (app *Application) endTwoFactor(r *http.Request) {
+	app.sessionManager.Remove(r.Context(), "twoFactorUser")
+	app.sessionManager.Remove(r.Context(), "twoFactorStarted")
+	app.sessionManager.Remove(r.Context(), "twoFactorAttempts")
+	app.sessionManager.Remove(r.Context(), "twoFactorRemember")
+}
+
+func (app *Application) userLoginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	if app.pendingTwoFactor(r) == 0 {
+		http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Form = TwoFactorForm{}
+	app.render(w, http.StatusOK, "login_2fa.tmpl.html", &data)
+}
+
+func (app *Application) userLoginTwoFactorPost(w http.ResponseWriter, r *http.Request) {
+	id := app.pendingTwoFactor(r)
+	if id == 0 {
+		app.endTwoFactor(r)
+		app.sessionManager.Put(r.Context(), "flash", "Your login timed out, please log in again")
+		http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	var form TwoFactorForm
+	err = app.formDecoder.Decode(&form, r.PostForm)
+	if err != nil {
+		app.clientError(w, http.StatusUnprocessableEntity)
+		return
+	}
+
+	form.CheckField(validator.NotBlank(form.Code), "code", "This field cannot be blank")
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, http.StatusUnprocessableEntity, "login_2fa.tmpl.html", &data)
+		return
+	}
+
+	user, err := app.userModel.Get(id)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	// codes count towards the same limits as passwords
+	if wait := app.loginWait(r, user.Email); wait > 0 {
+		form.AddFieldError("code", (&loginPausedError{wait: wait}).Error())
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, http.StatusTooManyRequests, "login_2fa.tmpl.html", &data)
+		return
+	}
+
+	ok, recovery, err := app.checkSecondFactor(id, form.Code)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	if !ok {
+		app.loginFailed(r, user.Email)
+		attempts := app.sessionManager.GetInt(r.Context(), "twoFactorAttempts") + 1
+		if attempts >= maxTwoFactorAttempts {
+			app.endTwoFactor(r)
+			app.sessionManager.Put(r.Context(), "flash", "Too many incorrect codes, please log in again")
+			http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+			return
+		}
+		app.sessionManager.Put(r.Context(), "twoFactorAttempts", attempts)
+
+		form.AddFieldError("code", "That code is incorrect")
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, http.StatusUnprocessableEntity, "login_2fa.tmpl.html", &data)
+		return
+	}
+
+	remember := app.sessionManager.GetBool(r.Context(), "twoFactorRemember")
+	app.endTwoFactor(r)
+	err = app.logIn(r, id, remember)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	app.loginSucceeded(user.Email)
+
+	if recovery {
+		left, err := app.twoFactorModel.RecoveryCodesLeft(id)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+		app.sessionManager.Put(r.Context(), "flash", fmt.Sprintf("You used a recovery code, you have %d left", left))
+	}
+
+	http.Redirect(w, r, "/snippet/create", http.StatusSeeOther)
+}
+
+// checkSecondFactor accepts either a current authenticator code or one of the
+// user's recovery codes, reporting which it was
+func (app *Application) checkSecondFactor(id int, code string) (ok, recovery bool, err error) {
+	secret, err := app.twoFactorModel.Secret(id)
+	if err != nil || secret == "" {
+		return false, false, err
+	}
+
+	code = strings.TrimSpace(code)
+	if step, valid := totp.Validate(secret, code, time.Now()); valid {
+		err = app.twoFactorModel.UseStep(id, step)
+		if errors.Is(err, models.ErrCodeReused) {
+			return false, false, nil
+		}
+		return err == nil, false, err
+	}
+
+	err = app.twoFactorModel.UseRecoveryCode(id, code)
+	if errors.Is(err, models.ErrNoRecord) {
+		return false, false, nil
+	}
+	return err == nil, true, err
+}
+
+func (app *Application) twoFactor(w http.ResponseWriter, r *http.Request) {
+	app.renderTwoFactor(w, r, http.StatusOK, TwoFactorForm{})
+}
+
+// twoFactorQR serves the enrollment QR code as an image, the content security
+// policy doesn't allow data: URLs
+func (app *Application) twoFactorQR(w http.ResponseWriter, r *http.Request) {
+	secret := app.sessionManager.GetString(r.Context(), "totpPending")
+	if secret == "" {
+		app.notFound(w)
+		return
+	}
+
+	user, err := app.userModel.Get(app.authenticatedUserID(r))
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	png, err := qrcode.Encode(totp.URL(totpIssuer, user.Email, secret), qrcode.Medium, 256)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(png)
+}
+
+func (app *Application) twoFactorEnablePost(w http.ResponseWriter, r *http.Request) {
+	form, ok := app.twoFactorPassword(w, r)
+	if !ok {
+		return
+	}
+
+	secret := app.sessionManager.GetString(r.Context(), "totpPending")
+	step, ok := totp.Validate(secret, form.Code, time.Now())
+	form.CheckField(secret != "" && ok, "code", "That code is incorrect, check your device's clock is right")
+
+	if !form.Valid() {
+		app.renderTwoFactor(w, r, http.StatusUnprocessableEntity, form)
+		return
+	}
+
+	id := app.authenticatedUserID(r)
+	codes, err := app.twoFactorModel.Enable(id, secret)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	// the code just used to confirm can't then be used to log in
+	err = app.twoFactorModel.UseStep(id, step)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.sessionManager.Remove(r.Context(), "totpPending")
+	err = app.sessionManager.RenewToken(r.Context())
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.showRecoveryCodes(w, r, codes)
+}
+
+func (app *Application) twoFactorDisablePost(w http.ResponseWriter, r *http.Request) {
+	if _, ok := app.twoFactorPassword(w, r); !ok {
+		return
+	}
+
+	err := app.twoFactorModel.Disable(app.authenticatedUserID(r))
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Two-factor authentication has been turned off")
+	http.Redirect(w, r, "/account/2fa", http.StatusSeeOther)
+}
+
+func (app *Application) twoFactorRecoveryPost(w http.ResponseWriter, r *http.Request) {
+	if _, ok := app.twoFactorPassword(w, r); !ok {
+		return
+	}
+
+	codes, err := app.twoFactorModel.NewRecoveryCodes(app.authenticatedUserID(r))
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.showRecoveryCodes(w, r, codes)
+}
+
+// showRecoveryCodes keeps new recovery codes in the session and redirects to
+// the settings page, which shows them once
+func (app *Application) showRecoveryCodes(w http.ResponseWriter, r *http.Request, codes []string) {
+	app.sessionManager.Put(r.Context(), "recoveryCodes", strings.Join(codes, " "))
+	http.Redirect(w, r, "/account/2fa", http.StatusSeeOther)
+}
+
+// twoFactorPassword checks the password confirming a change to two factor
+// settings, re-rendering the page itself when it's wrong. The decoded form is
+// returned for the rest of the change.
+func (app *Application) twoFactorPassword(w http.ResponseWriter, r *http.Request) (TwoFactorForm, bool) {
+	var form TwoFactorForm
+
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return form, false
+	}
+
+	err = app.formDecoder.Decode(&form, r.PostForm)
+	if err != nil {
+		app.clientError(w, http.StatusUnprocessableEntity)
+		return form, false
+	}
+
+	form.CheckField(validator.NotBlank(form.Password), "password", "This field cannot be blank")
+	if !form.Valid() {
+		app.renderTwoFactor(w, r, http.StatusUnprocessableEntity, form)
+		return form, false
+	}
+
+	user, err := app.userModel.Get(app.authenticatedUserID(r))
+	if err != nil {
+		app.serverError(w, err)
+		return form, false
+	}
+
+	_, err = app.checkPassword(r, user.Email, form.Password)
+	if err != nil {
+		msg, status, ok := passwordRefused(err, "Your password is incorrect")
+		if !ok {
+			app.serverError(w, err)
+			return form, false
+		}
+		form.AddFieldError("password", msg)
+		app.renderTwoFactor(w, r, status, form)
+		return form, false
+	}
+	return form, true
+}
+
+// renderTwoFactor shows the two factor settings page, with any recovery codes
+// just made. Users without it turned on get a pending secret, kept in their
+// session until they confirm it.
+func (app *Application) renderTwoFactor(w http.ResponseWriter, r *http.Request, status int, form TwoFactorForm) {
+	id := app.authenticatedUserID(r)
+	user, err := app.userModel.Get(id)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.User = user
+	data.Form = form
+	data.RecoveryCodes = strings.Fields(app.sessionManager.PopString(r.Context(), "recoveryCodes"))
+
+	if user.TwoFactor {
+		data.RecoveryLeft, err = app.twoFactorModel.RecoveryCodesLeft(id)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+	} else {
+		secret := app.sessionManager.GetString(r.Context(), "totpPending")
+		if secret == "" {
+			secret, err = totp.NewSecret()
+			if err != nil {
+				app.serverError(w, err)
+				return
+			}
+			app.sessionManager.Put(r.Context(), "totpPending", secret)
+		}
+		data.TOTPSecret = secret
+	}
+
+	app.render(w, status, "two_factor.tmpl.html", &data)
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"regexp"
+	"snippetbox-n/internal/assert"
+	"snippetbox-n/internal/totp"
+	"strings"
+	"testing"
+	"time"
+)
+
+var (
+	totpSecretRX   = regexp.MustCompile(`Key: <code class='token'>([A-Z2-7]+)</code>`)
+	recoveryCodeRX = regexp.MustCompile(`<li><code>([^<]+)</code></li>`)
+)
+
+func TestTwoFactorEnable(t *testing.T) {
+	app, _ := newTestApplicationDB(t)
+	id := insertUser(t, app, "Alice", "alice@example.com", "pa$$word1234")
+
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+	ts.login(t, "alice@example.com", "pa$$word1234")
+
+	_, _, body := ts.get(t, "/account/2fa")
+	match := totpSecretRX.FindStringSubmatch(body)
+	if match == nil {
+		t.Fatal("no pending secret on the settings page")
+	}
+	code, err := totp.Code(match[1], totp.Step(time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a code alone isn't enough, the password has to be given as well
+	for _, password := range []string{"", "wrong password"} {
+		status, _, _ := ts.postForm(t, "/account/2fa/enable", url.Values{"code": {code}, "password": {password}})
+		assert.Equal(t, status, http.StatusUnprocessableEntity)
+	}
+	user, err := app.userModel.Get(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, user.TwoFactor, false)
+
+	status, header, _ := ts.postForm(t, "/account/2fa/enable", url.Values{"code": {code}, "password": {"pa$$word1234"}})
+	assert.Equal(t, status, http.StatusSeeOther)
+	assert.Equal(t, header.Get("Location"), "/account/2fa")
+
+	// the recovery codes are shown once
+	_, _, body = ts.get(t, "/account/2fa")
+	assert.Equal(t, len(recoveryCodeRX.FindAllString(body, -1)), 10)
+	_, _, body = ts.get(t, "/account/2fa")
+	assert.Equal(t, len(recoveryCodeRX.FindAllString(body, -1)), 0)
+
+	status, header, _ = ts.postForm(t, "/account/2fa/recovery", url.Values{"password": {"pa$$word1234"}})
+	assert.Equal(t, status, http.StatusSeeOther)
+	assert.Equal(t, header.Get("Location"), "/account/2fa")
+	_, _, body = ts.get(t, "/account/2fa")
+	assert.Equal(t, len(recoveryCodeRX.FindAllString(body, -1)), 10)
+}
+
+func TestLoginTwoFactor(t *testing.T) {
+	app, _ := newTestApplicationDB(t)
+	id := insertUser(t, app, "Alice", "alice@example.com", "pa$$word1234")
+
+	secret, err := totp.NewSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	recoveryCodes, err := app.twoFactorModel.Enable(id, secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	password := url.Values{"email": {"alice@example.com"}, "password": {"pa$$word1234"}}
+
+	t.Run("No pending login", func(t *testing.T) {
+		ts := newTestServer(t, app.routes())
+		defer ts.Close()
+
+		code, header, _ := ts.get(t, "/user/login/2fa")
+		assert.Equal(t, code, http.StatusSeeOther)
+		assert.Equal(t, header.Get("Location"), "/user/login")
+	})
+
+	t.Run("Authenticator code", func(t *testing.T) {
+		ts := newTestServer(t, app.routes())
+		defer ts.Close()
+
+		code, header, _ := ts.postForm(t, "/user/login", password)
+		assert.Equal(t, code, http.StatusSeeOther)
+		assert.Equal(t, header.Get("Location"), "/user/login/2fa")
+
+		// the password alone doesn't log in
+		code, header, _ = ts.get(t, "/account")
+		assert.Equal(t, code, http.StatusSeeOther)
+		assert.Equal(t, header.Get("Location"), "/user/login")
+
+		code, _, body := ts.get(t, "/user/login/2fa")
+		assert.Equal(t, code, http.StatusOK)
+		assert.Equal(t, strings.Contains(body, "name='code'"), true)
+
+		code, _, body = ts.postForm(t, "/user/login/2fa", url.Values{"code": {"000000"}})
+		assert.Equal(t, code, http.StatusUnprocessableEntity)
+		assert.Equal(t, strings.Contains(body, "That code is incorrect"), true)
+
+		right, err := totp.Code(secret, totp.Step(time.Now()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		code, header, _ = ts.postForm(t, "/user/login/2fa", url.Values{"code": {right}})
+		assert.Equal(t, code, http.StatusSeeOther)
+		assert.Equal(t, header.Get("Location"), "/snippet/create")
+
+		code, _, _ = ts.get(t, "/account")
+		assert.Equal(t, code, http.StatusOK)
+	})
+
+	t.Run("Recovery code", func(t *testing.T) {
+		// each recovery code works only once
+		for _, want := range []int{http.StatusSeeOther, http.StatusUnprocessableEntity} {
+			ts := newTestServer(t, app.routes())
+
+			ts.postForm(t, "/user/login", password)
+			code, _, _ := ts.postForm(t, "/user/login/2fa", url.Values{"code": {recoveryCodes[0]}})
+			ts.Close()
+
+			assert.Equal(t, code, want)
+		}
+	})
+}
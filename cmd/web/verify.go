@@ -0,0 +1,164 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"snippetbox-n/internal/mailer"
+	"snippetbox-n/internal/models"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// verifyLinkTTL is how long an emailed verification link stays usable
+const verifyLinkTTL = 48 * time.Hour
+
+var errInvalidVerifyToken = errors.New("invalid or expired verification token")
+
+// signEmail makes the token put in verification links: "<user id>.<expiry>.<mac>".
+// The mac covers the address too, so links stop working once the address
+// they were sent to is changed.
+func signEmail(secret []byte, id int, email string, expires time.Time) string {
+	return fmt.Sprintf("%d.%d.%s", id, expires.Unix(), emailMAC(secret, id, email, expires.Unix()))
+}
+
+// parseEmailToken returns the user and expiry a well formed, unexpired
+// verification token names. The mac is checked separately by
+// emailTokenMatches, once the user's current address is known.
+func parseEmailToken(token string, now time.Time) (int, time.Time, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return 0, time.Time{}, errInvalidVerifyToken
+	}
+
+	id, err := strconv.Atoi(parts[0])
+	if err != nil || id < 1 {
+		return 0, time.Time{}, errInvalidVerifyToken
+	}
+	unix, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || now.Unix() > unix {
+		return 0, time.Time{}, errInvalidVerifyToken
+	}
+	return id, time.Unix(unix, 0), nil
+}
+
+func emailTokenMatches(secret []byte, token string, id int, email string, expires time.Time) bool {
+	return hmac.Equal([]byte(token), []byte(signEmail(secret, id, email, expires)))
+}
+
+func emailMAC(secret []byte, id int, email string, expires int64) string {
+	mac := hmac.New(sha256.New, secret)
+	fmt.Fprintf(mac, "verify-email\x00%d\x00%s\x00%d", id, email, expires)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (app *Application) sendVerification(user models.User) {
+	token := signEmail(app.secret, user.ID, user.Email, time.Now().Add(verifyLinkTTL))
+	app.sendMail(mailer.Message{
+		To:      user.Email,
+		Subject: "Confirm your Snippetbox email address",
+		Body: fmt.Sprintf("Hi %s,\n\nPlease confirm this is your email address by following the link below "+
+			"within the next two days:\n\n%s/user/verify/%s\n\n"+
+			"If you didn't sign up for Snippetbox, you can ignore this email.\n",
+			user.Name, app.baseURL, token),
+	})
+}
+
+// emailVerified reports whether the request's user may do things restricted
+// to verified addresses. Anonymous requests, and everyone when the policy
+// allows it, pass.
+func (app *Application) emailVerified(r *http.Request) (bool, error) {
+	id := app.authenticatedUserID(r)
+	if !app.verifiedOnly || id == 0 {
+		return true, nil
+	}
+
+	user, err := app.userModel.Get(id)
+	if err != nil {
+		return false, err
+	}
+	return user.EmailVerified, nil
+}
+
+func (app *Application) userVerify(w http.ResponseWriter, r *http.Request) {
+	user, err := app.userModel.Get(app.authenticatedUserID(r))
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	if user.EmailVerified {
+		app.sessionManager.Put(r.Context(), "flash", "Your email address is already verified")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.User = user
+	app.render(w, http.StatusOK, "verify.tmpl.html", &data)
+}
+
+// userVerifyPost sends the verification link again
+func (app *Application) userVerifyPost(w http.ResponseWriter, r *http.Request) {
+	user, err := app.userModel.Get(app.authenticatedUserID(r))
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	if !user.EmailVerified {
+		app.sendVerification(user)
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", fmt.Sprintf("We've sent a new verification link to %s", user.Email))
+	http.Redirect(w, r, "/user/verify", http.StatusSeeOther)
+}
+
+// userVerifyConfirm handles the emailed link, it works without being logged
+// in so the link can be opened on any device
+func (app *Application) userVerifyConfirm(w http.ResponseWriter, r *http.Request) {
+	token := httprouter.ParamsFromContext(r.Context()).ByName("token")
+
+	id, expires, err := parseEmailToken(token, time.Now())
+	if err != nil {
+		app.verifyFailed(w, r)
+		return
+	}
+
+	user, err := app.userModel.Get(id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.verifyFailed(w, r)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	if !emailTokenMatches(app.secret, token, user.ID, user.Email, expires) {
+		app.verifyFailed(w, r)
+		return
+	}
+
+	if !user.EmailVerified {
+		err = app.userModel.VerifyEmail(user.ID)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Thanks, your email address is verified")
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+func (app *Application) verifyFailed(w http.ResponseWriter, r *http.Request) {
+	app.sessionManager.Put(r.Context(), "flash", "That verification link is invalid or has expired, log in to get a new one")
+	http.Redirect(w, r, "/user/verify", http.StatusSeeOther)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"snippetbox-n/internal/assert"
+	"testing"
+	"time"
+)
+
+func TestEmailToken(t *testing.T) {
+	secret := []byte("test secret")
+	now := time.Date(2024, 3, 17, 10, 15, 0, 0, time.UTC)
+	token := signEmail(secret, 7, "alice@example.com", now.Add(verifyLinkTTL))
+
+	tests := []struct {
+		name      string
+		token     string
+		secret    []byte
+		email     string
+		at        time.Time
+		wantValid bool
+	}{
+		{
+			name:      "Valid",
+			token:     token,
+			secret:    secret,
+			email:     "alice@example.com",
+			at:        now,
+			wantValid: true,
+		},
+		{
+			name:   "Expired",
+			token:  token,
+			secret: secret,
+			email:  "alice@example.com",
+			at:     now.Add(verifyLinkTTL + time.Second),
+		},
+		{
+			name:   "Changed email",
+			token:  token,
+			secret: secret,
+			email:  "alice@example.org",
+			at:     now,
+		},
+		{
+			name:   "Other secret",
+			token:  token,
+			secret: []byte("another secret"),
+			email:  "alice@example.com",
+			at:     now,
+		},
+		{
+			name:   "Other user",
+			token:  "8" + token[1:],
+			secret: secret,
+			email:  "alice@example.com",
+			at:     now,
+		},
+		{
+			name:   "Malformed",
+			token:  "7.abc",
+			secret: secret,
+			email:  "alice@example.com",
+			at:     now,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, expires, err := parseEmailToken(tt.token, tt.at)
+			valid := err == nil && emailTokenMatches(tt.secret, tt.token, id, tt.email, expires)
+			assert.Equal(t, valid, tt.wantValid)
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	viewFlushInterval = time.Minute
+	viewRepeatWindow  = time.Hour //a viewer seeing a snippet again within this isn't counted
+	trendingLimit     = 20
+	trendingWindow    = 7 * 24 * time.Hour
+	trendingHalfLife  = 24 * time.Hour
+)
+
+type viewStore interface {
+	Add(counts map[int]int, at time.Time) error
+}
+
+// viewCounter buffers snippet views in memory so snippetView never waits on the
+// database, run writes the buffer out periodically and main once more on
+// shutdown. Views still buffered when the process crashes are lost. Repeat
+// views by the same viewer within viewRepeatWindow are remembered here too,
+// rather than in the session, so counting a view never writes one.
+type viewCounter struct {
+	mu     sync.Mutex
+	counts map[int]int
+	seen   map[viewKey]time.Time //when each viewer last had a view counted
+	store  viewStore
+}
+
+type viewKey struct {
+	viewer string
+	id     int
+}
+
+func newViewCounter(store viewStore) *viewCounter {
+	return &viewCounter{counts: make(map[int]int), seen: make(map[viewKey]time.Time), store: store}
+}
+
+// record counts a view of snippet id by viewer, unless viewer had one counted
+// within viewRepeatWindow
+func (c *viewCounter) record(viewer string, id int) {
+	now := time.Now()
+	key := viewKey{viewer, id}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if last, ok := c.seen[key]; ok && now.Sub(last) < viewRepeatWindow {
+		return
+	}
+	c.seen[key] = now
+	c.counts[id]++
+}
+
+// forget drops viewers whose window has passed, so the map doesn't keep
+// growing
+func (c *viewCounter) forget(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, last := range c.seen {
+		if now.Sub(last) >= viewRepeatWindow {
+			delete(c.seen, key)
+		}
+	}
+}
+
+// flush hands the buffered counts to the store, on failure they are merged back
+// in to be retried on the next flush
+func (c *viewCounter) flush() error {
+	c.mu.Lock()
+	counts := c.counts
+	c.counts = make(map[int]int)
+	c.mu.Unlock()
+
+	if len(counts) == 0 {
+		return nil
+	}
+
+	err := c.store.Add(counts, time.Now())
+	if err != nil {
+		c.mu.Lock()
+		for id, n := range counts {
+			c.counts[id] += n
+		}
+		c.mu.Unlock()
+	}
+	return err
+}
+
+func (c *viewCounter) run(interval time.Duration, errorLog *log.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		if err := c.flush(); err != nil {
+			errorLog.Print(err)
+		}
+		c.forget(now)
+	}
+}
+
+// recordView counts a view of the snippet. Viewers are told apart by user when
+// logged in, by IP otherwise.
+func (app *Application) recordView(r *http.Request, id int) {
+	viewer := "ip:" + clientIP(r)
+	if userID := app.authenticatedUserID(r); userID != 0 {
+		viewer = fmt.Sprintf("user:%d", userID)
+	}
+	app.viewCounter.record(viewer, id)
+}
+
+func (app *Application) trending(w http.ResponseWriter, r *http.Request) {
+	snippets, err := app.viewModel.Trending(trendingLimit, trendingWindow, trendingHalfLife)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Trending = snippets
+	app.render(w, http.StatusOK, "trending.tmpl.html", &data)
+}
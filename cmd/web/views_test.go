@@ -0,0 +1,73 @@
+package main
+
+import (
+	"errors"
+	"snippetbox-n/internal/assert"
+	"testing"
+	"time"
+)
+
+type fakeViewStore struct {
+	calls  int
+	counts map[int]int
+	err    error
+}
+
+func (s *fakeViewStore) Add(counts map[int]int, at time.Time) error {
+	s.calls++
+	if s.err != nil {
+		return s.err
+	}
+	s.counts = counts
+	return nil
+}
+
+func TestViewCounterFlush(t *testing.T) {
+	store := &fakeViewStore{}
+	c := newViewCounter(store)
+
+	c.record("ip:203.0.113.7", 1)
+	c.record("ip:203.0.113.8", 1)
+	c.record("ip:203.0.113.7", 2)
+
+	err := c.flush()
+	assert.Equal(t, err, nil)
+	assert.Equal(t, store.calls, 1)
+	assert.Equal(t, store.counts[1], 2)
+	assert.Equal(t, store.counts[2], 1)
+
+	err = c.flush()
+	assert.Equal(t, err, nil)
+	assert.Equal(t, store.calls, 1)
+}
+
+func TestViewCounterFlushFailure(t *testing.T) {
+	store := &fakeViewStore{err: errors.New("database is down")}
+	c := newViewCounter(store)
+
+	c.record("ip:203.0.113.7", 1)
+	err := c.flush()
+	assert.Equal(t, err, store.err)
+
+	c.record("ip:203.0.113.8", 1)
+	store.err = nil
+	err = c.flush()
+	assert.Equal(t, err, nil)
+	assert.Equal(t, store.counts[1], 2)
+}
+
+func TestViewCounterRepeats(t *testing.T) {
+	store := &fakeViewStore{}
+	c := newViewCounter(store)
+
+	c.record("user:1", 1)
+	c.record("user:1", 1)
+	c.record("user:2", 1)
+	assert.Equal(t, c.counts[1], 2)
+
+	// forgotten once the window has passed, and counted again
+	c.forget(time.Now().Add(viewRepeatWindow))
+	assert.Equal(t, len(c.seen), 0)
+	c.record("user:1", 1)
+	assert.Equal(t, c.counts[1], 3)
+}
@@ -0,0 +1,38 @@
+// Package auth checks the email and password a user logs in with, against
+// the local users table or an external directory.
+package auth
+
+import (
+	"errors"
+	"snippetbox-n/internal/models"
+)
+
+// Authenticator checks a user's credentials, returning their local user id.
+// Wrong credentials are reported as models.ErrInvalidCredentails.
+// *models.UserModel is the local Authenticator.
+type Authenticator interface {
+	Authenticate(email, password string) (int, error)
+}
+
+// Chain tries each Authenticator in turn, the first to accept the credentials
+// wins. An Authenticator that fails for some other reason, say its directory
+// is down, doesn't stop the rest from being tried.
+type Chain []Authenticator
+
+func (c Chain) Authenticate(email, password string) (int, error) {
+	var failed error
+	for _, a := range c {
+		id, err := a.Authenticate(email, password)
+		if err == nil {
+			return id, nil
+		}
+		if !errors.Is(err, models.ErrInvalidCredentails) && failed == nil {
+			failed = err
+		}
+	}
+
+	if failed != nil {
+		return 0, failed
+	}
+	return 0, models.ErrInvalidCredentails
+}
@@ -0,0 +1,151 @@
+package auth
+
+import (
+	"errors"
+	"snippetbox-n/internal/assert"
+	"snippetbox-n/internal/models"
+	"snippetbox-n/internal/testdb"
+	"testing"
+	"time"
+)
+
+// fixed accepts one password, or fails with err when it's set
+type fixed struct {
+	id       int
+	password string
+	err      error
+}
+
+func (f fixed) Authenticate(email, password string) (int, error) {
+	if f.err != nil {
+		return 0, f.err
+	}
+	if password != f.password {
+		return 0, models.ErrInvalidCredentails
+	}
+	return f.id, nil
+}
+
+func TestChain(t *testing.T) {
+	down := errors.New("directory unreachable")
+
+	tests := []struct {
+		name     string
+		chain    Chain
+		password string
+		wantID   int
+		wantErr  error
+	}{
+		{"First", Chain{fixed{id: 1, password: "a"}, fixed{id: 2, password: "b"}}, "a", 1, nil},
+		{"Second", Chain{fixed{id: 1, password: "a"}, fixed{id: 2, password: "b"}}, "b", 2, nil},
+		{"Neither", Chain{fixed{id: 1, password: "a"}, fixed{id: 2, password: "b"}}, "c", 0, models.ErrInvalidCredentails},
+		{"Past a failure", Chain{fixed{err: down}, fixed{id: 2, password: "b"}}, "b", 2, nil},
+		{"Failure reported", Chain{fixed{err: down}, fixed{id: 2, password: "b"}}, "c", 0, down},
+		{"Empty", Chain{}, "a", 0, models.ErrInvalidCredentails},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, err := tt.chain.Authenticate("alice@example.com", tt.password)
+			assert.Equal(t, id, tt.wantID)
+			assert.Equal(t, errors.Is(err, tt.wantErr), true)
+		})
+	}
+}
+
+func TestLDAPRoles(t *testing.T) {
+	l := &LDAP{RoleGroups: map[models.Role][]string{
+		models.RoleModerator: {"cn=mods,ou=groups,dc=example,dc=com", "cn=helpers,ou=groups,dc=example,dc=com"},
+		models.RoleAdmin:     {"cn=admins,ou=groups,dc=example,dc=com"},
+	}}
+
+	tests := []struct {
+		name   string
+		groups []string
+		want   models.Role
+	}{
+		{"Member", []string{"cn=staff,ou=groups,dc=example,dc=com", "cn=mods,ou=groups,dc=example,dc=com"}, models.RoleModerator},
+		{"Other case", []string{"CN=Helpers,OU=Groups,DC=example,DC=com"}, models.RoleModerator},
+		{"Highest wins", []string{"cn=mods,ou=groups,dc=example,dc=com", "cn=admins,ou=groups,dc=example,dc=com"}, models.RoleAdmin},
+		{"Not a member", []string{"cn=staff,ou=groups,dc=example,dc=com"}, models.RoleUser},
+		{"No groups", nil, models.RoleUser},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, l.role(tt.groups), tt.want)
+		})
+	}
+}
+
+func TestLDAPEmptyPassword(t *testing.T) {
+	l := &LDAP{URL: "ldap://127.0.0.1:1"}
+	_, err := l.Authenticate("alice@example.com", "")
+	assert.Equal(t, err, models.ErrInvalidCredentails)
+}
+
+func TestLDAPLocalUser(t *testing.T) {
+	db := testdb.New(t)
+	l := &LDAP{
+		Users:      &models.UserModel{DB: db},
+		Identities: &models.IdentityModel{DB: db},
+		Sessions:   &models.SessionModel{DB: db},
+	}
+
+	unverified, err := l.Users.Insert("Bob", "bob@example.com", "pa$$word1234")
+	if err != nil {
+		t.Fatal(err)
+	}
+	verified, err := l.Users.Insert("Alice", "alice@example.com", "pa$$word1234")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Users.VerifyEmail(verified); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Sessions.Insert(verified, "192.0.2.1", "test", time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	version, _, err := l.Users.SessionState(verified)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// someone who signed up with Bob's address can't have it taken over
+	_, err = l.localUser(ldapEntry{DN: "uid=bob,dc=example,dc=com", Email: "bob@example.com", Name: "Bob"})
+	assert.Equal(t, errors.Is(err, ErrUnverifiedEmail), true)
+	_, err = l.Identities.Get(IdentityProvider, "uid=bob,dc=example,dc=com")
+	assert.Equal(t, errors.Is(err, models.ErrNoRecord), true)
+	user, err := l.Users.Get(unverified)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, user.Directory, false)
+
+	// linking Alice's account logs it out everywhere
+	alice := ldapEntry{DN: "uid=alice,dc=example,dc=com", Email: "alice@example.com", Name: "Alice"}
+	id, err := l.localUser(alice)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, id, verified)
+
+	newVersion, _, err := l.Users.SessionState(verified)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, newVersion, version+1)
+	sessions, err := l.Sessions.ForUser(verified)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, len(sessions), 0)
+
+	// once linked the entry is found by its DN, without logging anyone out
+	id, err = l.localUser(alice)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, id, verified)
+	linkedVersion, _, err := l.Users.SessionState(verified)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, linkedVersion, newVersion)
+}
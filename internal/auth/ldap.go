@@ -0,0 +1,200 @@
+package auth
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"snippetbox-n/internal/models"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// IdentityProvider is the name LDAP accounts are linked to local users under
+const IdentityProvider = models.ProviderLDAP
+
+// LDAP authenticates against a directory by binding as the user. Users are
+// found by email, and get a local account linked to their directory entry the
+// first time they log in.
+type LDAP struct {
+	URL          string //ldap:// or ldaps://
+	StartTLS     bool   //upgrade an ldap:// connection before sending passwords
+	BindDN       string //searches anonymously when empty
+	BindPassword string
+	BaseDN       string
+	//UserFilter finds the entry for an email, %s is replaced by the escaped
+	//address
+	UserFilter string
+	//RoleGroups maps roles to the groups whose members have the role. Users
+	//get the highest role they hold, or models.RoleUser, but only when it is
+	//set; otherwise roles are left as they are.
+	RoleGroups map[models.Role][]string
+
+	Users      *models.UserModel
+	Identities *models.IdentityModel
+	Sessions   *models.SessionModel
+}
+
+// ldapEntry is what the directory knows about someone who logged in
+type ldapEntry struct {
+	DN     string
+	Email  string
+	Name   string
+	Groups []string
+}
+
+func (l *LDAP) Authenticate(email, password string) (int, error) {
+	// a simple bind with an empty password is an anonymous bind, which
+	// servers accept without checking anything
+	if email == "" || password == "" {
+		return 0, models.ErrInvalidCredentails
+	}
+
+	entry, err := l.bind(email, password)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := l.localUser(entry)
+	if err != nil {
+		return 0, err
+	}
+
+	user, err := l.Users.Get(id)
+	if err != nil {
+		return 0, err
+	}
+	if user.Disabled {
+		return 0, models.ErrInvalidCredentails
+	}
+
+	if l.RoleGroups != nil {
+		if err := l.Users.SetRole(id, l.role(entry.Groups)); err != nil {
+			return 0, err
+		}
+	}
+	return id, nil
+}
+
+// bind looks the user up and checks their password by binding as them
+func (l *LDAP) bind(email, password string) (ldapEntry, error) {
+	var entry ldapEntry
+
+	conn, err := ldap.DialURL(l.URL, ldap.DialWithDialer(&net.Dialer{Timeout: 5 * time.Second}))
+	if err != nil {
+		return entry, err
+	}
+	defer conn.Close()
+	conn.SetTimeout(5 * time.Second)
+
+	if l.StartTLS {
+		u, err := url.Parse(l.URL)
+		if err != nil {
+			return entry, err
+		}
+		if err := conn.StartTLS(&tls.Config{ServerName: u.Hostname()}); err != nil {
+			return entry, err
+		}
+	}
+
+	if l.BindDN != "" {
+		if err := conn.Bind(l.BindDN, l.BindPassword); err != nil {
+			return entry, fmt.Errorf("ldap: service bind: %w", err)
+		}
+	}
+
+	search := ldap.NewSearchRequest(
+		l.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, 10, false,
+		fmt.Sprintf(l.UserFilter, ldap.EscapeFilter(email)),
+		[]string{"mail", "cn", "displayName", "memberOf"},
+		nil,
+	)
+	result, err := conn.Search(search)
+	if err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) {
+			return entry, fmt.Errorf("ldap: more than one entry for %s", email)
+		}
+		return entry, err
+	}
+	if len(result.Entries) != 1 {
+		return entry, models.ErrInvalidCredentails
+	}
+
+	e := result.Entries[0]
+	if err := conn.Bind(e.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return entry, models.ErrInvalidCredentails
+		}
+		return entry, err
+	}
+
+	entry = ldapEntry{
+		DN:     e.DN,
+		Email:  e.GetAttributeValue("mail"),
+		Name:   e.GetAttributeValue("displayName"),
+		Groups: e.GetAttributeValues("memberOf"),
+	}
+	if entry.Email == "" {
+		entry.Email = email
+	}
+	if entry.Name == "" {
+		entry.Name = e.GetAttributeValue("cn")
+	}
+	if entry.Name == "" {
+		entry.Name, _, _ = strings.Cut(entry.Email, "@")
+	}
+	return entry, nil
+}
+
+// ErrUnverifiedEmail is returned when a directory entry's email belongs to a
+// local account that never verified it
+var ErrUnverifiedEmail = errors.New("auth: local account with the directory email is unverified")
+
+// localUser finds the user linked to a directory entry, linking one with the
+// same, verified email or creating one when there is none. Linking logs the
+// account out everywhere, the directory entry's owner takes it over.
+func (l *LDAP) localUser(entry ldapEntry) (int, error) {
+	id, err := l.Identities.Get(IdentityProvider, entry.DN)
+	if err == nil || !errors.Is(err, models.ErrNoRecord) {
+		return id, err
+	}
+
+	user, err := l.Users.GetByEmail(entry.Email)
+	if err == nil {
+		// anyone can sign up with an address they don't own, only link
+		// accounts whose owner has proved it's theirs
+		if !user.EmailVerified {
+			return 0, ErrUnverifiedEmail
+		}
+		if err := l.Identities.Link(user.ID, IdentityProvider, entry.DN); err != nil {
+			return 0, err
+		}
+		if err := l.Users.BumpSessionVersion(user.ID); err != nil {
+			return 0, err
+		}
+		return user.ID, l.Sessions.DeleteOthers(user.ID, 0)
+	}
+	if !errors.Is(err, models.ErrNoRecord) {
+		return 0, err
+	}
+	return l.Identities.Provision(IdentityProvider, entry.DN, entry.Name, entry.Email)
+}
+
+// role returns the highest role held through membership of groups. Group DNs
+// are compared ignoring case, as directories do.
+func (l *LDAP) role(groups []string) models.Role {
+	highest := models.RoleUser
+	for role, roleGroups := range l.RoleGroups {
+		for _, want := range roleGroups {
+			for _, g := range groups {
+				if strings.EqualFold(strings.TrimSpace(g), strings.TrimSpace(want)) && role.Has(highest) {
+					highest = role
+				}
+			}
+		}
+	}
+	return highest
+}
@@ -0,0 +1,79 @@
+// Package mailer sends the application's plain text emails.
+package mailer
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Sender delivers messages, SMTPSender in production and LogSender when
+// developing locally
+type Sender interface {
+	Send(msg Message) error
+}
+
+type SMTPSender struct {
+	Host     string
+	Port     int
+	Username string //no authentication when empty
+	Password string
+	From     string
+}
+
+func (s *SMTPSender) Send(msg Message) error {
+	var auth smtp.Auth
+	if s.Username != "" {
+		auth = smtp.PlainAuth("", s.Username, s.Password, s.Host)
+	}
+
+	addr := net.JoinHostPort(s.Host, strconv.Itoa(s.Port))
+	return smtp.SendMail(addr, auth, s.From, []string{msg.To}, format(s.From, msg, time.Now()))
+}
+
+// LogSender writes messages out instead of delivering them, links in them can
+// be followed straight from the log
+type LogSender struct {
+	mu   sync.Mutex
+	Out  io.Writer
+	From string
+}
+
+func (s *LogSender) Send(msg Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := fmt.Fprintf(s.Out, "%s\n", format(s.From, msg, time.Now()))
+	return err
+}
+
+// format renders msg as an RFC 5322 message with a UTF-8 plain text body
+func format(from string, msg Message, date time.Time) []byte {
+	var b bytes.Buffer
+
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+
+	body := strings.ReplaceAll(msg.Body, "\r\n", "\n")
+	b.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+
+	return b.Bytes()
+}
@@ -0,0 +1,46 @@
+package mailer
+
+import (
+	"bytes"
+	"snippetbox-n/internal/assert"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFormat(t *testing.T) {
+	msg := Message{
+		To:      "alice@example.com",
+		Subject: "Reset your password",
+		Body:    "Hi Alice,\nfollow the link.",
+	}
+	date := time.Date(2022, 3, 17, 10, 15, 0, 0, time.UTC)
+
+	want := "From: Snippetbox <no-reply@example.com>\r\n" +
+		"To: alice@example.com\r\n" +
+		"Subject: Reset your password\r\n" +
+		"Date: Thu, 17 Mar 2022 10:15:00 +0000\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: text/plain; charset=utf-8\r\n" +
+		"\r\n" +
+		"Hi Alice,\r\nfollow the link."
+
+	assert.Equal(t, string(format("Snippetbox <no-reply@example.com>", msg, date)), want)
+}
+
+func TestFormatEncodesSubject(t *testing.T) {
+	msg := Message{To: "bob@example.com", Subject: "Grüße"}
+	got := string(format("no-reply@example.com", msg, time.Now()))
+
+	assert.Equal(t, strings.Contains(got, "Subject: =?utf-8?q?Gr=C3=BC=C3=9Fe?=\r\n"), true)
+}
+
+func TestLogSender(t *testing.T) {
+	var buf bytes.Buffer
+	s := &LogSender{Out: &buf, From: "no-reply@example.com"}
+
+	err := s.Send(Message{To: "alice@example.com", Subject: "Hello", Body: "https://localhost:4000/"})
+	assert.Equal(t, err, nil)
+	assert.Equal(t, strings.Contains(buf.String(), "To: alice@example.com\r\n"), true)
+	assert.Equal(t, strings.HasSuffix(buf.String(), "\r\n\r\nhttps://localhost:4000/\n"), true)
+}
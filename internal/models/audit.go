@@ -0,0 +1,74 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Audited actions
+const (
+	AuditUserDisabled   = "user disabled"
+	AuditUserEnabled    = "user enabled"
+	AuditRoleChanged    = "role changed"
+	AuditPasswordReset  = "password reset"
+	AuditTwoFactorReset = "two-factor reset"
+	AuditSnippetDeleted = "snippet deleted"
+)
+
+// AuditEntry is one thing an operator did
+type AuditEntry struct {
+	ID         int
+	ActorID    int    //0 for snippetadmin, or an actor since deleted
+	ActorEmail string //empty when ActorID is 0
+	Action     string
+	Subject    string //what was acted on, as it was described at the time
+	IP         string
+	Created    time.Time
+}
+
+type AuditModel struct {
+	DB *sql.DB
+}
+
+// Record notes that actorID, 0 for snippetadmin, did action to subject. It's
+// called before the action is carried out, so an action can't happen without
+// its entry; at worst there's an entry for one that then failed.
+func (m *AuditModel) Record(actorID int, ip, action, subject string) error {
+	actor := sql.NullInt64{Int64: int64(actorID), Valid: actorID != 0}
+	stmt := `
+		INSERT INTO audit_log (actor_id, action, subject, ip, created)
+		VALUES(?, ?, ?, ?, UTC_TIMESTAMP())
+	`
+	_, err := m.DB.Exec(stmt, actor, action, truncate(subject, 255), ip)
+	return err
+}
+
+// Recent returns entries newest first
+func (m *AuditModel) Recent(limit, offset int) ([]AuditEntry, error) {
+	stmt := `
+		SELECT a.id, a.actor_id, COALESCE(u.email, ''), a.action, a.subject, a.ip, a.created
+		FROM audit_log a LEFT JOIN users u ON u.id = a.actor_id
+		ORDER BY a.id DESC LIMIT ? OFFSET ?
+	`
+	rows, err := m.DB.Query(stmt, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []AuditEntry{}
+	for rows.Next() {
+		var e AuditEntry
+		var actor sql.NullInt64
+		err := rows.Scan(&e.ID, &actor, &e.ActorEmail, &e.Action, &e.Subject, &e.IP, &e.Created)
+		if err != nil {
+			return nil, err
+		}
+		e.ActorID = int(actor.Int64)
+		entries = append(entries, e)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
@@ -0,0 +1,218 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/go-sql-driver/mysql"
+	"time"
+)
+
+const (
+	VisibilityPrivate = "private"
+	VisibilityPublic  = "public"
+)
+
+type Collection struct {
+	ID           int
+	UserID       int
+	Owner        string
+	Name         string
+	Visibility   string
+	Created      time.Time
+	SnippetCount int
+}
+
+type CollectionModel struct {
+	DB *sql.DB
+}
+
+func (m *CollectionModel) Insert(userID int, name, visibility string) (int, error) {
+	stmt := `
+		INSERT INTO collections (user_id, name, visibility, created)
+		VALUES(?, ?, ?, UTC_TIMESTAMP())
+	`
+	result, err := m.DB.Exec(stmt, userID, name, visibility)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return int(id), nil
+}
+
+func (m *CollectionModel) Get(id int) (Collection, error) {
+	stmt := `
+		SELECT c.id, c.user_id, u.name, c.name, c.visibility, c.created
+		FROM collections c INNER JOIN users u ON u.id = c.user_id
+		WHERE c.id = ?
+	`
+	var c Collection
+	err := m.DB.QueryRow(stmt, id).Scan(&c.ID, &c.UserID, &c.Owner, &c.Name, &c.Visibility, &c.Created)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Collection{}, ErrNoRecord
+		}
+		return Collection{}, err
+	}
+	return c, nil
+}
+
+// ForUser lists a user's collections, newest first, with the number of live
+// snippets in each
+func (m *CollectionModel) ForUser(userID int) ([]Collection, error) {
+	stmt := `
+		SELECT c.id, c.user_id, u.name, c.name, c.visibility, c.created, COUNT(s.id)
+		FROM collections c
+		INNER JOIN users u ON u.id = c.user_id
+		LEFT JOIN collection_snippets cs ON cs.collection_id = c.id
+		LEFT JOIN snippets s ON s.id = cs.snippet_id AND s.expires > UTC_TIMESTAMP()
+		WHERE c.user_id = ?
+		GROUP BY c.id, c.user_id, u.name, c.name, c.visibility, c.created
+		ORDER BY c.id DESC
+	`
+	rows, err := m.DB.Query(stmt, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	collections := []Collection{}
+	for rows.Next() {
+		var c Collection
+		err := rows.Scan(&c.ID, &c.UserID, &c.Owner, &c.Name, &c.Visibility, &c.Created, &c.SnippetCount)
+		if err != nil {
+			return nil, err
+		}
+		collections = append(collections, c)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return collections, nil
+}
+
+func (m *CollectionModel) Update(id int, name, visibility string) error {
+	stmt := `
+		UPDATE collections SET name = ?, visibility = ? WHERE id = ?
+	`
+	_, err := m.DB.Exec(stmt, name, visibility, id)
+	return err
+}
+
+func (m *CollectionModel) Delete(id int) error {
+	stmt := `
+		DELETE FROM collections WHERE id = ?
+	`
+	_, err := m.DB.Exec(stmt, id)
+	return err
+}
+
+// Snippets returns the live snippets in a collection in their manual order
+func (m *CollectionModel) Snippets(id int) ([]Snippet, error) {
+	stmt := `
+		SELECT s.id, s.title, s.content, s.created, s.expires
+		FROM collection_snippets cs INNER JOIN snippets s ON s.id = cs.snippet_id
+		WHERE cs.collection_id = ? AND s.expires > UTC_TIMESTAMP()
+		ORDER BY cs.position ASC
+	`
+	rows, err := m.DB.Query(stmt, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	snippets := []Snippet{}
+	for rows.Next() {
+		var s Snippet
+		err := rows.Scan(&s.ID, &s.Title, &s.Content, &s.Created, &s.Expires)
+		if err != nil {
+			return nil, err
+		}
+		snippets = append(snippets, s)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return snippets, nil
+}
+
+// AddSnippet appends a snippet to the end of a collection
+func (m *CollectionModel) AddSnippet(id, snippetID int) error {
+	stmt := `
+		INSERT INTO collection_snippets (collection_id, snippet_id, position)
+		SELECT ?, ?, COALESCE(MAX(position), 0) + 1 FROM collection_snippets WHERE collection_id = ?
+	`
+	_, err := m.DB.Exec(stmt, id, snippetID, id)
+	if err != nil {
+		var mySQLError *mysql.MySQLError
+		if errors.As(err, &mySQLError) && mySQLError.Number == 1062 {
+			return ErrDuplicateSnippet
+		}
+		return err
+	}
+	return nil
+}
+
+func (m *CollectionModel) RemoveSnippet(id, snippetID int) error {
+	stmt := `
+		DELETE FROM collection_snippets WHERE collection_id = ? AND snippet_id = ?
+	`
+	_, err := m.DB.Exec(stmt, id, snippetID)
+	return err
+}
+
+// MoveSnippet swaps a snippet with its neighbour above (up) or below it. Moving
+// the first snippet up or the last one down does nothing.
+func (m *CollectionModel) MoveSnippet(id, snippetID int, up bool) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var position int
+	stmt := `
+		SELECT position FROM collection_snippets
+		WHERE collection_id = ? AND snippet_id = ? FOR UPDATE
+	`
+	err = tx.QueryRow(stmt, id, snippetID).Scan(&position)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNoRecord
+		}
+		return err
+	}
+
+	stmt = `
+		SELECT snippet_id, position FROM collection_snippets
+		WHERE collection_id = ? AND position > ? ORDER BY position ASC LIMIT 1 FOR UPDATE
+	`
+	if up {
+		stmt = `
+			SELECT snippet_id, position FROM collection_snippets
+			WHERE collection_id = ? AND position < ? ORDER BY position DESC LIMIT 1 FOR UPDATE
+		`
+	}
+	var otherID, otherPosition int
+	err = tx.QueryRow(stmt, id, position).Scan(&otherID, &otherPosition)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return tx.Commit()
+		}
+		return err
+	}
+
+	stmt = `
+		UPDATE collection_snippets SET position = ? WHERE collection_id = ? AND snippet_id = ?
+	`
+	if _, err = tx.Exec(stmt, otherPosition, id, snippetID); err != nil {
+		return err
+	}
+	if _, err = tx.Exec(stmt, position, id, otherID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,30 @@
+package models
+
+import (
+	"snippetbox-n/internal/assert"
+	"snippetbox-n/internal/testdb"
+	"testing"
+)
+
+func TestCollectionAddSnippetDuplicate(t *testing.T) {
+	db := testdb.New(t)
+
+	users := &UserModel{DB: db}
+	userID, err := users.Insert("Alice", "alice@example.com", "pa$$word1234")
+	if err != nil {
+		t.Fatal(err)
+	}
+	snippetID, err := (&SnippetModel{DB: db}).Insert(userID, "First", "first", "", 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := &CollectionModel{DB: db}
+	id, err := m.Insert(userID, "Mine", VisibilityPrivate)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, m.AddSnippet(id, snippetID), nil)
+	assert.Equal(t, m.AddSnippet(id, snippetID), ErrDuplicateSnippet)
+}
@@ -0,0 +1,248 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// maxCommentDepth caps the nesting reported in Comment.Depth, replies deeper than
+// this are shown at the same indentation as their parent
+const maxCommentDepth = 5
+
+type Comment struct {
+	ID        int
+	SnippetID int
+	ParentID  int //0 for the root of a thread
+	ThreadID  int //id of the root comment, equal to ID for roots
+	UserID    int //0 once the author's account is deleted
+	Author    string
+	Content   string
+	Deleted   bool
+	Locked    bool
+	Created   time.Time
+	Edited    time.Time
+	Depth     int
+}
+
+type CommentModel struct {
+	DB *sql.DB
+}
+
+func (m *CommentModel) Insert(snippetID, parentID, userID int, content string) (int, error) {
+	var threadID sql.NullInt64
+	var parent sql.NullInt64
+
+	if parentID != 0 {
+		p, err := m.Get(parentID)
+		if err != nil {
+			return 0, err
+		}
+		if p.SnippetID != snippetID {
+			return 0, ErrNoRecord
+		}
+		if p.Locked {
+			return 0, ErrThreadLocked
+		}
+		parent = sql.NullInt64{Int64: int64(p.ID), Valid: true}
+		threadID = sql.NullInt64{Int64: int64(p.ThreadID), Valid: true}
+	}
+
+	stmt := `
+		INSERT INTO comments (snippet_id, parent_id, thread_id, user_id, content, created)
+		VALUES(?, ?, ?, ?, ?, UTC_TIMESTAMP())
+	`
+	result, err := m.DB.Exec(stmt, snippetID, parent, threadID, userID, content)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return int(id), nil
+}
+
+// Get returns a single comment, the lock state reported is that of its thread.
+// Comments on expired snippets are treated as missing.
+func (m *CommentModel) Get(id int) (Comment, error) {
+	stmt := `
+		SELECT c.id, c.snippet_id, c.parent_id, c.thread_id, c.user_id, u.name, c.content,
+			c.deleted, t.locked, c.created, c.edited
+		FROM comments c
+		LEFT JOIN users u ON u.id = c.user_id
+		INNER JOIN snippets s ON s.id = c.snippet_id
+		INNER JOIN comments t ON t.id = COALESCE(c.thread_id, c.id)
+		WHERE s.expires > UTC_TIMESTAMP() AND c.id = ?
+	`
+	c, err := scanComment(m.DB.QueryRow(stmt, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Comment{}, ErrNoRecord
+		}
+		return Comment{}, err
+	}
+	return c, nil
+}
+
+// ForSnippet returns every comment on a snippet in display order: each thread
+// root is followed by its replies, depth first, oldest first.
+func (m *CommentModel) ForSnippet(snippetID int) ([]Comment, error) {
+	stmt := `
+		SELECT c.id, c.snippet_id, c.parent_id, c.thread_id, c.user_id, u.name, c.content,
+			c.deleted, t.locked, c.created, c.edited
+		FROM comments c
+		LEFT JOIN users u ON u.id = c.user_id
+		INNER JOIN snippets s ON s.id = c.snippet_id
+		INNER JOIN comments t ON t.id = COALESCE(c.thread_id, c.id)
+		WHERE s.expires > UTC_TIMESTAMP() AND c.snippet_id = ?
+		ORDER BY c.id ASC
+	`
+	rows, err := m.DB.Query(stmt, snippetID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	comments := []Comment{}
+	for rows.Next() {
+		c, err := scanComment(rows)
+		if err != nil {
+			return nil, err
+		}
+		comments = append(comments, c)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return threadComments(comments), nil
+}
+
+// ForUser returns every comment a user has written, on live or expired
+// snippets, oldest first
+func (m *CommentModel) ForUser(userID int) ([]Comment, error) {
+	stmt := `
+		SELECT c.id, c.snippet_id, c.parent_id, c.thread_id, c.user_id, u.name, c.content,
+			c.deleted, t.locked, c.created, c.edited
+		FROM comments c
+		LEFT JOIN users u ON u.id = c.user_id
+		INNER JOIN comments t ON t.id = COALESCE(c.thread_id, c.id)
+		WHERE c.user_id = ?
+		ORDER BY c.id ASC
+	`
+	rows, err := m.DB.Query(stmt, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	comments := []Comment{}
+	for rows.Next() {
+		c, err := scanComment(rows)
+		if err != nil {
+			return nil, err
+		}
+		comments = append(comments, c)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return comments, nil
+}
+
+func (m *CommentModel) Update(id int, content string) error {
+	stmt := `
+		UPDATE comments SET content = ?, edited = UTC_TIMESTAMP()
+		WHERE id = ? AND deleted = FALSE
+	`
+	_, err := m.DB.Exec(stmt, content, id)
+	return err
+}
+
+// Delete blanks out a comment but keeps its row so the replies below it stay
+// attached to the thread
+func (m *CommentModel) Delete(id int) error {
+	stmt := `
+		UPDATE comments SET content = '', deleted = TRUE WHERE id = ?
+	`
+	_, err := m.DB.Exec(stmt, id)
+	return err
+}
+
+// DeleteThread removes the whole thread the comment belongs to, replies go with
+// the root through the parent_id cascade
+func (m *CommentModel) DeleteThread(id int) error {
+	c, err := m.Get(id)
+	if err != nil {
+		return err
+	}
+	stmt := `
+		DELETE FROM comments WHERE id = ?
+	`
+	_, err = m.DB.Exec(stmt, c.ThreadID)
+	return err
+}
+
+func (m *CommentModel) SetLocked(id int, locked bool) error {
+	c, err := m.Get(id)
+	if err != nil {
+		return err
+	}
+	stmt := `
+		UPDATE comments SET locked = ? WHERE id = ?
+	`
+	_, err = m.DB.Exec(stmt, locked, c.ThreadID)
+	return err
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanComment(row rowScanner) (Comment, error) {
+	var c Comment
+	var parentID, threadID, userID sql.NullInt64
+	var author sql.NullString
+	var edited sql.NullTime
+
+	err := row.Scan(&c.ID, &c.SnippetID, &parentID, &threadID, &userID, &author, &c.Content,
+		&c.Deleted, &c.Locked, &c.Created, &edited)
+	if err != nil {
+		return Comment{}, err
+	}
+
+	c.ParentID = int(parentID.Int64)
+	c.UserID = int(userID.Int64)
+	c.Author = author.String
+	c.ThreadID = c.ID
+	if threadID.Valid {
+		c.ThreadID = int(threadID.Int64)
+	}
+	if edited.Valid {
+		c.Edited = edited.Time
+	}
+	return c, nil
+}
+
+// threadComments orders a flat, id ordered list of comments so replies follow
+// their parent and fills in Depth
+func threadComments(comments []Comment) []Comment {
+	children := make(map[int][]Comment)
+	for _, c := range comments {
+		children[c.ParentID] = append(children[c.ParentID], c)
+	}
+
+	ordered := make([]Comment, 0, len(comments))
+	var walk func(parentID, depth int)
+	walk = func(parentID, depth int) {
+		for _, c := range children[parentID] {
+			c.Depth = min(depth, maxCommentDepth)
+			ordered = append(ordered, c)
+			walk(c.ID, depth+1)
+		}
+	}
+	walk(0, 0)
+
+	return ordered
+}
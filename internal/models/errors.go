@@ -6,3 +6,14 @@ import "errors"
 var ErrNoRecord = errors.New("Models: No matching record found")
 var ErrInvalidCredentails = errors.New("Models: Invalid Credentials")
 var ErrDuplicateEmail = errors.New("Models: Duplicate Email")
+
+// ErrThreadLocked is returned when replying to a thread a moderator has locked
+var ErrThreadLocked = errors.New("Models: Comment thread is locked")
+
+// ErrDuplicateSnippet is returned when adding a snippet to a collection it's
+// already in
+var ErrDuplicateSnippet = errors.New("Models: Snippet already in collection")
+
+// ErrCodeReused is returned for a one time code that has already been accepted
+var ErrCodeReused = errors.New("Models: One time code already used")
+var ErrDuplicatePasskey = errors.New("Models: Passkey already registered")
@@ -0,0 +1,130 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// ProviderLDAP is the provider directory accounts are linked under. The
+// directory manages their passwords, so they have no local one to check or
+// reset.
+const ProviderLDAP = "ldap"
+
+// Identity is a user's account at a provider
+type Identity struct {
+	Provider string
+	Subject  string
+	Created  time.Time
+}
+
+// IdentityModel links users to their accounts at OpenID Connect providers and
+// in the LDAP directory
+type IdentityModel struct {
+	DB *sql.DB
+}
+
+// Get returns the user linked to the provider's subject
+func (m *IdentityModel) Get(provider, subject string) (int, error) {
+	var userID int
+	stmt := `
+		SELECT user_id FROM user_identities WHERE provider = ? AND subject = ?
+	`
+	err := m.DB.QueryRow(stmt, provider, subject).Scan(&userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrNoRecord
+		}
+		return 0, err
+	}
+	return userID, nil
+}
+
+func (m *IdentityModel) Link(userID int, provider, subject string) error {
+	stmt := `
+		INSERT INTO user_identities (user_id, provider, subject, created)
+		VALUES(?, ?, ?, UTC_TIMESTAMP())
+	`
+	_, err := m.DB.Exec(stmt, userID, provider, subject)
+	return err
+}
+
+// ForUser returns the identities linked to the user, oldest first
+func (m *IdentityModel) ForUser(userID int) ([]Identity, error) {
+	stmt := `
+		SELECT provider, subject, created FROM user_identities
+		WHERE user_id = ? ORDER BY id
+	`
+	rows, err := m.DB.Query(stmt, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	identities := []Identity{}
+	for rows.Next() {
+		var i Identity
+		err := rows.Scan(&i.Provider, &i.Subject, &i.Created)
+		if err != nil {
+			return nil, err
+		}
+		identities = append(identities, i)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return identities, nil
+}
+
+// Provision creates a user for someone signing in through a provider for the
+// first time. Their email was verified by the provider. They get a random
+// password nobody knows, they can set one through the password reset unless
+// the provider is ProviderLDAP. Names longer than the column are cut short.
+func (m *IdentityModel) Provision(provider, subject, name, email string) (int, error) {
+	password, err := randomToken(32)
+	if err != nil {
+		return 0, err
+	}
+	hpass, err := defaultHasher.Hash(password)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	stmt := `
+		INSERT INTO users (name, email, hashed_password, created, email_verified)
+		VALUES(?, ?, ?, UTC_TIMESTAMP(), TRUE)
+	`
+	result, err := tx.Exec(stmt, truncate(name, 255), email, hpass)
+	if err != nil {
+		var mySQLError *mysql.MySQLError
+		if errors.As(err, &mySQLError) {
+			if mySQLError.Number == 1062 && strings.Contains(mySQLError.Message, "users_uc_email") {
+				return 0, ErrDuplicateEmail
+			}
+		}
+		return 0, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	stmt = `
+		INSERT INTO user_identities (user_id, provider, subject, created)
+		VALUES(?, ?, ?, UTC_TIMESTAMP())
+	`
+	if _, err = tx.Exec(stmt, id, provider, subject); err != nil {
+		return 0, err
+	}
+
+	return int(id), tx.Commit()
+}
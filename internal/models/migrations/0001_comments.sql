@@ -0,0 +1,21 @@
+-- Threaded comments under snippets. Replies point at their parent and at the
+-- root of their thread; a thread is locked through its root comment.
+CREATE TABLE comments (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    snippet_id INTEGER NOT NULL,
+    parent_id INTEGER NULL,
+    thread_id INTEGER NULL,
+    user_id INTEGER NOT NULL,
+    content TEXT NOT NULL,
+    deleted BOOLEAN NOT NULL DEFAULT FALSE,
+    locked BOOLEAN NOT NULL DEFAULT FALSE,
+    created DATETIME NOT NULL,
+    edited DATETIME NULL,
+    CONSTRAINT fk_comments_snippet FOREIGN KEY (snippet_id) REFERENCES snippets(id) ON DELETE CASCADE,
+    CONSTRAINT fk_comments_parent FOREIGN KEY (parent_id) REFERENCES comments(id) ON DELETE CASCADE,
+    CONSTRAINT fk_comments_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_comments_snippet ON comments(snippet_id);
+
+ALTER TABLE users ADD COLUMN moderator BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,13 @@
+-- Running view totals on snippets, plus hourly buckets used to rank recent
+-- activity on the trending page.
+ALTER TABLE snippets ADD COLUMN views INTEGER NOT NULL DEFAULT 0;
+
+CREATE TABLE snippet_views (
+    snippet_id INTEGER NOT NULL,
+    bucket DATETIME NOT NULL,
+    views INTEGER NOT NULL,
+    PRIMARY KEY (snippet_id, bucket),
+    CONSTRAINT fk_snippet_views_snippet FOREIGN KEY (snippet_id) REFERENCES snippets(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_snippet_views_bucket ON snippet_views(bucket);
@@ -0,0 +1,4 @@
+-- Snippets remember who created them so they can be changed through the API.
+-- Snippets created before this, or anonymously, have no owner.
+ALTER TABLE snippets ADD COLUMN user_id INTEGER NULL;
+ALTER TABLE snippets ADD CONSTRAINT fk_snippets_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE SET NULL;
@@ -0,0 +1,2 @@
+-- Optional language hint for a snippet, e.g. "go" or "sql".
+ALTER TABLE snippets ADD COLUMN language VARCHAR(20) NOT NULL DEFAULT '';
@@ -0,0 +1,3 @@
+-- Operators can disable an account, which stops it logging in and ends its
+-- existing sessions.
+ALTER TABLE users ADD COLUMN disabled BOOLEAN NOT NULL DEFAULT FALSE;
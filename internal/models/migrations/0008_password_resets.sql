@@ -0,0 +1,12 @@
+-- Single use password reset tokens, stored as the SHA-256 of the token that
+-- was emailed out.
+CREATE TABLE password_resets (
+    hash CHAR(64) NOT NULL PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    expires DATETIME NOT NULL,
+    CONSTRAINT fk_password_resets_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- Sessions remember the version they were created under, bumping it logs the
+-- user out everywhere.
+ALTER TABLE users ADD COLUMN session_version INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,4 @@
+-- New accounts start unverified until the emailed link is followed. Accounts
+-- that existed before verification was introduced are trusted as they are.
+ALTER TABLE users ADD COLUMN email_verified BOOLEAN NOT NULL DEFAULT FALSE;
+UPDATE users SET email_verified = TRUE;
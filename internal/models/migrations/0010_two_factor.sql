@@ -0,0 +1,13 @@
+-- Optional TOTP second factor. totp_last_step is the last time step a code was
+-- accepted for, so a code can't be replayed within its window.
+ALTER TABLE users ADD COLUMN totp_secret VARCHAR(64) NULL;
+ALTER TABLE users ADD COLUMN totp_last_step BIGINT NOT NULL DEFAULT 0;
+
+-- Single use codes for getting in without the authenticator, stored as the
+-- SHA-256 of the code.
+CREATE TABLE recovery_codes (
+    user_id INTEGER NOT NULL,
+    hash CHAR(64) NOT NULL,
+    PRIMARY KEY (user_id, hash),
+    CONSTRAINT fk_recovery_codes_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
@@ -0,0 +1,14 @@
+-- WebAuthn credentials (passkeys and hardware keys). data holds the
+-- credential as the web app's WebAuthn library serialises it, including the
+-- public key and signature counter.
+CREATE TABLE webauthn_credentials (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    user_id INTEGER NOT NULL,
+    credential_id VARBINARY(1023) NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    data BLOB NOT NULL,
+    created DATETIME NOT NULL,
+    last_used DATETIME NULL,
+    CONSTRAINT webauthn_credentials_uc_credential_id UNIQUE (credential_id),
+    CONSTRAINT fk_webauthn_credentials_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
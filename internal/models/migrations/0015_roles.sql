@@ -0,0 +1,7 @@
+-- Users have one role, each allowed everything the ones before it are:
+-- user, moderator, admin. It replaces the moderator flag.
+ALTER TABLE users ADD COLUMN role VARCHAR(20) NOT NULL DEFAULT 'user';
+
+UPDATE users SET role = 'moderator' WHERE moderator = TRUE;
+
+ALTER TABLE users DROP COLUMN moderator;
@@ -0,0 +1,13 @@
+-- What operators have done, from /admin or snippetadmin. actor_id is NULL for
+-- snippetadmin, which runs without logging in.
+CREATE TABLE audit_log (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    actor_id INTEGER,
+    action VARCHAR(50) NOT NULL,
+    subject VARCHAR(255) NOT NULL,
+    ip VARCHAR(45) NOT NULL DEFAULT '',
+    created DATETIME NOT NULL,
+    CONSTRAINT fk_audit_log_actor FOREIGN KEY (actor_id) REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE INDEX idx_audit_log_created ON audit_log(created);
@@ -0,0 +1,5 @@
+-- Comments outlive their author: deleting a user blanks their comments and
+-- detaches them, so replies from other users stay in their threads.
+ALTER TABLE comments DROP FOREIGN KEY fk_comments_user;
+ALTER TABLE comments MODIFY user_id INTEGER NULL;
+ALTER TABLE comments ADD CONSTRAINT fk_comments_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE SET NULL;
@@ -15,7 +15,7 @@ var mockSnippet = models.Snippet{
 
 type SnippetModel struct{}
 
-func (m *SnippetModel) Insert(title string, content string, expires int) (int, error) {
+func (m *SnippetModel) Insert(userID int, title string, content string, language string, expires int) (int, error) {
 	return 2, nil
 }
 func (m *SnippetModel) Get(id int) (models.Snippet, error) {
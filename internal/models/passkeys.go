@@ -0,0 +1,120 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// Passkey is a registered WebAuthn credential. Data is opaque here, the web
+// app stores its WebAuthn library's view of the credential in it.
+type Passkey struct {
+	ID           int
+	UserID       int
+	CredentialID []byte
+	Name         string
+	Data         []byte
+	Created      time.Time
+	LastUsed     time.Time
+}
+
+type PasskeyModel struct {
+	DB *sql.DB
+}
+
+func (m *PasskeyModel) Insert(userID int, credentialID []byte, name string, data []byte) (int, error) {
+	stmt := `
+		INSERT INTO webauthn_credentials (user_id, credential_id, name, data, created)
+		VALUES(?, ?, ?, ?, UTC_TIMESTAMP())
+	`
+	result, err := m.DB.Exec(stmt, userID, credentialID, name, data)
+	if err != nil {
+		var mySQLError *mysql.MySQLError
+		if errors.As(err, &mySQLError) {
+			if mySQLError.Number == 1062 && strings.Contains(mySQLError.Message, "webauthn_credentials_uc_credential_id") {
+				return 0, ErrDuplicatePasskey
+			}
+		}
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return int(id), nil
+}
+
+func (m *PasskeyModel) ForUser(userID int) ([]Passkey, error) {
+	stmt := `
+		SELECT id, user_id, credential_id, name, data, created, last_used FROM webauthn_credentials
+		WHERE user_id = ?
+		ORDER BY id ASC
+	`
+	rows, err := m.DB.Query(stmt, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	passkeys := []Passkey{}
+	for rows.Next() {
+		p, err := scanPasskey(rows)
+		if err != nil {
+			return nil, err
+		}
+		passkeys = append(passkeys, p)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return passkeys, nil
+}
+
+// Used stores a credential's data after a successful login, the signature
+// counter in it changes with every use
+func (m *PasskeyModel) Used(credentialID []byte, data []byte) error {
+	stmt := `
+		UPDATE webauthn_credentials SET data = ?, last_used = UTC_TIMESTAMP() WHERE credential_id = ?
+	`
+	_, err := m.DB.Exec(stmt, data, credentialID)
+	return err
+}
+
+// Delete removes one of the user's passkeys, ErrNoRecord if they have no such
+// passkey
+func (m *PasskeyModel) Delete(userID, id int) error {
+	stmt := `
+		DELETE FROM webauthn_credentials WHERE id = ? AND user_id = ?
+	`
+	result, err := m.DB.Exec(stmt, id, userID)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNoRecord
+	}
+	return nil
+}
+
+func scanPasskey(row rowScanner) (Passkey, error) {
+	var p Passkey
+	var lastUsed sql.NullTime
+
+	err := row.Scan(&p.ID, &p.UserID, &p.CredentialID, &p.Name, &p.Data, &p.Created, &lastUsed)
+	if err != nil {
+		return Passkey{}, err
+	}
+	if lastUsed.Valid {
+		p.LastUsed = lastUsed.Time
+	}
+	return p, nil
+}
@@ -0,0 +1,62 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+type PasswordResetModel struct {
+	DB *sql.DB
+}
+
+// New issues a reset token for the user valid for ttl, replacing any the user
+// already had. The plaintext is returned to be emailed and is not kept.
+func (m *PasswordResetModel) New(userID int, ttl time.Duration) (string, error) {
+	plaintext, err := randomToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	stmt := `
+		DELETE FROM password_resets WHERE user_id = ?
+	`
+	if _, err = tx.Exec(stmt, userID); err != nil {
+		return "", err
+	}
+
+	stmt = `
+		INSERT INTO password_resets (hash, user_id, expires)
+		VALUES(?, ?, DATE_ADD(UTC_TIMESTAMP(), INTERVAL ? SECOND))
+	`
+	if _, err = tx.Exec(stmt, hashToken(plaintext), userID, int(ttl.Seconds())); err != nil {
+		return "", err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return "", err
+	}
+	return plaintext, nil
+}
+
+// Check returns the user a live token belongs to without using it up
+func (m *PasswordResetModel) Check(plaintext string) (int, error) {
+	var userID int
+	stmt := `
+		SELECT user_id FROM password_resets WHERE hash = ? AND expires > UTC_TIMESTAMP()
+	`
+	err := m.DB.QueryRow(stmt, hashToken(plaintext)).Scan(&userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrNoRecord
+		}
+		return 0, err
+	}
+	return userID, nil
+}
@@ -0,0 +1,38 @@
+package models
+
+import "fmt"
+
+// Role is what a user may do on the site. Each role can do everything the
+// roles ranked below it can.
+type Role string
+
+const (
+	RoleUser      Role = "user"
+	RoleModerator Role = "moderator" //locks and deletes comment threads
+	RoleAdmin     Role = "admin"     //runs the site from /admin
+)
+
+// Roles lists the roles from least to most trusted
+var Roles = []Role{RoleUser, RoleModerator, RoleAdmin}
+
+func (r Role) rank() int {
+	for i, role := range Roles {
+		if r == role {
+			return i
+		}
+	}
+	return -1
+}
+
+// Has reports whether someone with role r may do what role needs
+func (r Role) Has(role Role) bool {
+	return r.rank() >= 0 && r.rank() >= role.rank()
+}
+
+// ParseRole checks s names a role
+func ParseRole(s string) (Role, error) {
+	if r := Role(s); r.rank() >= 0 {
+		return r, nil
+	}
+	return "", fmt.Errorf("unknown role %q, expected user, moderator or admin", s)
+}
@@ -0,0 +1,38 @@
+package models
+
+import (
+	"snippetbox-n/internal/assert"
+	"testing"
+)
+
+func TestRoleHas(t *testing.T) {
+	tests := []struct {
+		role Role
+		need Role
+		want bool
+	}{
+		{RoleUser, RoleUser, true},
+		{RoleUser, RoleModerator, false},
+		{RoleModerator, RoleModerator, true},
+		{RoleModerator, RoleAdmin, false},
+		{RoleAdmin, RoleModerator, true},
+		{RoleAdmin, RoleAdmin, true},
+		{"", RoleUser, false},
+		{"owner", RoleUser, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.role)+" needs "+string(tt.need), func(t *testing.T) {
+			assert.Equal(t, tt.role.Has(tt.need), tt.want)
+		})
+	}
+}
+
+func TestParseRole(t *testing.T) {
+	role, err := ParseRole("moderator")
+	assert.Equal(t, err, nil)
+	assert.Equal(t, role, RoleModerator)
+
+	_, err = ParseRole("Admin")
+	assert.Equal(t, err != nil, true)
+}
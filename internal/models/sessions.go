@@ -0,0 +1,143 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+	"unicode/utf8"
+)
+
+// Session is a logged in session as its user sees it
+type Session struct {
+	ID        int
+	UserID    int
+	IP        string
+	UserAgent string
+	Created   time.Time
+	LastSeen  time.Time
+	Expires   time.Time
+}
+
+type SessionModel struct {
+	DB *sql.DB
+}
+
+// Insert records a new session for the user, clearing out their expired ones
+func (m *SessionModel) Insert(userID int, ip, userAgent string, expires time.Time) (int, error) {
+	stmt := `
+		DELETE FROM user_sessions WHERE user_id = ? AND expires < UTC_TIMESTAMP()
+	`
+	if _, err := m.DB.Exec(stmt, userID); err != nil {
+		return 0, err
+	}
+
+	stmt = `
+		INSERT INTO user_sessions (user_id, ip, user_agent, created, last_seen, expires)
+		VALUES(?, ?, ?, UTC_TIMESTAMP(), UTC_TIMESTAMP(), ?)
+	`
+	result, err := m.DB.Exec(stmt, userID, ip, truncate(userAgent, 255), expires.UTC())
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return int(id), nil
+}
+
+// Touch notes the session is still in use, returning when it was last seen
+// before now, ErrNoRecord if it has been logged out. last_seen is only written
+// every minute or so.
+func (m *SessionModel) Touch(id, userID int, ip string) (time.Time, error) {
+	var lastSeen time.Time
+	var lastIP string
+	stmt := `
+		SELECT last_seen, ip FROM user_sessions WHERE id = ? AND user_id = ?
+	`
+	err := m.DB.QueryRow(stmt, id, userID).Scan(&lastSeen, &lastIP)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return time.Time{}, ErrNoRecord
+		}
+		return time.Time{}, err
+	}
+
+	if time.Since(lastSeen) < time.Minute && ip == lastIP {
+		return lastSeen, nil
+	}
+	stmt = `
+		UPDATE user_sessions SET last_seen = UTC_TIMESTAMP(), ip = ? WHERE id = ?
+	`
+	_, err = m.DB.Exec(stmt, ip, id)
+	return lastSeen, err
+}
+
+// ForUser returns the user's sessions that haven't expired, the most recently
+// used first
+func (m *SessionModel) ForUser(userID int) ([]Session, error) {
+	stmt := `
+		SELECT id, user_id, ip, user_agent, created, last_seen, expires FROM user_sessions
+		WHERE user_id = ? AND expires > UTC_TIMESTAMP()
+		ORDER BY last_seen DESC
+	`
+	rows, err := m.DB.Query(stmt, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []Session{}
+	for rows.Next() {
+		var s Session
+		err := rows.Scan(&s.ID, &s.UserID, &s.IP, &s.UserAgent, &s.Created, &s.LastSeen, &s.Expires)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, s)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// Delete logs one of the user's sessions out, ErrNoRecord if they have no such
+// session
+func (m *SessionModel) Delete(userID, id int) error {
+	stmt := `
+		DELETE FROM user_sessions WHERE id = ? AND user_id = ?
+	`
+	result, err := m.DB.Exec(stmt, id, userID)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNoRecord
+	}
+	return nil
+}
+
+// DeleteOthers logs out every one of the user's sessions but keep
+func (m *SessionModel) DeleteOthers(userID, keep int) error {
+	stmt := `
+		DELETE FROM user_sessions WHERE user_id = ? AND id <> ?
+	`
+	_, err := m.DB.Exec(stmt, userID, keep)
+	return err
+}
+
+// truncate cuts s down to n characters, which is what a VARCHAR(n) column
+// holds, without splitting one
+func truncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n])
+}
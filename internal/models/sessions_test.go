@@ -0,0 +1,28 @@
+package models
+
+import (
+	"snippetbox-n/internal/assert"
+	"strings"
+	"testing"
+)
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		name string
+		s    string
+		n    int
+		want string
+	}{
+		{"Short", "Firefox", 255, "Firefox"},
+		{"Exact", strings.Repeat("a", 255), 255, strings.Repeat("a", 255)},
+		{"Long", strings.Repeat("a", 300), 255, strings.Repeat("a", 255)},
+		{"Multibyte", strings.Repeat("é", 300), 255, strings.Repeat("é", 255)},
+		{"Split", "aé", 1, "a"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, truncate(tt.s, tt.n), tt.want)
+		})
+	}
+}
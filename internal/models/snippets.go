@@ -3,28 +3,33 @@ package models
 import (
 	"database/sql"
 	"errors"
+	"strings"
 	"time"
 )
 
 type Snippet struct {
-	ID      int
-	Title   string
-	Content string
-	Created time.Time
-	Expires time.Time
+	ID       int       `json:"id"`
+	UserID   int       `json:"user_id,omitempty"` //0 when the snippet has no owner
+	Title    string    `json:"title"`
+	Content  string    `json:"content"`
+	Language string    `json:"language,omitempty"`
+	Created  time.Time `json:"created"`
+	Expires  time.Time `json:"expires"`
+	Views    int       `json:"views"`
 }
 
 type SnippetModel struct {
 	DB *sql.DB
 }
 
-func (m *SnippetModel) Insert(title string, content string, expires int) (int, error) {
+// Insert creates a snippet owned by userID, pass 0 for an anonymous snippet
+func (m *SnippetModel) Insert(userID int, title string, content string, language string, expires int) (int, error) {
 	stmt := `
-		INSERT INTO snippets (title, content, created, expires)
-		VALUES(?, ?, UTC_TIMESTAMP(), DATE_ADD(UTC_TIMESTAMP(), INTERVAL ? DAY))
+		INSERT INTO snippets (user_id, title, content, language, created, expires)
+		VALUES(?, ?, ?, ?, UTC_TIMESTAMP(), DATE_ADD(UTC_TIMESTAMP(), INTERVAL ? DAY))
 	`
 
-	result, err := m.DB.Exec(stmt, title, content, expires)
+	result, err := m.DB.Exec(stmt, nullID(userID), title, content, language, expires)
 	if err != nil {
 		return 0, err
 	}
@@ -39,13 +44,14 @@ func (m *SnippetModel) Insert(title string, content string, expires int) (int, e
 
 func (m *SnippetModel) Get(id int) (Snippet, error) {
 	stmt := `
-		SELECT id, title, content, created, expires FROM snippets
+		SELECT id, user_id, title, content, language, created, expires, views FROM snippets
 		WHERE expires > UTC_TIMESTAMP() AND id = ?
 	`
 	row := m.DB.QueryRow(stmt, id)
 	s := &Snippet{}
+	var userID sql.NullInt64
 
-	err := row.Scan(&s.ID, &s.Title, &s.Content, &s.Created, &s.Expires)
+	err := row.Scan(&s.ID, &userID, &s.Title, &s.Content, &s.Language, &s.Created, &s.Expires, &s.Views)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return Snippet{}, ErrNoRecord //create in a bit
@@ -53,6 +59,7 @@ func (m *SnippetModel) Get(id int) (Snippet, error) {
 			return Snippet{}, err
 		}
 	}
+	s.UserID = int(userID.Int64)
 	return *s, nil //remember to change to Snippet later ↑
 }
 
@@ -81,3 +88,124 @@ func (m *SnippetModel) LatestTen() ([]Snippet, error) {
 	}
 	return snippets, nil
 }
+
+// Update replaces a snippet's title and content, its expiry is counted again
+// from now
+func (m *SnippetModel) Update(id int, title string, content string, language string, expires int) error {
+	stmt := `
+		UPDATE snippets SET title = ?, content = ?, language = ?, expires = DATE_ADD(UTC_TIMESTAMP(), INTERVAL ? DAY)
+		WHERE id = ?
+	`
+	_, err := m.DB.Exec(stmt, title, content, language, expires, id)
+	return err
+}
+
+func (m *SnippetModel) Delete(id int) error {
+	stmt := `
+		DELETE FROM snippets WHERE id = ?
+	`
+	result, err := m.DB.Exec(stmt, id)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNoRecord
+	}
+	return nil
+}
+
+// DeleteExpired removes every expired snippet, along with the comments, views
+// and collection entries that cascade from it
+func (m *SnippetModel) DeleteExpired() (int, error) {
+	stmt := `
+		DELETE FROM snippets WHERE expires <= UTC_TIMESTAMP()
+	`
+	result, err := m.DB.Exec(stmt)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return int(n), nil
+}
+
+// List pages through live snippets newest first, restricted to one owner
+// unless userID is 0 and to titles or contents containing search unless it is
+// empty
+func (m *SnippetModel) List(userID int, search string, limit, offset int) ([]Snippet, error) {
+	stmt := `
+		SELECT id, user_id, title, content, language, created, expires, views FROM snippets
+		WHERE expires > UTC_TIMESTAMP() AND (? = 0 OR user_id = ?)
+			AND (? = '' OR title LIKE ? OR content LIKE ?)
+		ORDER BY id DESC LIMIT ? OFFSET ?
+	`
+	pattern := "%" + likeEscaper.Replace(search) + "%"
+	rows, err := m.DB.Query(stmt, userID, userID, search, pattern, pattern, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	snippets := make([]Snippet, 0, limit)
+	for rows.Next() {
+		var curr Snippet
+		var owner sql.NullInt64
+		err := rows.Scan(&curr.ID, &owner, &curr.Title, &curr.Content, &curr.Language, &curr.Created, &curr.Expires, &curr.Views)
+		if err != nil {
+			return nil, err
+		}
+		curr.UserID = int(owner.Int64)
+		snippets = append(snippets, curr)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return snippets, nil
+}
+
+// likeEscaper makes user input match literally inside a LIKE pattern
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// ForUser returns everything a user has created, expired snippets included,
+// oldest first
+func (m *SnippetModel) ForUser(userID int) ([]Snippet, error) {
+	stmt := `
+		SELECT id, user_id, title, content, language, created, expires, views FROM snippets
+		WHERE user_id = ?
+		ORDER BY id ASC
+	`
+	rows, err := m.DB.Query(stmt, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	snippets := []Snippet{}
+	for rows.Next() {
+		var curr Snippet
+		var owner sql.NullInt64
+		err := rows.Scan(&curr.ID, &owner, &curr.Title, &curr.Content, &curr.Language, &curr.Created, &curr.Expires, &curr.Views)
+		if err != nil {
+			return nil, err
+		}
+		curr.UserID = int(owner.Int64)
+		snippets = append(snippets, curr)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return snippets, nil
+}
+
+// nullID stores the zero id as NULL for optional foreign keys
+func nullID(id int) sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(id), Valid: id != 0}
+}
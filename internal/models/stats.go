@@ -0,0 +1,35 @@
+package models
+
+import "database/sql"
+
+// Stats are instance wide counts for operators
+type Stats struct {
+	Users           int
+	DisabledUsers   int
+	Snippets        int
+	ExpiredSnippets int
+	Comments        int
+	Collections     int
+	APITokens       int
+}
+
+type StatsModel struct {
+	DB *sql.DB
+}
+
+func (m *StatsModel) Get() (Stats, error) {
+	stmt := `
+		SELECT
+			(SELECT COUNT(*) FROM users),
+			(SELECT COUNT(*) FROM users WHERE disabled = TRUE),
+			(SELECT COUNT(*) FROM snippets WHERE expires > UTC_TIMESTAMP()),
+			(SELECT COUNT(*) FROM snippets WHERE expires <= UTC_TIMESTAMP()),
+			(SELECT COUNT(*) FROM comments),
+			(SELECT COUNT(*) FROM collections),
+			(SELECT COUNT(*) FROM api_tokens)
+	`
+	var s Stats
+	err := m.DB.QueryRow(stmt).Scan(&s.Users, &s.DisabledUsers, &s.Snippets, &s.ExpiredSnippets,
+		&s.Comments, &s.Collections, &s.APITokens)
+	return s, err
+}
@@ -0,0 +1,157 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+)
+
+const (
+	ScopeRead  = "read"
+	ScopeWrite = "write" //implies read
+)
+
+// tokenPrefix marks snippetbox tokens so they are easy to spot in scripts and
+// secret scanners
+const tokenPrefix = "sb_"
+
+type Token struct {
+	ID       int
+	UserID   int
+	Name     string
+	Scope    string
+	Created  time.Time
+	LastUsed time.Time
+}
+
+type TokenModel struct {
+	DB *sql.DB
+}
+
+// New creates a token and returns its plaintext, which is not kept anywhere
+func (m *TokenModel) New(userID int, name, scope string) (string, error) {
+	plaintext, err := randomToken(32)
+	if err != nil {
+		return "", err
+	}
+	plaintext = tokenPrefix + plaintext
+
+	stmt := `
+		INSERT INTO api_tokens (user_id, name, scope, hash, created)
+		VALUES(?, ?, ?, ?, UTC_TIMESTAMP())
+	`
+	_, err = m.DB.Exec(stmt, userID, name, scope, hashToken(plaintext))
+	if err != nil {
+		return "", err
+	}
+	return plaintext, nil
+}
+
+// Authenticate looks a token up by its plaintext and marks it as used. Tokens
+// of disabled users don't authenticate.
+func (m *TokenModel) Authenticate(plaintext string) (Token, error) {
+	if !strings.HasPrefix(plaintext, tokenPrefix) {
+		return Token{}, ErrInvalidCredentails
+	}
+
+	stmt := `
+		SELECT t.id, t.user_id, t.name, t.scope, t.created, t.last_used FROM api_tokens t
+		INNER JOIN users u ON u.id = t.user_id
+		WHERE t.hash = ? AND u.disabled = FALSE
+	`
+	t, err := scanToken(m.DB.QueryRow(stmt, hashToken(plaintext)))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Token{}, ErrInvalidCredentails
+		}
+		return Token{}, err
+	}
+
+	stmt = `
+		UPDATE api_tokens SET last_used = UTC_TIMESTAMP() WHERE id = ?
+	`
+	_, err = m.DB.Exec(stmt, t.ID)
+	if err != nil {
+		return Token{}, err
+	}
+	return t, nil
+}
+
+func (m *TokenModel) ForUser(userID int) ([]Token, error) {
+	stmt := `
+		SELECT id, user_id, name, scope, created, last_used FROM api_tokens
+		WHERE user_id = ? ORDER BY id DESC
+	`
+	rows, err := m.DB.Query(stmt, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []Token{}
+	for rows.Next() {
+		t, err := scanToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, t)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// Revoke deletes one of a user's tokens, revoking someone else's token is
+// reported as ErrNoRecord
+func (m *TokenModel) Revoke(userID, id int) error {
+	stmt := `
+		DELETE FROM api_tokens WHERE id = ? AND user_id = ?
+	`
+	result, err := m.DB.Exec(stmt, id, userID)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNoRecord
+	}
+	return nil
+}
+
+func scanToken(row rowScanner) (Token, error) {
+	var t Token
+	var lastUsed sql.NullTime
+
+	err := row.Scan(&t.ID, &t.UserID, &t.Name, &t.Scope, &t.Created, &lastUsed)
+	if err != nil {
+		return Token{}, err
+	}
+	if lastUsed.Valid {
+		t.LastUsed = lastUsed.Time
+	}
+	return t, nil
+}
+
+// randomToken returns n random bytes as unpadded, lower case base32
+func randomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(b)), nil
+}
+
+func hashToken(plaintext string) string {
+	sum := sha256.Sum256([]byte(plaintext))
+	return hex.EncodeToString(sum[:])
+}
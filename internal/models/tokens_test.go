@@ -0,0 +1,39 @@
+package models
+
+import (
+	"snippetbox-n/internal/assert"
+	"snippetbox-n/internal/testdb"
+	"testing"
+)
+
+func TestTokenAuthenticateDisabledUser(t *testing.T) {
+	db := testdb.New(t)
+
+	users := &UserModel{DB: db}
+	userID, err := users.Insert("Alice", "alice@example.com", "pa$$word1234")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := &TokenModel{DB: db}
+	plaintext, err := m.New(userID, "laptop", ScopeRead)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := m.Authenticate(plaintext)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, token.UserID, userID)
+
+	if err := users.SetDisabled(userID, true); err != nil {
+		t.Fatal(err)
+	}
+	_, err = m.Authenticate(plaintext)
+	assert.Equal(t, err, ErrInvalidCredentails)
+
+	if err := users.SetDisabled(userID, false); err != nil {
+		t.Fatal(err)
+	}
+	_, err = m.Authenticate(plaintext)
+	assert.Equal(t, err, nil)
+}
@@ -0,0 +1,185 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+)
+
+// recoveryCodeCount is how many recovery codes a user is given at a time
+const recoveryCodeCount = 10
+
+type TwoFactorModel struct {
+	DB *sql.DB
+}
+
+// Secret returns the user's TOTP secret, or "" when they haven't turned two
+// factor authentication on
+func (m *TwoFactorModel) Secret(userID int) (string, error) {
+	var secret sql.NullString
+	stmt := `
+		SELECT totp_secret FROM users WHERE id = ?
+	`
+	err := m.DB.QueryRow(stmt, userID).Scan(&secret)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", ErrNoRecord
+		}
+		return "", err
+	}
+	return secret.String, nil
+}
+
+// Enable turns two factor authentication on with secret, returning a fresh
+// set of recovery codes to show the user once
+func (m *TwoFactorModel) Enable(userID int, secret string) ([]string, error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	stmt := `
+		UPDATE users SET totp_secret = ?, totp_last_step = 0 WHERE id = ?
+	`
+	if _, err = tx.Exec(stmt, secret, userID); err != nil {
+		return nil, err
+	}
+
+	codes, err := replaceRecoveryCodes(tx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+func (m *TwoFactorModel) Disable(userID int) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt := `
+		UPDATE users SET totp_secret = NULL, totp_last_step = 0 WHERE id = ?
+	`
+	if _, err = tx.Exec(stmt, userID); err != nil {
+		return err
+	}
+
+	stmt = `
+		DELETE FROM recovery_codes WHERE user_id = ?
+	`
+	if _, err = tx.Exec(stmt, userID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UseStep records that a code for step was accepted, refusing steps at or
+// before the last one used so each code only works once
+func (m *TwoFactorModel) UseStep(userID int, step int64) error {
+	stmt := `
+		UPDATE users SET totp_last_step = ? WHERE id = ? AND totp_last_step < ?
+	`
+	result, err := m.DB.Exec(stmt, step, userID, step)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrCodeReused
+	}
+	return nil
+}
+
+// UseRecoveryCode uses up one of the user's recovery codes, unknown and
+// already used codes are reported as ErrNoRecord
+func (m *TwoFactorModel) UseRecoveryCode(userID int, code string) error {
+	stmt := `
+		DELETE FROM recovery_codes WHERE user_id = ? AND hash = ?
+	`
+	result, err := m.DB.Exec(stmt, userID, hashToken(normalizeRecoveryCode(code)))
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNoRecord
+	}
+	return nil
+}
+
+func (m *TwoFactorModel) RecoveryCodesLeft(userID int) (int, error) {
+	var n int
+	stmt := `
+		SELECT COUNT(*) FROM recovery_codes WHERE user_id = ?
+	`
+	err := m.DB.QueryRow(stmt, userID).Scan(&n)
+	return n, err
+}
+
+// NewRecoveryCodes throws away the user's remaining recovery codes and issues
+// a new set
+func (m *TwoFactorModel) NewRecoveryCodes(userID int) ([]string, error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	codes, err := replaceRecoveryCodes(tx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+func replaceRecoveryCodes(tx *sql.Tx, userID int) ([]string, error) {
+	stmt := `
+		DELETE FROM recovery_codes WHERE user_id = ?
+	`
+	if _, err := tx.Exec(stmt, userID); err != nil {
+		return nil, err
+	}
+
+	stmt = `
+		INSERT INTO recovery_codes (user_id, hash) VALUES(?, ?)
+	`
+	codes := make([]string, 0, recoveryCodeCount)
+	for len(codes) < recoveryCodeCount {
+		code, err := randomToken(6)
+		if err != nil {
+			return nil, err
+		}
+		if _, err = tx.Exec(stmt, userID, hashToken(code)); err != nil {
+			return nil, err
+		}
+		codes = append(codes, code[:5]+"-"+code[5:])
+	}
+	return codes, nil
+}
+
+// normalizeRecoveryCode undoes the formatting codes are shown with, so they
+// can be typed back in with or without the dash and in any case
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
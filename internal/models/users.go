@@ -3,8 +3,9 @@ package models
 import "database/sql"
 import "errors"
 import "github.com/go-sql-driver/mysql"
-import "golang.org/x/crypto/bcrypt"
+import "snippetbox-n/internal/password"
 import "strings"
+import "sync"
 import "time"
 
 type User struct {
@@ -13,66 +14,405 @@ type User struct {
 	Email          string
 	HashedPassword []byte
 	Created        time.Time
+	Disabled       bool
+	EmailVerified  bool
+	TwoFactor      bool
+	Role           Role
+	Directory      bool //linked to an LDAP entry, which manages the password
+}
+
+// defaultHasher is used by UserModels without a Hasher of their own, it's what
+// password.New("argon2id", password.DefaultBcryptCost) returns
+var defaultHasher = &password.Hasher{
+	Default: password.DefaultArgon2id,
+	Legacy:  []password.Scheme{password.Bcrypt{Cost: password.DefaultBcryptCost}},
 }
 
 // interacts with the database on behalf of the user model, so thus takes a ptr and is 8b
 type UserModel struct {
 	DB *sql.DB
+	//Hasher makes password hashes. Hashes it no longer makes are redone when
+	//their user next logs in.
+	Hasher *password.Hasher
+
+	dummyOnce sync.Once
+	dummyHash string
+}
+
+func (m *UserModel) hasher() *password.Hasher {
+	if m.Hasher == nil {
+		return defaultHasher
+	}
+	return m.Hasher
 }
 
+// Authenticate checks a local password. Directory accounts have none, they
+// are turned away like unknown emails.
 func (m *UserModel) Authenticate(email, password string) (int, error) {
 	var id int
 	var hashedPassword []byte
+	var directory bool
 	stmt := `
-		SELECT id, hashed_password FROM users WHERE email = ?
+		SELECT id, hashed_password,
+			EXISTS(SELECT true FROM user_identities WHERE user_id = users.id AND provider = ?)
+		FROM users WHERE email = ? AND disabled = FALSE
 	`
-	err := m.DB.QueryRow(stmt, email).Scan(&id, &hashedPassword)
+	err := m.DB.QueryRow(stmt, ProviderLDAP, email).Scan(&id, &hashedPassword, &directory)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return 0, err
+	}
+	if directory {
+		hashedPassword = nil
+	}
+
+	rehash, err := m.comparePassword(hashedPassword, password)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return 0, ErrInvalidCredentails
-		} else {
-			return 0, err
+		return 0, err
+	}
+
+	if rehash {
+		// the old hash keeps working if this fails, it's retried next login
+		if hpass, err := m.hasher().Hash(password); err == nil {
+			stmt := `
+				UPDATE users SET hashed_password = ? WHERE id = ? AND hashed_password = ?
+			`
+			m.DB.Exec(stmt, hpass, id, string(hashedPassword))
 		}
 	}
+	return id, nil
+}
 
-	err = bcrypt.CompareHashAndPassword(hashedPassword, []byte(password))
+// comparePassword checks password against a user's hash, or a nil hash when
+// there's no such user. Then it's checked against a dummy hash anyway, so
+// unknown emails take as long as wrong passwords and response times don't give
+// away which emails have accounts. rehash reports a right password whose hash
+// is out of date.
+func (m *UserModel) comparePassword(hashedPassword []byte, password string) (rehash bool, err error) {
+	if hashedPassword == nil {
+		m.dummyOnce.Do(m.makeDummyHash)
+		m.hasher().Verify(m.dummyHash, password)
+		return false, ErrInvalidCredentails
+	}
+
+	ok, rehash, err := m.hasher().Verify(string(hashedPassword), password)
 	if err != nil {
-		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
-			return 0, ErrInvalidCredentails
-		} else {
-			return 0, err
+		return false, err
+	}
+	if !ok {
+		return false, ErrInvalidCredentails
+	}
+	return rehash, nil
+}
+
+// makeDummyHash makes the dummy hash with whichever scheme is slowest to
+// verify. Accounts can still hold hashes of any of the legacy schemes, an
+// unknown email has to take as long as the slowest of them.
+func (m *UserModel) makeDummyHash() {
+	h := m.hasher()
+	var slowest time.Duration
+	for _, scheme := range append([]password.Scheme{h.Default}, h.Legacy...) {
+		hash, err := scheme.Hash("not anyone's password")
+		if err != nil {
+			continue
+		}
+		start := time.Now()
+		scheme.Verify(hash, "not anyone's password")
+		if took := time.Since(start); took > slowest {
+			slowest = took
+			m.dummyHash = hash
 		}
 	}
-	return id, nil
 }
 
-func (m *UserModel) Insert(name, email, password string) error {
-	hpass, err := bcrypt.GenerateFromPassword([]byte(password), 12)
+func (m *UserModel) Insert(name, email, password string) (int, error) {
+	hpass, err := m.hasher().Hash(password)
 	if err != nil {
-		return err
+		return 0, err
 	}
 	stmt := `
 		INSERT INTO users (name, email, hashed_password, created)
 		VALUES(?, ?, ?, UTC_TIMESTAMP())
 	`
-	_, err = m.DB.Exec(stmt, name, email, string(hpass))
+	result, err := m.DB.Exec(stmt, name, email, hpass)
 	if err != nil {
 		var mySQLError *mysql.MySQLError //what?
 		if errors.As(err, &mySQLError) {
 			if mySQLError.Number == 1062 && strings.Contains(mySQLError.Message, "users_uc_email") {
-				return ErrDuplicateEmail
+				return 0, ErrDuplicateEmail
 			}
 		}
-		return err
+		return 0, err
 	}
-	return nil
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return int(id), nil
 }
 
 func (m *UserModel) Exists(id int) (bool, error) {
 	var exists bool
 	stmt := `
-		SELECT EXISTS(SELECT true FROM users WHERE id =?)
+		SELECT EXISTS(SELECT true FROM users WHERE id =? AND disabled = FALSE)
 	`
 	err := m.DB.QueryRow(stmt, id).Scan(&exists)
 	return exists, err
 }
+
+func (m *UserModel) SetRole(id int, role Role) error {
+	if _, err := ParseRole(string(role)); err != nil {
+		return err
+	}
+	stmt := `
+		UPDATE users SET role = ? WHERE id = ?
+	`
+	_, err := m.DB.Exec(stmt, role, id)
+	return err
+}
+
+// SessionState returns the version sessions must carry to stay logged in as
+// the user, along with the user's role. Missing and disabled users are
+// reported as ErrNoRecord.
+func (m *UserModel) SessionState(id int) (int, Role, error) {
+	var version int
+	var role Role
+	stmt := `
+		SELECT session_version, role FROM users WHERE id = ? AND disabled = FALSE
+	`
+	err := m.DB.QueryRow(stmt, id).Scan(&version, &role)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, "", ErrNoRecord
+		}
+		return 0, "", err
+	}
+	return version, role, nil
+}
+
+// BumpSessionVersion logs the user out of every session, the caller logs the
+// current one back in if it should stay
+func (m *UserModel) BumpSessionVersion(id int) error {
+	stmt := `
+		UPDATE users SET session_version = session_version + 1 WHERE id = ?
+	`
+	_, err := m.DB.Exec(stmt, id)
+	return err
+}
+
+func (m *UserModel) Get(id int) (User, error) {
+	stmt := `
+		SELECT id, name, email, hashed_password, created, disabled, email_verified, totp_secret IS NOT NULL, role,
+			EXISTS(SELECT true FROM user_identities WHERE user_id = users.id AND provider = ?)
+		FROM users WHERE id = ?
+	`
+	return m.getUser(stmt, ProviderLDAP, id)
+}
+
+func (m *UserModel) GetByEmail(email string) (User, error) {
+	stmt := `
+		SELECT id, name, email, hashed_password, created, disabled, email_verified, totp_secret IS NOT NULL, role,
+			EXISTS(SELECT true FROM user_identities WHERE user_id = users.id AND provider = ?)
+		FROM users WHERE email = ?
+	`
+	return m.getUser(stmt, ProviderLDAP, email)
+}
+
+func (m *UserModel) getUser(stmt string, args ...any) (User, error) {
+	var u User
+	err := m.DB.QueryRow(stmt, args...).Scan(&u.ID, &u.Name, &u.Email, &u.HashedPassword, &u.Created, &u.Disabled, &u.EmailVerified, &u.TwoFactor, &u.Role, &u.Directory)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return User{}, ErrNoRecord
+		}
+		return User{}, err
+	}
+	return u, nil
+}
+
+// SetPassword changes a user's password and bumps their session version, so
+// every existing session is logged out
+func (m *UserModel) SetPassword(id int, password string) error {
+	hpass, err := m.hasher().Hash(password)
+	if err != nil {
+		return err
+	}
+	stmt := `
+		UPDATE users SET hashed_password = ?, session_version = session_version + 1 WHERE id = ?
+	`
+	_, err = m.DB.Exec(stmt, hpass, id)
+	return err
+}
+
+// ResetPassword uses a password reset token up and sets the password of the
+// user it belongs to, together so a failure leaves the token usable. Expired
+// and already used tokens, and tokens of directory accounts, are reported as
+// ErrNoRecord.
+func (m *UserModel) ResetPassword(plaintext, password string) (int, error) {
+	hpass, err := m.hasher().Hash(password)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var userID int
+	stmt := `
+		SELECT user_id FROM password_resets r
+		WHERE hash = ? AND expires > UTC_TIMESTAMP()
+			AND NOT EXISTS(SELECT true FROM user_identities WHERE user_id = r.user_id AND provider = ?)
+		FOR UPDATE
+	`
+	err = tx.QueryRow(stmt, hashToken(plaintext), ProviderLDAP).Scan(&userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrNoRecord
+		}
+		return 0, err
+	}
+
+	stmt = `
+		UPDATE users SET hashed_password = ?, session_version = session_version + 1 WHERE id = ?
+	`
+	if _, err = tx.Exec(stmt, hpass, userID); err != nil {
+		return 0, err
+	}
+
+	stmt = `
+		DELETE FROM password_resets WHERE user_id = ?
+	`
+	if _, err = tx.Exec(stmt, userID); err != nil {
+		return 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+	return userID, nil
+}
+
+// Recent returns the users who signed up last, newest first
+func (m *UserModel) Recent(limit int) ([]User, error) {
+	stmt := `
+		SELECT id, name, email, created, disabled, email_verified, role FROM users
+		ORDER BY id DESC LIMIT ?
+	`
+	rows, err := m.DB.Query(stmt, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []User{}
+	for rows.Next() {
+		var u User
+		err := rows.Scan(&u.ID, &u.Name, &u.Email, &u.Created, &u.Disabled, &u.EmailVerified, &u.Role)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// SetDisabled blocks or unblocks an account, a disabled user can't log in and
+// no longer Exists so their sessions stop authenticating
+func (m *UserModel) SetDisabled(id int, disabled bool) error {
+	stmt := `
+		UPDATE users SET disabled = ? WHERE id = ?
+	`
+	_, err := m.DB.Exec(stmt, disabled, id)
+	return err
+}
+
+func (m *UserModel) SetName(id int, name string) error {
+	stmt := `
+		UPDATE users SET name = ? WHERE id = ?
+	`
+	_, err := m.DB.Exec(stmt, name, id)
+	return err
+}
+
+// SetEmail changes a user's address, the new one starts out unverified. Like
+// a new password it logs the user's sessions out.
+func (m *UserModel) SetEmail(id int, email string) error {
+	stmt := `
+		UPDATE users SET email = ?, email_verified = FALSE, session_version = session_version + 1 WHERE id = ?
+	`
+	_, err := m.DB.Exec(stmt, email, id)
+	if err != nil {
+		var mySQLError *mysql.MySQLError
+		if errors.As(err, &mySQLError) {
+			if mySQLError.Number == 1062 && strings.Contains(mySQLError.Message, "users_uc_email") {
+				return ErrDuplicateEmail
+			}
+		}
+		return err
+	}
+	return nil
+}
+
+// VerifyEmail marks the user's current email address as confirmed
+func (m *UserModel) VerifyEmail(id int) error {
+	stmt := `
+		UPDATE users SET email_verified = TRUE WHERE id = ?
+	`
+	_, err := m.DB.Exec(stmt, id)
+	return err
+}
+
+// Delete removes a user along with their collections and tokens. Their
+// comments are blanked out and left without an author, so other users'
+// replies to them stay put. Their snippets are deleted too unless
+// keepSnippets is set, in which case they stay up without an owner.
+func (m *UserModel) Delete(id int, keepSnippets bool) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// the foreign key detaches them once the user is gone
+	stmt := `
+		UPDATE comments SET content = '', deleted = TRUE WHERE user_id = ?
+	`
+	if _, err = tx.Exec(stmt, id); err != nil {
+		return err
+	}
+
+	stmt = `
+		DELETE FROM snippets WHERE user_id = ?
+	`
+	if keepSnippets {
+		stmt = `
+			UPDATE snippets SET user_id = NULL WHERE user_id = ?
+		`
+	}
+	if _, err = tx.Exec(stmt, id); err != nil {
+		return err
+	}
+
+	stmt = `
+		DELETE FROM users WHERE id = ?
+	`
+	result, err := tx.Exec(stmt, id)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNoRecord
+	}
+
+	return tx.Commit()
+}
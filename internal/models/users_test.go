@@ -0,0 +1,183 @@
+package models
+
+import (
+	"slices"
+	"snippetbox-n/internal/assert"
+	"snippetbox-n/internal/password"
+	"snippetbox-n/internal/testdb"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// medianTime runs f a few times and returns its median duration
+func medianTime(runs int, f func()) time.Duration {
+	times := make([]time.Duration, runs)
+	for i := range times {
+		start := time.Now()
+		f()
+		times[i] = time.Since(start)
+	}
+	slices.Sort(times)
+	return times[runs/2]
+}
+
+func TestComparePasswordTiming(t *testing.T) {
+	if testing.Short() {
+		t.Skip("models: skipping timing test")
+	}
+
+	m := &UserModel{}
+	current, err := m.hasher().Hash("correct horse battery staple")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// accounts that haven't logged in since the switch to argon2id
+	legacy, err := bcrypt.GenerateFromPassword([]byte("correct horse battery staple"), password.DefaultBcryptCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the dummy hash is made on first use, which shouldn't be timed
+	m.comparePassword(nil, "warm up")
+
+	var slowest time.Duration
+	for _, hash := range []string{current, string(legacy)} {
+		slowest = max(slowest, medianTime(7, func() {
+			_, err := m.comparePassword([]byte(hash), "wrong password")
+			assert.Equal(t, err, ErrInvalidCredentails)
+		}))
+	}
+	unknown := medianTime(7, func() {
+		_, err := m.comparePassword(nil, "wrong password")
+		assert.Equal(t, err, ErrInvalidCredentails)
+	})
+
+	// an unknown email takes as long as the slowest account, within a quarter:
+	// a hash takes tens of milliseconds so scheduling noise is small next to it
+	diff := max(slowest, unknown) - min(slowest, unknown)
+	if diff > max(slowest, unknown)/4 {
+		t.Errorf("the slowest wrong password took %v, unknown email took %v", slowest, unknown)
+	}
+}
+
+func TestComparePassword(t *testing.T) {
+	hasher, err := password.New("argon2id", bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &UserModel{Hasher: hasher}
+
+	current, err := hasher.Hash("pa$$word")
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacy, err := bcrypt.GenerateFromPassword([]byte("pa$$word"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		hash       []byte
+		password   string
+		wantRehash bool
+		wantErr    error
+	}{
+		{"Right", []byte(current), "pa$$word", false, nil},
+		{"Wrong", []byte(current), "password", false, ErrInvalidCredentails},
+		{"Legacy right", legacy, "pa$$word", true, nil},
+		{"Legacy wrong", legacy, "password", false, ErrInvalidCredentails},
+		{"No such user", nil, "pa$$word", false, ErrInvalidCredentails},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rehash, err := m.comparePassword(tt.hash, tt.password)
+			assert.Equal(t, err, tt.wantErr)
+			assert.Equal(t, rehash, tt.wantRehash)
+		})
+	}
+}
+
+func TestUserDeleteKeepsReplies(t *testing.T) {
+	db := testdb.New(t)
+
+	m := &UserModel{DB: db}
+	alice, err := m.Insert("Alice", "alice@example.com", "pa$$word1234")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bob, err := m.Insert("Bob", "bob@example.com", "pa$$word1234")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	snippetID, err := (&SnippetModel{DB: db}).Insert(bob, "Bob's", "content", "", 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	comments := &CommentModel{DB: db}
+	root, err := comments.Insert(snippetID, 0, alice, "Alice's comment")
+	if err != nil {
+		t.Fatal(err)
+	}
+	reply, err := comments.Insert(snippetID, root, bob, "Bob's reply")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.Delete(alice, false); err != nil {
+		t.Fatal(err)
+	}
+
+	thread, err := comments.ForSnippet(snippetID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, len(thread), 2)
+
+	assert.Equal(t, thread[0].ID, root)
+	assert.Equal(t, thread[0].Deleted, true)
+	assert.Equal(t, thread[0].Content, "")
+	assert.Equal(t, thread[0].UserID, 0)
+	assert.Equal(t, thread[0].Author, "")
+
+	assert.Equal(t, thread[1].ID, reply)
+	assert.Equal(t, thread[1].Deleted, false)
+	assert.Equal(t, thread[1].Content, "Bob's reply")
+	assert.Equal(t, thread[1].Author, "Bob")
+}
+
+func TestUserDirectoryAccount(t *testing.T) {
+	db := testdb.New(t)
+
+	m := &UserModel{DB: db}
+	id, err := m.Insert("Alice", "alice@example.com", "pa$$word1234")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := (&PasswordResetModel{DB: db}).New(id, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = (&IdentityModel{DB: db}).Link(id, ProviderLDAP, "uid=alice,ou=people,dc=example,dc=com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user, err := m.Get(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, user.Directory, true)
+
+	_, err = m.Authenticate("alice@example.com", "pa$$word1234")
+	assert.Equal(t, err, ErrInvalidCredentails)
+
+	_, err = m.ResetPassword(token, "violet tractor ember moss")
+	assert.Equal(t, err, ErrNoRecord)
+	_, err = m.Authenticate("alice@example.com", "violet tractor ember moss")
+	assert.Equal(t, err, ErrInvalidCredentails)
+}
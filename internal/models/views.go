@@ -0,0 +1,79 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+type TrendingSnippet struct {
+	Snippet
+	Score float64
+}
+
+type ViewModel struct {
+	DB *sql.DB
+}
+
+// Add records a batch of view counts keyed by snippet id against the hour
+// bucket containing at
+func (m *ViewModel) Add(counts map[int]int, at time.Time) error {
+	if len(counts) == 0 {
+		return nil
+	}
+
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	bucket := at.UTC().Truncate(time.Hour)
+	bucketStmt := `
+		INSERT INTO snippet_views (snippet_id, bucket, views) VALUES(?, ?, ?)
+		ON DUPLICATE KEY UPDATE views = views + VALUES(views)
+	`
+	totalStmt := `
+		UPDATE snippets SET views = views + ? WHERE id = ?
+	`
+	for id, n := range counts {
+		if _, err = tx.Exec(bucketStmt, id, bucket, n); err != nil {
+			return err
+		}
+		if _, err = tx.Exec(totalStmt, n, id); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Trending ranks live snippets by views over the window, each hour's views
+// counting half as much for every halfLife that has passed since
+func (m *ViewModel) Trending(limit int, window, halfLife time.Duration) ([]TrendingSnippet, error) {
+	stmt := `
+		SELECT s.id, s.title, s.content, s.created, s.expires, s.views,
+			SUM(v.views * POW(0.5, TIMESTAMPDIFF(MINUTE, v.bucket, UTC_TIMESTAMP()) / ?)) AS score
+		FROM snippet_views v INNER JOIN snippets s ON s.id = v.snippet_id
+		WHERE s.expires > UTC_TIMESTAMP() AND v.bucket > DATE_SUB(UTC_TIMESTAMP(), INTERVAL ? MINUTE)
+		GROUP BY s.id, s.title, s.content, s.created, s.expires, s.views
+		ORDER BY score DESC LIMIT ?
+	`
+	rows, err := m.DB.Query(stmt, halfLife.Minutes(), int(window.Minutes()), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	snippets := make([]TrendingSnippet, 0, limit)
+	for rows.Next() {
+		var t TrendingSnippet
+		err := rows.Scan(&t.ID, &t.Title, &t.Content, &t.Created, &t.Expires, &t.Views, &t.Score)
+		if err != nil {
+			return nil, err
+		}
+		snippets = append(snippets, t)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return snippets, nil
+}
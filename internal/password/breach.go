@@ -0,0 +1,165 @@
+package password
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Breach lookups use the k-anonymity scheme of Have I Been Pwned's Pwned
+// Passwords: a password's SHA-1 hash is split into a five character prefix and
+// the rest, and only the prefix is used to fetch the range of breached hashes
+// sharing it. The rest is matched against the range locally.
+
+// RangeSource returns the breached hashes starting with a five character,
+// upper case hex prefix, one "SUFFIX:COUNT" line each, as the HIBP range API
+// does
+type RangeSource interface {
+	Range(prefix string) (io.ReadCloser, error)
+}
+
+// BreachCount returns how many times password has been seen in breaches,
+// 0 when it hasn't
+func BreachCount(src RangeSource, password string) (int, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:5], hash[5:]
+
+	rc, err := src.Range(prefix)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	defer rc.Close()
+
+	scanner := bufio.NewScanner(rc)
+	for scanner.Scan() {
+		s, count, ok := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if ok && strings.EqualFold(s, suffix) {
+			return strconv.Atoi(count)
+		}
+	}
+	return 0, scanner.Err()
+}
+
+// RangeDir is a directory of range files named after their prefix, like
+// 21BD1.txt, as the HIBP downloader writes them
+type RangeDir string
+
+func (d RangeDir) Range(prefix string) (io.ReadCloser, error) {
+	return os.Open(filepath.Join(string(d), prefix+".txt"))
+}
+
+// RangeFile is every range in one file sorted by hash, one "HASH:COUNT" line
+// each, as the HIBP downloader writes them when asked for a single file.
+// Ranges are found by binary search.
+type RangeFile string
+
+func (f RangeFile) Range(prefix string) (io.ReadCloser, error) {
+	file, err := os.Open(string(f))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	// find the earliest line start whose hash isn't before prefix
+	lo, hi := int64(0), info.Size()
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		start, line, err := lineAfter(file, mid)
+		if err != nil {
+			return nil, err
+		}
+		if start >= hi || line == "" {
+			hi = mid
+		} else if strings.ToUpper(line[:min(5, len(line))]) < prefix {
+			lo = start + int64(len(line)) + 1
+		} else {
+			hi = mid
+		}
+	}
+	start, _, err := lineAfter(file, lo)
+	if err != nil {
+		return nil, err
+	}
+
+	// read the range out, as suffixes
+	if _, err := file.Seek(start, io.SeekStart); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) < 5 || !strings.EqualFold(line[:5], prefix) {
+			break
+		}
+		buf.WriteString(line[5:] + "\n")
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return io.NopCloser(&buf), nil
+}
+
+// lineAfter returns the first line starting at or after offset, along with
+// where it starts. A line is only taken to start at offset when offset is 0 or
+// follows a newline.
+func lineAfter(file *os.File, offset int64) (int64, string, error) {
+	start := offset
+	if offset > 0 {
+		start--
+	}
+	if _, err := file.Seek(start, io.SeekStart); err != nil {
+		return 0, "", err
+	}
+
+	reader := bufio.NewReader(file)
+	if offset > 0 {
+		skipped, err := reader.ReadString('\n')
+		if err != nil {
+			if err == io.EOF {
+				return start + int64(len(skipped)), "", nil
+			}
+			return 0, "", err
+		}
+		start += int64(len(skipped))
+	}
+
+	line, err := reader.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return 0, "", err
+	}
+	return start, strings.TrimRight(line, "\r\n"), nil
+}
+
+// OpenRanges picks RangeDir or RangeFile for path, whichever it is
+func OpenRanges(path string) (RangeSource, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return RangeDir(path), nil
+	}
+	if !info.Mode().IsRegular() {
+		return nil, fmt.Errorf("password: %s is neither a directory nor a file", path)
+	}
+	return RangeFile(path), nil
+}
@@ -0,0 +1,183 @@
+// Package password hashes and checks passwords. Hashes are stored in their
+// usual encoded forms, which name the algorithm and settings used, so they can
+// be moved to newer algorithms and settings as users log in.
+package password
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// DefaultBcryptCost is the cost of bcrypt hashes unless configured otherwise
+const DefaultBcryptCost = 12
+
+// ErrUnknownHash is returned for a hash no configured scheme recognises
+var ErrUnknownHash = errors.New("password: unknown hash format")
+
+// Scheme is one way of hashing passwords
+type Scheme interface {
+	Hash(password string) (string, error)
+	// Matches reports whether encoded is a hash made by this scheme
+	Matches(encoded string) bool
+	Verify(encoded, password string) (bool, error)
+	// Current reports whether encoded was made with the scheme's present
+	// settings
+	Current(encoded string) bool
+}
+
+// Hasher makes new hashes with Default and still checks hashes made by any of
+// Legacy, reporting when they ought to be replaced
+type Hasher struct {
+	Default Scheme
+	Legacy  []Scheme
+}
+
+// New returns a Hasher making hashes with the named scheme, "argon2id" or
+// "bcrypt", which still accepts hashes made with the other
+func New(scheme string, bcryptCost int) (*Hasher, error) {
+	if bcryptCost < bcrypt.MinCost || bcryptCost > bcrypt.MaxCost {
+		return nil, fmt.Errorf("password: bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+	}
+
+	switch scheme {
+	case "argon2id":
+		return &Hasher{Default: DefaultArgon2id, Legacy: []Scheme{Bcrypt{Cost: bcryptCost}}}, nil
+	case "bcrypt":
+		return &Hasher{Default: Bcrypt{Cost: bcryptCost}, Legacy: []Scheme{DefaultArgon2id}}, nil
+	}
+	return nil, fmt.Errorf("password: unknown scheme %q", scheme)
+}
+
+func (h *Hasher) Hash(password string) (string, error) {
+	return h.Default.Hash(password)
+}
+
+// Verify checks password against encoded. rehash is set when the password was
+// right but encoded isn't what Hash would make now, the caller should store a
+// new hash while it has the password.
+func (h *Hasher) Verify(encoded, password string) (ok, rehash bool, err error) {
+	if h.Default.Matches(encoded) {
+		ok, err = h.Default.Verify(encoded, password)
+		return ok, ok && !h.Default.Current(encoded), err
+	}
+	for _, s := range h.Legacy {
+		if s.Matches(encoded) {
+			ok, err = s.Verify(encoded, password)
+			return ok, ok, err
+		}
+	}
+	return false, false, ErrUnknownHash
+}
+
+// Argon2id hashes are encoded in the PHC string format,
+// $argon2id$v=19$m=<KiB>,t=<passes>,p=<threads>$<salt>$<key>
+type Argon2id struct {
+	Time    uint32
+	Memory  uint32 //KiB
+	Threads uint8
+	SaltLen uint32
+	KeyLen  uint32
+}
+
+// DefaultArgon2id follows OWASP's recommended minimum, which keeps memory use
+// per login modest for a web server
+var DefaultArgon2id = Argon2id{Time: 2, Memory: 19 * 1024, Threads: 1, SaltLen: 16, KeyLen: 32}
+
+var b64 = base64.RawStdEncoding
+
+func (a Argon2id) Hash(password string) (string, error) {
+	salt := make([]byte, a.SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, a.Time, a.Memory, a.Threads, a.KeyLen)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, a.Memory, a.Time, a.Threads, b64.EncodeToString(salt), b64.EncodeToString(key)), nil
+}
+
+func (a Argon2id) Matches(encoded string) bool {
+	return strings.HasPrefix(encoded, "$argon2id$")
+}
+
+func (a Argon2id) Verify(encoded, password string) (bool, error) {
+	params, salt, key, err := decodeArgon2id(encoded)
+	if err != nil {
+		return false, err
+	}
+	other := argon2.IDKey([]byte(password), salt, params.Time, params.Memory, params.Threads, uint32(len(key)))
+	return subtle.ConstantTimeCompare(key, other) == 1, nil
+}
+
+func (a Argon2id) Current(encoded string) bool {
+	params, salt, key, err := decodeArgon2id(encoded)
+	if err != nil {
+		return false
+	}
+	return params.Time == a.Time && params.Memory == a.Memory && params.Threads == a.Threads &&
+		uint32(len(salt)) == a.SaltLen && uint32(len(key)) == a.KeyLen
+}
+
+func decodeArgon2id(encoded string) (params Argon2id, salt, key []byte, err error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return params, nil, nil, ErrUnknownHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, fmt.Errorf("password: unsupported argon2 version %q", parts[2])
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Time, &params.Threads); err != nil {
+		return params, nil, nil, fmt.Errorf("password: bad argon2 parameters %q", parts[3])
+	}
+	if params.Time == 0 || params.Threads == 0 {
+		return params, nil, nil, fmt.Errorf("password: bad argon2 parameters %q", parts[3])
+	}
+
+	if salt, err = b64.DecodeString(parts[4]); err != nil {
+		return params, nil, nil, err
+	}
+	if key, err = b64.DecodeString(parts[5]); err != nil {
+		return params, nil, nil, err
+	}
+	if len(key) == 0 {
+		return params, nil, nil, ErrUnknownHash
+	}
+	return params, salt, key, nil
+}
+
+// Bcrypt hashes are in bcrypt's own $2a$<cost>$ format. bcrypt ignores
+// everything past a password's first 72 bytes, which is why it's no longer
+// the default.
+type Bcrypt struct {
+	Cost int
+}
+
+func (b Bcrypt) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), b.Cost)
+	return string(hash), err
+}
+
+func (b Bcrypt) Matches(encoded string) bool {
+	return strings.HasPrefix(encoded, "$2a$") || strings.HasPrefix(encoded, "$2b$") || strings.HasPrefix(encoded, "$2y$")
+}
+
+func (b Bcrypt) Verify(encoded, password string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (b Bcrypt) Current(encoded string) bool {
+	cost, err := bcrypt.Cost([]byte(encoded))
+	return err == nil && cost >= b.Cost
+}
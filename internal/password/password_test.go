@@ -0,0 +1,108 @@
+package password
+
+import (
+	"snippetbox-n/internal/assert"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestArgon2id(t *testing.T) {
+	a := Argon2id{Time: 1, Memory: 1024, Threads: 1, SaltLen: 16, KeyLen: 32}
+	hash, err := a.Hash("pa$$word")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, strings.HasPrefix(hash, "$argon2id$v=19$m=1024,t=1,p=1$"), true)
+	assert.Equal(t, a.Matches(hash), true)
+	assert.Equal(t, a.Current(hash), true)
+
+	ok, err := a.Verify(hash, "pa$$word")
+	assert.Equal(t, err, nil)
+	assert.Equal(t, ok, true)
+
+	ok, err = a.Verify(hash, "password")
+	assert.Equal(t, err, nil)
+	assert.Equal(t, ok, false)
+
+	stronger := a
+	stronger.Time = 2
+	assert.Equal(t, stronger.Current(hash), false)
+
+	// hashes are checked with the settings they were made with
+	ok, err = stronger.Verify(hash, "pa$$word")
+	assert.Equal(t, err, nil)
+	assert.Equal(t, ok, true)
+}
+
+// a test vector from the reference implementation, argon2 somesalt -id -t 2 -m 16 -p 1
+func TestArgon2idReference(t *testing.T) {
+	hash := "$argon2id$v=19$m=65536,t=2,p=1$c29tZXNhbHQ$CTFhFdXPJO1aFaMaO6Mm5c8y7cJHAph8ArZWb2GRPPc"
+	ok, err := DefaultArgon2id.Verify(hash, "password")
+	assert.Equal(t, err, nil)
+	assert.Equal(t, ok, true)
+}
+
+func TestBadArgon2id(t *testing.T) {
+	for _, hash := range []string{
+		"$argon2id$v=19$m=1024,t=2,p=1$c29tZXNhbHQ",
+		"$argon2id$v=16$m=1024,t=2,p=1$c29tZXNhbHQ$CTFhFdXPJO1aFaMaO6Mm5c8y7cJHAph8ArZWb2GRPPc",
+		"$argon2id$v=19$m=1024,t=0,p=1$c29tZXNhbHQ$CTFhFdXPJO1aFaMaO6Mm5c8y7cJHAph8ArZWb2GRPPc",
+		"$argon2id$v=19$m=1024,t=2,p=1$c29tZXNhbHQ$!!",
+	} {
+		_, err := DefaultArgon2id.Verify(hash, "password")
+		assert.Equal(t, err != nil, true)
+	}
+}
+
+func TestHasher(t *testing.T) {
+	h, err := New("argon2id", bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.Default = Argon2id{Time: 1, Memory: 1024, Threads: 1, SaltLen: 16, KeyLen: 32}
+
+	current, _ := h.Hash("pa$$word")
+	legacy, _ := Bcrypt{Cost: bcrypt.MinCost}.Hash("pa$$word")
+	outdated, _ := Argon2id{Time: 1, Memory: 512, Threads: 1, SaltLen: 16, KeyLen: 32}.Hash("pa$$word")
+
+	tests := []struct {
+		name       string
+		hash       string
+		password   string
+		wantOK     bool
+		wantRehash bool
+		wantErr    bool
+	}{
+		{"Current", current, "pa$$word", true, false, false},
+		{"Current wrong", current, "password", false, false, false},
+		{"Bcrypt", legacy, "pa$$word", true, true, false},
+		{"Bcrypt wrong", legacy, "password", false, false, false},
+		{"Outdated settings", outdated, "pa$$word", true, true, false},
+		{"Unknown", "$1$md5crypt$hash", "pa$$word", false, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, rehash, err := h.Verify(tt.hash, tt.password)
+			assert.Equal(t, ok, tt.wantOK)
+			assert.Equal(t, rehash, tt.wantRehash)
+			assert.Equal(t, err != nil, tt.wantErr)
+		})
+	}
+}
+
+func TestNew(t *testing.T) {
+	_, err := New("md5", DefaultBcryptCost)
+	assert.Equal(t, err != nil, true)
+	_, err = New("bcrypt", 99)
+	assert.Equal(t, err != nil, true)
+
+	h, err := New("bcrypt", bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash, _ := h.Hash("pa$$word")
+	assert.Equal(t, strings.HasPrefix(hash, "$2a$04$"), true)
+}
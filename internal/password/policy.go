@@ -0,0 +1,59 @@
+package password
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	// MinScore is the lowest Estimate score a new password can have
+	MinScore = 2
+	// MaxBytes is the longest a new password can be. bcrypt can't hash
+	// anything longer, and any hash may have to be redone with bcrypt if the
+	// scheme is changed.
+	MaxBytes = 72
+)
+
+var (
+	ErrTooLong  = errors.New("password: longer than 72 bytes")
+	ErrCommon   = errors.New("password: one of the most commonly used passwords")
+	ErrBreached = errors.New("password: appeared in a data breach")
+	ErrTooEasy  = errors.New("password: too easy to guess")
+)
+
+// Policy decides whether a new password is good enough, the same way for the
+// web app and snippetadmin
+type Policy struct {
+	Breaches RangeSource //nil skips the breach check
+}
+
+// Check turns down a password that's longer than MaxBytes, common, has turned
+// up in a breach or scores below MinScore, with ErrTooLong, ErrCommon,
+// ErrBreached or ErrTooEasy. userInputs are the user's name and email, which
+// shouldn't be in it. Any other error means the breach check couldn't be made,
+// the password passed the rest. The estimate is returned for its feedback.
+func (p Policy) Check(password string, userInputs ...string) (Strength, error) {
+	strength := Estimate(password, userInputs...)
+
+	if len(password) > MaxBytes {
+		return strength, ErrTooLong
+	}
+	if IsCommon(password) {
+		return strength, ErrCommon
+	}
+
+	var lookupErr error
+	if p.Breaches != nil {
+		count, err := BreachCount(p.Breaches, password)
+		if err != nil {
+			lookupErr = fmt.Errorf("password: checking breaches: %w", err)
+		} else if count > 0 {
+			return strength, ErrBreached
+		}
+	}
+
+	if strength.Score < MinScore {
+		return strength, ErrTooEasy
+	}
+	return strength, lookupErr
+}
@@ -0,0 +1,221 @@
+package password
+
+import (
+	_ "embed"
+	"math"
+	"strings"
+	"unicode"
+)
+
+//go:embed common.txt
+var commonList string
+
+// common ranks each password on the list, 1 being the most common
+var common = func() map[string]int {
+	words := map[string]int{}
+	for _, line := range strings.Split(commonList, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "#") && words[line] == 0 {
+			words[line] = len(words) + 1
+		}
+	}
+	return words
+}()
+
+// IsCommon reports whether password is on the bundled list of common
+// passwords, ignoring case
+func IsCommon(password string) bool {
+	return common[strings.ToLower(password)] > 0
+}
+
+// Strength is an estimate of how hard a password is to guess, Score running
+// from 0 (guessed at once) to 4 (very hard). Feedback suggests how to do
+// better.
+type Strength struct {
+	Score    int
+	Feedback []string
+}
+
+// Estimate scores password by the number of guesses an attacker who knows the
+// usual tricks would need. It discounts common passwords with a few
+// characters added, repeats, sequences and anything taken from userInputs,
+// such as the user's name and email.
+func Estimate(password string, userInputs ...string) Strength {
+	var s Strength
+	lower := strings.ToLower(password)
+
+	if IsCommon(password) {
+		s.Feedback = append(s.Feedback, "This is one of the most commonly used passwords")
+		return s
+	}
+
+	// the part of the password an attacker has to work for, with anything
+	// guessable cut out of it
+	rest := lower
+	bits := 0.0
+
+	for _, input := range userInputs {
+		for _, part := range inputParts(input) {
+			if strings.Contains(rest, part) {
+				rest = strings.Replace(rest, part, "", 1)
+				bits += 1
+				s.Feedback = appendOnce(s.Feedback, "Avoid using your name or email address")
+			}
+		}
+	}
+
+	// a common password is worth as many guesses as its rank, and one more
+	// bit for however it was dressed up
+	if word, rank := commonCore(rest); rank > 0 {
+		rest = strings.Replace(rest, word, "", 1)
+		bits += math.Log2(float64(rank)) + 1
+		s.Feedback = append(s.Feedback, "Adding numbers or symbols to a common password doesn't make it much harder to guess")
+	}
+
+	length, repeats, sequences := effectiveLength(rest)
+	if repeats {
+		s.Feedback = append(s.Feedback, `Avoid repeated characters like "aaa"`)
+	}
+	if sequences {
+		s.Feedback = append(s.Feedback, `Avoid sequences like "abc", "1234" or "qwerty"`)
+	}
+	bits += length * math.Log2(float64(charsetSize(rest)))
+	if lower != password {
+		// rest is lower case, capitals are usually only a guess or two more
+		bits += 2
+	}
+
+	switch {
+	case bits < 28:
+		s.Score = 0
+	case bits < 36:
+		s.Score = 1
+	case bits < 60:
+		s.Score = 2
+	case bits < 80:
+		s.Score = 3
+	default:
+		s.Score = 4
+	}
+
+	if s.Score < 3 && len([]rune(password)) < 16 {
+		s.Feedback = append(s.Feedback, "Make it longer, a few uncommon words together work well")
+	}
+	return s
+}
+
+var leet = strings.NewReplacer("0", "o", "1", "i", "3", "e", "4", "a", "5", "s", "7", "t", "@", "a", "$", "s", "!", "i")
+
+// commonCore finds a common password inside one with characters added at
+// either end, or letters swapped for look-alike digits and symbols, returning
+// the part of lower it takes up and its rank. The rank is 0 when there's none.
+func commonCore(lower string) (string, int) {
+	core := strings.TrimFunc(lower, func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+	if rank := common[core]; len(core) >= 4 && rank > 0 {
+		return core, rank
+	}
+	if rank := common[leet.Replace(lower)]; rank > 0 {
+		return lower, rank
+	}
+	return "", 0
+}
+
+// inputParts splits a name or email address into the pieces someone might put
+// in their password
+func inputParts(input string) []string {
+	var parts []string
+	for _, p := range strings.FieldsFunc(strings.ToLower(input), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if len(p) >= 3 {
+			parts = append(parts, p)
+		}
+	}
+	return parts
+}
+
+const sequences = "abcdefghijklmnopqrstuvwxyz 01234567890 qwertyuiop asdfghjkl zxcvbnm"
+
+// effectiveLength counts the characters in s that add to the guessing, a run
+// of repeats or a sequence only counts for one
+func effectiveLength(s string) (length float64, repeats, seqs bool) {
+	r := []rune(s)
+	for i := 0; i < len(r); {
+		j := i + 1
+		for j < len(r) && r[j] == r[i] {
+			j++
+		}
+		if j-i >= 3 {
+			repeats = true
+			length++
+			i = j
+			continue
+		}
+
+		j = i + 1
+		for j < len(r) && inSequence(r[j-1], r[j]) {
+			j++
+		}
+		if j-i >= 3 {
+			seqs = true
+			length++
+			i = j
+			continue
+		}
+
+		length++
+		i++
+	}
+	return length, repeats, seqs
+}
+
+// inSequence reports whether b follows or precedes a in the alphabet, the
+// digits or a keyboard row
+func inSequence(a, b rune) bool {
+	for _, pair := range []string{string([]rune{a, b}), string([]rune{b, a})} {
+		if strings.Contains(sequences, pair) {
+			return true
+		}
+	}
+	return false
+}
+
+func charsetSize(password string) int {
+	var lower, upper, digit, symbol, other bool
+	for _, r := range password {
+		switch {
+		case r >= 'a' && r <= 'z':
+			lower = true
+		case r >= 'A' && r <= 'Z':
+			upper = true
+		case r >= '0' && r <= '9':
+			digit = true
+		case r < unicode.MaxASCII:
+			symbol = true
+		default:
+			other = true
+		}
+	}
+
+	size := 0
+	for _, class := range []struct {
+		present bool
+		size    int
+	}{{lower, 26}, {upper, 26}, {digit, 10}, {symbol, 33}, {other, 100}} {
+		if class.present {
+			size += class.size
+		}
+	}
+	return max(size, 2)
+}
+
+func appendOnce(list []string, s string) []string {
+	for _, l := range list {
+		if l == s {
+			return list
+		}
+	}
+	return append(list, s)
+}
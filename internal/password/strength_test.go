@@ -0,0 +1,110 @@
+package password
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"snippetbox-n/internal/assert"
+	"strings"
+	"testing"
+)
+
+func TestEstimate(t *testing.T) {
+	tests := []struct {
+		password string
+		inputs   []string
+		maxScore int
+		minScore int
+	}{
+		{"password", nil, 0, 0},
+		{"Password", nil, 0, 0},
+		{"p@ssw0rd", nil, 0, 0},
+		{"password2024!", nil, 1, 0},
+		{"aaaaaaaaaaaa", nil, 0, 0},
+		{"abcdefgh1234", nil, 1, 0},
+		{"alicesmith99", []string{"Alice Smith", "alice@example.com"}, 1, 0},
+		{"kq8mzt2wpx", nil, 3, 2},
+		{"correct horse battery staple", nil, 4, 4},
+		{"Tr0ub4dour&3-xylophone", nil, 4, 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.password, func(t *testing.T) {
+			s := Estimate(tt.password, tt.inputs...)
+			if s.Score < tt.minScore || s.Score > tt.maxScore {
+				t.Errorf("got score %d, want %d to %d", s.Score, tt.minScore, tt.maxScore)
+			}
+			if s.Score < 3 {
+				assert.Equal(t, len(s.Feedback) > 0, true)
+			}
+		})
+	}
+}
+
+func TestEstimateFeedback(t *testing.T) {
+	s := Estimate("alice1234", "Alice")
+	assert.Equal(t, slices.Contains(s.Feedback, "Avoid using your name or email address"), true)
+	assert.Equal(t, slices.Contains(s.Feedback, `Avoid sequences like "abc", "1234" or "qwerty"`), true)
+
+	s = Estimate("vvvvvvvvvv")
+	assert.Equal(t, slices.Contains(s.Feedback, `Avoid repeated characters like "aaa"`), true)
+}
+
+func TestIsCommon(t *testing.T) {
+	assert.Equal(t, IsCommon("qwerty123"), true)
+	assert.Equal(t, IsCommon("QWERTY123"), true)
+	assert.Equal(t, IsCommon("kq8mzt2wpx"), false)
+	assert.Equal(t, IsCommon("# Common passwords, lower case, one per line. Checked against new passwords"), false)
+}
+
+func hibpLine(password string, count int) string {
+	sum := sha1.Sum([]byte(password))
+	return fmt.Sprintf("%s:%d", strings.ToUpper(hex.EncodeToString(sum[:])), count)
+}
+
+func TestBreachCount(t *testing.T) {
+	lines := []string{hibpLine("password", 9659365), hibpLine("letmein", 1300000), hibpLine("hunter2", 24230)}
+	for i := range 200 {
+		lines = append(lines, hibpLine(fmt.Sprintf("filler-%d", i), i+1))
+	}
+	slices.Sort(lines)
+
+	file := filepath.Join(t.TempDir(), "pwned.txt")
+	if err := os.WriteFile(file, []byte(strings.Join(lines, "\r\n")+"\r\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	ranges := map[string][]string{}
+	for _, l := range lines {
+		ranges[l[:5]] = append(ranges[l[:5]], l[5:])
+	}
+	for prefix, suffixes := range ranges {
+		if err := os.WriteFile(filepath.Join(dir, prefix+".txt"), []byte(strings.Join(suffixes, "\n")), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, src := range []RangeSource{RangeFile(file), RangeDir(dir)} {
+		t.Run(fmt.Sprintf("%T", src), func(t *testing.T) {
+			tests := []struct {
+				password string
+				want     int
+			}{
+				{"password", 9659365},
+				{"hunter2", 24230},
+				{"filler-0", 1},
+				{"filler-199", 200},
+				{"kq8mzt2wpx", 0},
+			}
+			for _, tt := range tests {
+				count, err := BreachCount(src, tt.password)
+				assert.Equal(t, err, nil)
+				assert.Equal(t, count, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+// Package testdb gives tests a MySQL database of their own with the full
+// schema, dropped again when the test ends. Tests using it are skipped unless
+// SNIPPETBOX_TEST_DSN names a server and a user allowed to create databases,
+// for example "root:pass@tcp(localhost:3306)/".
+package testdb
+
+import (
+	"crypto/rand"
+	"database/sql"
+	_ "embed"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+//go:embed base.sql
+var base string
+
+// New creates a database for t, with the base tables and every migration
+// applied
+func New(t *testing.T) *sql.DB {
+	t.Helper()
+
+	dsn := os.Getenv("SNIPPETBOX_TEST_DSN")
+	if dsn == "" {
+		t.Skip("testdb: SNIPPETBOX_TEST_DSN not set")
+	}
+	cfg, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.ParseTime = true
+	cfg.DBName = ""
+
+	server, err := sql.Open("mysql", cfg.FormatDSN())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { server.Close() })
+
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		t.Fatal(err)
+	}
+	cfg.DBName = "snippetbox_test_" + hex.EncodeToString(b)
+	if _, err := server.Exec("CREATE DATABASE " + cfg.DBName); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if _, err := server.Exec("DROP DATABASE " + cfg.DBName); err != nil {
+			t.Error(err)
+		}
+	})
+
+	db, err := sql.Open("mysql", cfg.FormatDSN())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	scripts := []string{base}
+	migrations, err := filepath.Glob(filepath.Join(migrationsDir(), "*.sql"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range migrations {
+		b, err := os.ReadFile(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		scripts = append(scripts, string(b))
+	}
+
+	for _, script := range scripts {
+		for _, stmt := range statements(script) {
+			if _, err := db.Exec(stmt); err != nil {
+				t.Fatalf("testdb: %v\n%s", err, stmt)
+			}
+		}
+	}
+	return db
+}
+
+// migrationsDir is internal/models/migrations, found from this file so tests
+// in any package can use it
+func migrationsDir() string {
+	_, file, _, _ := runtime.Caller(0)
+	return filepath.Join(filepath.Dir(file), "..", "models", "migrations")
+}
+
+// statements splits a script into its statements, dropping comments. The
+// scripts don't put semicolons in strings, so there's no need to parse them.
+func statements(script string) []string {
+	var lines []string
+	for _, line := range strings.Split(script, "\n") {
+		if !strings.HasPrefix(strings.TrimSpace(line), "--") {
+			lines = append(lines, line)
+		}
+	}
+
+	var stmts []string
+	for _, stmt := range strings.Split(strings.Join(lines, "\n"), ";") {
+		if stmt = strings.TrimSpace(stmt); stmt != "" {
+			stmts = append(stmts, stmt)
+		}
+	}
+	return stmts
+}
@@ -0,0 +1,126 @@
+// Package throttle slows down repeated failures, such as wrong passwords,
+// with an exponential backoff that ends in a temporary lockout.
+package throttle
+
+import (
+	"sync"
+	"time"
+)
+
+// Limiter counts failures per key, an email address or an IP address say.
+// After Free failures each one makes the key wait before trying again, Base
+// at first and doubling up to Max. At LockAfter failures the key is locked out
+// for LockFor, after which it starts over. Failures are forgotten once the key
+// has gone Forget without one.
+type Limiter struct {
+	Free      int
+	Base      time.Duration
+	Max       time.Duration
+	LockAfter int
+	LockFor   time.Duration
+	Forget    time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*entry
+	now     func() time.Time //time.Now outside of tests
+}
+
+type entry struct {
+	failures int
+	last     time.Time //the latest failure
+	until    time.Time //when the key may try again
+}
+
+func (l *Limiter) clock() time.Time {
+	if l.now != nil {
+		return l.now()
+	}
+	return time.Now()
+}
+
+// get returns key's entry, nil when it has none worth keeping. The lock must
+// be held.
+func (l *Limiter) get(key string, now time.Time) *entry {
+	e := l.entries[key]
+	if e != nil && now.Sub(e.last) > l.Forget && !now.Before(e.until) {
+		delete(l.entries, key)
+		return nil
+	}
+	return e
+}
+
+// Wait returns how long key has to wait before its next attempt, 0 when it
+// can go ahead now
+func (l *Limiter) Wait(key string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.clock()
+	e := l.get(key, now)
+	if e == nil || !now.Before(e.until) {
+		return 0
+	}
+	return e.until.Sub(now)
+}
+
+// Fail records a failed attempt by key, reporting whether it locked key out
+func (l *Limiter) Fail(key string) (locked bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.clock()
+	e := l.get(key, now)
+	if e == nil {
+		if l.entries == nil {
+			l.entries = make(map[string]*entry)
+		}
+		e = &entry{}
+		l.entries[key] = e
+	}
+	e.failures++
+	e.last = now
+
+	if l.LockAfter > 0 && e.failures >= l.LockAfter {
+		e.failures = 0
+		e.until = now.Add(l.LockFor)
+		return true
+	}
+
+	if e.failures > l.Free {
+		delay := l.Base << (e.failures - l.Free - 1)
+		if delay > l.Max || delay <= 0 {
+			delay = l.Max
+		}
+		e.until = now.Add(delay)
+	}
+	return false
+}
+
+// Reset forgets key's failures, after it got something right
+func (l *Limiter) Reset(key string) {
+	l.mu.Lock()
+	delete(l.entries, key)
+	l.mu.Unlock()
+}
+
+// Prune drops keys with nothing left to remember, so keys that fail once and
+// never come back don't pile up
+func (l *Limiter) Prune() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.clock()
+	for key := range l.entries {
+		l.get(key, now)
+	}
+}
+
+// Run prunes every interval, forever
+func (l *Limiter) Run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		l.Prune()
+	}
+}
@@ -0,0 +1,72 @@
+package throttle
+
+import (
+	"snippetbox-n/internal/assert"
+	"testing"
+	"time"
+)
+
+func newTestLimiter(now *time.Time) *Limiter {
+	return &Limiter{
+		Free:      2,
+		Base:      time.Second,
+		Max:       4 * time.Second,
+		LockAfter: 6,
+		LockFor:   time.Minute,
+		Forget:    time.Hour,
+		now:       func() time.Time { return *now },
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	l := newTestLimiter(&now)
+
+	// the wait after each failure: two free, then doubling up to Max, then
+	// the lockout
+	want := []time.Duration{0, 0, time.Second, 2 * time.Second, 4 * time.Second, time.Minute}
+	for i, w := range want {
+		locked := l.Fail("alice")
+		assert.Equal(t, locked, i == len(want)-1)
+		assert.Equal(t, l.Wait("alice"), w)
+		now = now.Add(w)
+	}
+
+	// other keys are unaffected
+	assert.Equal(t, l.Wait("bob"), time.Duration(0))
+
+	// after the lockout the count starts over
+	assert.Equal(t, l.Wait("alice"), time.Duration(0))
+	l.Fail("alice")
+	assert.Equal(t, l.Wait("alice"), time.Duration(0))
+}
+
+func TestReset(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	l := newTestLimiter(&now)
+
+	for range 3 {
+		l.Fail("alice")
+	}
+	assert.Equal(t, l.Wait("alice"), time.Second)
+
+	l.Reset("alice")
+	assert.Equal(t, l.Wait("alice"), time.Duration(0))
+	l.Fail("alice")
+	assert.Equal(t, l.Wait("alice"), time.Duration(0))
+}
+
+func TestForget(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	l := newTestLimiter(&now)
+
+	for range 3 {
+		l.Fail("alice")
+	}
+	now = now.Add(2 * time.Hour)
+	l.Prune()
+	assert.Equal(t, len(l.entries), 0)
+
+	l.Fail("alice")
+	assert.Equal(t, l.Wait("alice"), time.Duration(0))
+}
@@ -0,0 +1,84 @@
+package totp
+
+import (
+	"encoding/base32"
+	"snippetbox-n/internal/assert"
+	"testing"
+	"time"
+)
+
+// the SHA1 vectors from RFC 6238 appendix B, which are eight digits long; six
+// digit codes are their last six digits
+func TestCode(t *testing.T) {
+	secret := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, tt := range tests {
+		got, err := Code(secret, Step(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, got, tt.want)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	secret := "JBSWY3DPEHPK3PXP"
+	now := time.Unix(1700000000, 0)
+	code, err := Code(secret, Step(now))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		code   string
+		at     time.Time
+		wantOK bool
+	}{
+		{"Current step", code, now, true},
+		{"With spaces", code[:3] + " " + code[3:], now, true},
+		{"Previous step", code, now.Add(Period), true},
+		{"Too old", code, now.Add(2 * Period), false},
+		{"Too short", code[:5], now, false},
+		{"Wrong", "000000", now, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := Validate(secret, tt.code, tt.at)
+			assert.Equal(t, ok, tt.wantOK)
+			if ok {
+				assert.Equal(t, step, Step(now))
+			}
+		})
+	}
+}
+
+func TestNewSecret(t *testing.T) {
+	secret, err := NewSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, len(secret), 32)
+
+	_, err = Code(secret, 0)
+	assert.Equal(t, err, nil)
+}
+
+func TestURL(t *testing.T) {
+	got := URL("Snippetbox", "alice@example.com", "JBSWY3DPEHPK3PXP")
+	want := "otpauth://totp/Snippetbox:alice@example.com?algorithm=SHA1&digits=6&issuer=Snippetbox&period=30&secret=JBSWY3DPEHPK3PXP"
+	assert.Equal(t, got, want)
+}
@@ -5,4 +5,190 @@ for (var i = 0; i < navLinks.length; i++) {
 		link.classList.add("live");
 		break;
 	}
-}
\ No newline at end of file
+}
+// Line anchors on the snippet view: #L10 or #L10-L20 highlights those lines,
+// clicking a line number copies a link to it and shift-click extends the range.
+var codeLines = document.querySelectorAll("pre.lines .line");
+if (codeLines.length > 0) {
+	var rangeStart = null;
+
+	var highlightLines = function () {
+		for (var i = 0; i < codeLines.length; i++) {
+			codeLines[i].classList.remove("highlight");
+		}
+		var match = window.location.hash.match(/^#L(\d+)(?:-L(\d+))?$/);
+		if (!match) {
+			return;
+		}
+		var from = parseInt(match[1], 10);
+		var to = match[2] ? parseInt(match[2], 10) : from;
+		if (to < from) {
+			var tmp = from;
+			from = to;
+			to = tmp;
+		}
+		// #L0 or a line past the end
+		var first = document.getElementById("L" + from);
+		if (!first) {
+			return;
+		}
+		rangeStart = from;
+		for (var n = from; n <= to; n++) {
+			var line = document.getElementById("L" + n);
+			if (!line) {
+				break;
+			}
+			line.classList.add("highlight");
+		}
+		first.scrollIntoView({block: "center"});
+	};
+
+	var lineNumbers = document.querySelectorAll("pre.lines .lineno");
+	for (var i = 0; i < lineNumbers.length; i++) {
+		lineNumbers[i].addEventListener("click", function (e) {
+			e.preventDefault();
+			var line = parseInt(this.textContent, 10);
+			var hash = "#L" + line;
+			if (e.shiftKey && rangeStart !== null && rangeStart !== line) {
+				hash = "#L" + Math.min(rangeStart, line) + "-L" + Math.max(rangeStart, line);
+			}
+			history.replaceState(null, "", hash);
+			highlightLines();
+
+			var link = this;
+			if (navigator.clipboard) {
+				navigator.clipboard.writeText(window.location.href).then(function () {
+					link.classList.add("copied");
+					setTimeout(function () { link.classList.remove("copied"); }, 1000);
+				});
+			}
+		});
+	}
+
+	window.addEventListener("hashchange", highlightLines);
+	highlightLines();
+}
+// Passkeys: the server hands out WebAuthn options as JSON with binary fields
+// base64url encoded, and expects the authenticator's answer back the same way.
+var b64urlToBuffer = function (s) {
+	s = s.replace(/-/g, "+").replace(/_/g, "/");
+	while (s.length % 4) {
+		s += "=";
+	}
+	var raw = atob(s);
+	var bytes = new Uint8Array(raw.length);
+	for (var i = 0; i < raw.length; i++) {
+		bytes[i] = raw.charCodeAt(i);
+	}
+	return bytes.buffer;
+};
+
+var bufferToB64url = function (buf) {
+	var bytes = new Uint8Array(buf);
+	var raw = "";
+	for (var i = 0; i < bytes.length; i++) {
+		raw += String.fromCharCode(bytes[i]);
+	}
+	return btoa(raw).replace(/\+/g, "-").replace(/\//g, "_").replace(/=+$/, "");
+};
+
+var passkeyPost = function (url, csrf, body) {
+	return fetch(url, {
+		method: "POST",
+		credentials: "same-origin",
+		headers: {"Content-Type": "application/json", "X-CSRF-Token": csrf},
+		body: body ? JSON.stringify(body) : null
+	}).then(function (res) {
+		return res.json().then(function (data) {
+			if (!res.ok) {
+				throw new Error(data.error || "Something went wrong");
+			}
+			return data;
+		});
+	});
+};
+
+var passkeyError = function (container, err) {
+	var box = container.querySelector(".passkey-error");
+	box.textContent = err.message || "The passkey request was cancelled";
+	box.hidden = false;
+};
+
+var passkeyLogin = document.getElementById("passkey-login");
+if (passkeyLogin && window.PublicKeyCredential) {
+	passkeyLogin.hidden = false;
+	passkeyLogin.querySelector("button").addEventListener("click", function (e) {
+		e.preventDefault();
+		var csrf = passkeyLogin.dataset.csrf;
+		var remember = document.querySelector("input[name=remember]");
+		passkeyPost("/user/login/passkey/begin", csrf, {remember: remember.checked}).then(function (options) {
+			var pk = options.publicKey;
+			pk.challenge = b64urlToBuffer(pk.challenge);
+			(pk.allowCredentials || []).forEach(function (c) { c.id = b64urlToBuffer(c.id); });
+			return navigator.credentials.get({publicKey: pk});
+		}).then(function (cred) {
+			return passkeyPost("/user/login/passkey/finish", csrf, {
+				id: cred.id,
+				rawId: bufferToB64url(cred.rawId),
+				type: cred.type,
+				response: {
+					clientDataJSON: bufferToB64url(cred.response.clientDataJSON),
+					authenticatorData: bufferToB64url(cred.response.authenticatorData),
+					signature: bufferToB64url(cred.response.signature),
+					userHandle: cred.response.userHandle ? bufferToB64url(cred.response.userHandle) : null
+				}
+			});
+		}).then(function (data) {
+			window.location = data.redirect;
+		}).catch(function (err) {
+			passkeyError(passkeyLogin, err);
+		});
+	});
+}
+
+// Single sign-on links take "remember me" along to the provider and back.
+var ssoLinks = document.querySelectorAll(".sso-login a");
+for (var i = 0; i < ssoLinks.length; i++) {
+	ssoLinks[i].addEventListener("click", function (e) {
+		var remember = document.querySelector("input[name=remember]");
+		if (remember && remember.checked) {
+			e.preventDefault();
+			window.location = this.href + "?remember=true";
+		}
+	});
+}
+
+var passkeyRegister = document.getElementById("passkey-register");
+if (passkeyRegister) {
+	passkeyRegister.addEventListener("submit", function (e) {
+		e.preventDefault();
+		if (!window.PublicKeyCredential) {
+			passkeyError(passkeyRegister, new Error("This browser doesn't support passkeys"));
+			return;
+		}
+		var csrf = passkeyRegister.dataset.csrf;
+		var name = passkeyRegister.querySelector("input[name=name]").value;
+		passkeyPost("/account/passkeys/register/begin", csrf).then(function (options) {
+			var pk = options.publicKey;
+			pk.challenge = b64urlToBuffer(pk.challenge);
+			pk.user.id = b64urlToBuffer(pk.user.id);
+			(pk.excludeCredentials || []).forEach(function (c) { c.id = b64urlToBuffer(c.id); });
+			return navigator.credentials.create({publicKey: pk});
+		}).then(function (cred) {
+			return passkeyPost("/account/passkeys/register/finish?name=" + encodeURIComponent(name), csrf, {
+				id: cred.id,
+				rawId: bufferToB64url(cred.rawId),
+				type: cred.type,
+				response: {
+					clientDataJSON: bufferToB64url(cred.response.clientDataJSON),
+					attestationObject: bufferToB64url(cred.response.attestationObject),
+					transports: cred.response.getTransports ? cred.response.getTransports() : []
+				}
+			});
+		}).then(function (data) {
+			window.location = data.redirect;
+		}).catch(function (err) {
+			passkeyError(passkeyRegister, err);
+		});
+	});
+}